@@ -0,0 +1,339 @@
+package miniohandler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+)
+
+func init() {
+	caddy.RegisterModule(MinioCacheAdmin{})
+}
+
+// adminBasePath is the prefix of every admin API route served by this module.
+const adminBasePath = "/minio_static_html/"
+
+// MinioCacheAdmin exposes cache management endpoints on Caddy's admin API.
+//
+//	POST /minio_static_html/cache/purge
+//
+// The purge request body is a JSON object with a required "bucket" and
+// either an exact "key" or a "key_prefix". An empty key_prefix purges every
+// cached object of the bucket. With "soft": true the key's entry is marked
+// stale rather than deleted. Alternatively "tag" alone purges every entry
+// carrying that surrogate key.
+//
+//	POST /minio_static_html/cache/generation
+//
+// With cache_generations enabled, starts a new cache generation for the
+// "bucket" named in the JSON body, invalidating all of its entries at
+// once. The entries of the old generation are deleted in the background.
+//
+//	GET /minio_static_html/cache/stats
+//
+// Reports the cache backend in use and whether it responds, along with the
+// handlers' hit ratio, entries written, bytes served from the cache and
+// from MinIO, overall and per bucket, and the latency percentiles of recent
+// cache reads and writes.
+type MinioCacheAdmin struct {
+	logger *zap.Logger
+	config *MinioConfigModule
+	events *eventEmitter
+}
+
+// purgeRequest is the body accepted by the purge endpoint.
+type purgeRequest struct {
+	Bucket    string `json:"bucket"`
+	Key       string `json:"key,omitempty"`
+	KeyPrefix string `json:"key_prefix,omitempty"`
+
+	// Soft marks the object's entry stale instead of deleting it.
+	Soft bool `json:"soft,omitempty"`
+
+	// Tag purges every entry carrying this surrogate key, in any bucket.
+	Tag string `json:"tag,omitempty"`
+}
+
+// generationRequest is the body accepted by the generation endpoint.
+type generationRequest struct {
+	Bucket string `json:"bucket"`
+}
+
+// cacheStats is the document served by the stats endpoint.
+type cacheStats struct {
+	// The cache backend, or "" if caching is not configured.
+	Backend string `json:"backend"`
+
+	// Whether the backend answered a ping, and how long it took.
+	Up            bool    `json:"up"`
+	PingLatencyMs float64 `json:"ping_latency_ms,omitempty"`
+
+	// When the counters below started, which is when the process did.
+	Since time.Time `json:"since"`
+
+	// Request and byte counters, summed over all buckets and for each
+	// configured bucket.
+	Totals  trafficStats            `json:"totals"`
+	Buckets map[string]trafficStats `json:"buckets"`
+
+	// Latencies of cache reads and writes made while serving requests.
+	Latency map[string]latencyStats `json:"latency"`
+}
+
+// CaddyModule returns the Caddy module information for the admin API.
+func (MinioCacheAdmin) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "admin.api.minio_static_html",
+		New: func() caddy.Module { return new(MinioCacheAdmin) },
+	}
+}
+
+// Provision looks up the global minio.config app, if one is configured.
+func (a *MinioCacheAdmin) Provision(ctx caddy.Context) error {
+	a.logger = ctx.Logger(a)
+
+	// The admin API is loaded whether or not this plugin is in use, so a
+	// missing app is not an error; the endpoints just report it.
+	val, err := ctx.AppIfConfigured("minio.config")
+	if errors.Is(err, caddy.ErrNotConfigured) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	a.config = val.(*MinioConfigModule)
+	a.events, err = newEventEmitter(ctx)
+	return err
+}
+
+// Routes returns the admin routes served by this module.
+func (a *MinioCacheAdmin) Routes() []caddy.AdminRoute {
+	return []caddy.AdminRoute{
+		{
+			Pattern: adminBasePath + "cache/purge",
+			Handler: caddy.AdminHandlerFunc(a.handlePurge),
+		},
+		{
+			Pattern: adminBasePath + "cache/generation",
+			Handler: caddy.AdminHandlerFunc(a.handleGeneration),
+		},
+		{
+			Pattern: adminBasePath + "cache/stats",
+			Handler: caddy.AdminHandlerFunc(a.handleStats),
+		},
+	}
+}
+
+// handlePurge deletes cache entries matching the request body.
+func (a *MinioCacheAdmin) handlePurge(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost {
+		return caddy.APIError{
+			HTTPStatus: http.StatusMethodNotAllowed,
+			Err:        fmt.Errorf("method not allowed: %v", r.Method),
+		}
+	}
+	if a.config == nil || a.config.cache == nil {
+		return caddy.APIError{
+			HTTPStatus: http.StatusServiceUnavailable,
+			Err:        errors.New("caching is not configured"),
+		}
+	}
+
+	var req purgeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return caddy.APIError{
+			HTTPStatus: http.StatusBadRequest,
+			Err:        fmt.Errorf("decoding request body: %v", err),
+		}
+	}
+	if req.Tag != "" && (req.Bucket != "" || req.Key != "" || req.KeyPrefix != "" || req.Soft) {
+		return caddy.APIError{
+			HTTPStatus: http.StatusBadRequest,
+			Err:        errors.New("tag cannot be combined with other fields"),
+		}
+	}
+	if req.Bucket == "" && req.Tag == "" {
+		return caddy.APIError{
+			HTTPStatus: http.StatusBadRequest,
+			Err:        errors.New("bucket must be specified"),
+		}
+	}
+	if req.Key != "" && req.KeyPrefix != "" {
+		return caddy.APIError{
+			HTTPStatus: http.StatusBadRequest,
+			Err:        errors.New("key and key_prefix are mutually exclusive"),
+		}
+	}
+	if req.Soft && req.Key == "" {
+		return caddy.APIError{
+			HTTPStatus: http.StatusBadRequest,
+			Err:        errors.New("soft purges require a key"),
+		}
+	}
+
+	var n int64
+	var err error
+	switch {
+	case req.Tag != "":
+		n, err = a.config.purgeTag(r.Context(), req.Tag)
+	case req.Soft:
+		n, err = a.config.softPurgeObject(r.Context(), req.Bucket, req.Key)
+	case req.Key != "":
+		n, err = a.config.purgeObject(r.Context(), req.Bucket, req.Key)
+	default:
+		n, err = a.config.purgePrefix(r.Context(), req.Bucket, req.KeyPrefix)
+	}
+	if errors.Is(err, errors.ErrUnsupported) {
+		return caddy.APIError{
+			HTTPStatus: http.StatusNotImplemented,
+			Err:        err,
+		}
+	} else if err != nil {
+		return caddy.APIError{
+			HTTPStatus: http.StatusInternalServerError,
+			Err:        fmt.Errorf("purging cache: %v", err),
+		}
+	}
+
+	a.logger.Info("purged cache entries",
+		zap.String("bucket", req.Bucket),
+		zap.String("key", req.Key),
+		zap.String("key_prefix", req.KeyPrefix),
+		zap.String("tag", req.Tag),
+		zap.Bool("soft", req.Soft),
+		zap.Int64("count", n),
+	)
+	a.events.emitPurged("admin", n, map[string]any{
+		"bucket":     req.Bucket,
+		"key":        req.Key,
+		"key_prefix": req.KeyPrefix,
+		"tag":        req.Tag,
+		"soft":       req.Soft,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(purgeResult(req.Soft, n))
+}
+
+// handleGeneration starts a new cache generation for a bucket.
+func (a *MinioCacheAdmin) handleGeneration(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost {
+		return caddy.APIError{
+			HTTPStatus: http.StatusMethodNotAllowed,
+			Err:        fmt.Errorf("method not allowed: %v", r.Method),
+		}
+	}
+	if a.config == nil || a.config.cache == nil {
+		return caddy.APIError{
+			HTTPStatus: http.StatusServiceUnavailable,
+			Err:        errors.New("caching is not configured"),
+		}
+	}
+	if !a.config.CacheGenerations {
+		return caddy.APIError{
+			HTTPStatus: http.StatusConflict,
+			Err:        errors.New("cache_generations is not enabled"),
+		}
+	}
+
+	var req generationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return caddy.APIError{
+			HTTPStatus: http.StatusBadRequest,
+			Err:        fmt.Errorf("decoding request body: %v", err),
+		}
+	}
+	if req.Bucket == "" {
+		return caddy.APIError{
+			HTTPStatus: http.StatusBadRequest,
+			Err:        errors.New("bucket must be specified"),
+		}
+	}
+
+	old, gen, err := a.config.bumpGeneration(r.Context(), req.Bucket)
+	if err != nil {
+		return caddy.APIError{
+			HTTPStatus: http.StatusInternalServerError,
+			Err:        fmt.Errorf("starting cache generation: %v", err),
+		}
+	}
+	a.logger.Info("started cache generation",
+		zap.String("bucket", req.Bucket),
+		zap.String("generation", gen),
+		zap.String("previous", old))
+	a.events.emit(eventPurged, map[string]any{
+		"source":     "generation",
+		"bucket":     req.Bucket,
+		"generation": gen,
+	})
+
+	// The old entries are unreachable already; deleting them just frees
+	// the space sooner, pinned entries included.
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		defer cancel()
+		n, err := a.config.purgeGeneration(ctx, req.Bucket, old)
+		if err != nil && !errors.Is(err, errors.ErrUnsupported) {
+			a.logger.Warn("failed to delete old cache generation",
+				zap.String("bucket", req.Bucket),
+				zap.String("generation", old),
+				zap.Error(err))
+			return
+		}
+		a.logger.Debug("deleted old cache generation",
+			zap.String("bucket", req.Bucket),
+			zap.String("generation", old),
+			zap.Int64("count", n))
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(map[string]string{"generation": gen})
+}
+
+// handleStats reports the state of the cache and the handlers' statistics.
+func (a *MinioCacheAdmin) handleStats(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodGet {
+		return caddy.APIError{
+			HTTPStatus: http.StatusMethodNotAllowed,
+			Err:        fmt.Errorf("method not allowed: %v", r.Method),
+		}
+	}
+	if a.config == nil {
+		return caddy.APIError{
+			HTTPStatus: http.StatusServiceUnavailable,
+			Err:        errors.New("the minio.config app is not configured"),
+		}
+	}
+
+	var stats cacheStats
+	if a.config.cache != nil {
+		stats.Backend = a.config.cacheName()
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+		start := time.Now()
+		if err := a.config.cache.Ping(ctx); err == nil {
+			stats.Up = true
+			stats.PingLatencyMs = milliseconds(time.Since(start))
+		}
+	}
+	stats.Since = handlerStats.started
+	stats.Totals, stats.Buckets = collectTraffic()
+	stats.Latency = map[string]latencyStats{
+		"get": handlerStats.get.summary(),
+		"set": handlerStats.set.summary(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(stats)
+}
+
+var (
+	_ caddy.Provisioner = (*MinioCacheAdmin)(nil)
+	_ caddy.AdminRouter = (*MinioCacheAdmin)(nil)
+)
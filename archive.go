@@ -0,0 +1,186 @@
+package miniohandler
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/minio/minio-go/v7"
+	"go.uber.org/zap"
+)
+
+// Archive formats supported for directory downloads.
+const (
+	archiveZip   = "zip"
+	archiveTarGz = "tar.gz"
+)
+
+// defaultArchiveObjects caps the objects in an archive when max_objects is
+// not configured.
+const defaultArchiveObjects = 10000
+
+// Archive lets clients download a directory as a single archive, assembled
+// while it streams, by adding ?download=zip or ?download=tar.gz to the
+// directory's URL. Hidden objects, and those the allow filter rejects, are
+// left out.
+type Archive struct {
+	// The formats offered, "zip" and "tar.gz" (the default is both).
+	Formats []string `json:"formats,omitempty"`
+
+	// The most objects an archive may hold (default 10000). Larger
+	// directories are refused with 413 before anything is sent.
+	MaxObjects int `json:"max_objects,omitempty"`
+}
+
+// validate checks the archive settings.
+func (a *Archive) validate() error {
+	for i, format := range a.Formats {
+		if format != archiveZip && format != archiveTarGz {
+			return fmt.Errorf("formats[%d]: unsupported format %q; must be zip or tar.gz", i, format)
+		}
+	}
+	if a.MaxObjects < 0 {
+		return fmt.Errorf("max_objects must not be negative")
+	}
+	return nil
+}
+
+// offers reports whether format is one of the archive formats offered.
+func (a *Archive) offers(format string) bool {
+	if len(a.Formats) == 0 {
+		return format == archiveZip || format == archiveTarGz
+	}
+	return slices.Contains(a.Formats, format)
+}
+
+// archiveRequested returns the archive format a request for a directory
+// asks for, or "" if it is not a download.
+func (h *MinioStaticHTML) archiveRequested(r *http.Request) string {
+	if h.Archive == nil || h.HtmlFile != "" || !strings.HasSuffix(r.URL.Path, "/") ||
+		(r.Method != http.MethodGet && r.Method != http.MethodHead) {
+		return ""
+	}
+	return r.URL.Query().Get("download")
+}
+
+// serveArchive streams every object under prefix as an archive in format.
+// Once the archive has started, errors can only be logged, leaving the
+// client an archive that fails to open.
+func (h *MinioStaticHTML) serveArchive(w http.ResponseWriter, r *http.Request, bucket, prefix, format string) error {
+	if !h.Archive.offers(format) {
+		return caddyhttp.Error(http.StatusBadRequest, fmt.Errorf("unsupported archive format %q", format))
+	}
+	limit := h.Archive.MaxObjects
+	if limit == 0 {
+		limit = defaultArchiveObjects
+	}
+	items, truncated, err := h.listPrefix(r.Context(), bucket, prefix, "", limit, true)
+	if err != nil {
+		return caddyhttp.Error(http.StatusBadGateway, fmt.Errorf("listing objects: %w", err))
+	}
+	if truncated {
+		return caddyhttp.Error(http.StatusRequestEntityTooLarge,
+			fmt.Errorf("directory holds more than %d objects", limit))
+	}
+	if len(items) == 0 {
+		return caddyhttp.Error(http.StatusNotFound, fmt.Errorf("no objects under %q", prefix))
+	}
+
+	name := path.Base(strings.TrimSuffix(prefix, "/"))
+	if prefix == "" {
+		name = bucket
+	}
+	contentType := "application/zip"
+	if format == archiveTarGz {
+		contentType = "application/gzip"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition",
+		mime.FormatMediaType("attachment", map[string]string{"filename": name + "." + format}))
+	w.Header().Set("Cache-Control", "no-store")
+	if r.Method == http.MethodHead {
+		return nil
+	}
+
+	if format == archiveZip {
+		err = h.writeZip(r.Context(), w, bucket, prefix, items)
+	} else {
+		err = h.writeTarGz(r.Context(), w, bucket, prefix, items)
+	}
+	if err != nil && r.Context().Err() == nil {
+		h.logger.Error("failed to stream archive",
+			zap.String("bucket", bucket),
+			zap.String("prefix", prefix),
+			zap.String("format", format),
+			zap.Error(err))
+	}
+	return nil
+}
+
+// writeZip writes the objects as a zip archive, with names relative to
+// prefix.
+func (h *MinioStaticHTML) writeZip(ctx context.Context, w io.Writer, bucket, prefix string, items []listItem) error {
+	zw := zip.NewWriter(w)
+	for _, item := range items {
+		fw, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     strings.TrimPrefix(item.Key, prefix),
+			Method:   zip.Deflate,
+			Modified: item.LastModified,
+		})
+		if err != nil {
+			return err
+		}
+		if err := h.copyObject(ctx, fw, bucket, item.Key); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// writeTarGz writes the objects as a gzipped tar archive, with names
+// relative to prefix.
+func (h *MinioStaticHTML) writeTarGz(ctx context.Context, w io.Writer, bucket, prefix string, items []listItem) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	for _, item := range items {
+		err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     strings.TrimPrefix(item.Key, prefix),
+			Size:     item.Size,
+			Mode:     0o644,
+			ModTime:  item.LastModified,
+		})
+		if err != nil {
+			return err
+		}
+		if err := h.copyObject(ctx, tw, bucket, item.Key); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+// copyObject streams an object from MinIO into w.
+func (h *MinioStaticHTML) copyObject(ctx context.Context, w io.Writer, bucket, objectKey string) error {
+	obj, err := h.client.GetObject(ctx, bucket, objectKey, minio.GetObjectOptions{ServerSideEncryption: h.sse})
+	if err != nil {
+		return fmt.Errorf("getting %s: %w", objectKey, err)
+	}
+	defer obj.Close()
+	if _, err := io.Copy(w, obj); err != nil {
+		return fmt.Errorf("copying %s: %w", objectKey, err)
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package miniohandler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"go.uber.org/zap"
+)
+
+// defaultBreakerCooldown is how long a tripped breaker stays open before
+// letting a probe request through.
+const defaultBreakerCooldown = 30 * time.Second
+
+// Circuit breaker states.
+const (
+	breakerClosed = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// breaker is a circuit breaker for one MinIO endpoint. It opens after
+// threshold consecutive failures, rejects requests for cooldown, then lets
+// a single probe through: success closes it, failure re-opens it.
+type breaker struct {
+	endpoint  string
+	threshold int
+	cooldown  time.Duration
+	logger    *zap.Logger
+
+	mu       sync.Mutex
+	state    int
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// breakerFor returns the circuit breaker shared by every handler that
+// talks to endpoint, or nil if circuit breaking is disabled.
+func (m *MinioConfig) breakerFor(endpoint string, logger *zap.Logger) *breaker {
+	if m.BreakerThreshold <= 0 {
+		return nil
+	}
+	m.breakersMu.Lock()
+	defer m.breakersMu.Unlock()
+	if b, ok := m.breakers[endpoint]; ok {
+		return b
+	}
+	cooldown := defaultBreakerCooldown
+	if m.BreakerCooldown != "" {
+		// Already validated in Validate.
+		cooldown, _ = time.ParseDuration(m.BreakerCooldown)
+	}
+	b := &breaker{
+		endpoint:  endpoint,
+		threshold: m.BreakerThreshold,
+		cooldown:  cooldown,
+		logger:    logger,
+	}
+	if m.breakers == nil {
+		m.breakers = make(map[string]*breaker)
+	}
+	m.breakers[endpoint] = b
+	return b
+}
+
+// allow reports whether a request may be sent to the endpoint. When it
+// returns true the caller must report the outcome with done.
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = breakerHalfOpen
+		b.probing = true
+		return true
+	case breakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	}
+	return true
+}
+
+// done records the outcome of a request admitted by allow. A missing
+// object counts as success; a cancelled request, whether by the client or
+// because a hedged request won, is not counted at all.
+func (b *breaker) done(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if errors.Is(err, context.Canceled) {
+		if b.state == breakerHalfOpen {
+			b.probing = false
+		}
+		return
+	}
+	healthy := err == nil || !originFailure(err)
+	if b.state == breakerHalfOpen {
+		b.probing = false
+		if healthy {
+			b.state = breakerClosed
+			b.failures = 0
+			b.logger.Info("minio circuit breaker closed", zap.String("endpoint", b.endpoint))
+		} else {
+			b.state = breakerOpen
+			b.openedAt = time.Now()
+		}
+		return
+	}
+
+	if healthy {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.state == breakerClosed && b.failures >= b.threshold {
+		b.state = breakerOpen
+		b.openedAt = time.Now()
+		b.logger.Warn("minio circuit breaker opened",
+			zap.String("endpoint", b.endpoint),
+			zap.Int("consecutive_failures", b.failures),
+			zap.Duration("cooldown", b.cooldown),
+			zap.Error(err))
+	}
+}
+
+// originFailure reports whether err indicates a problem with the object
+// store itself: a transport error, a timeout or a 5xx response, as opposed
+// to a 4xx such as NoSuchKey or the client cancelling the request.
+func originFailure(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	status := minio.ToErrorResponse(err).StatusCode
+	return status == 0 || status >= http.StatusInternalServerError
+}
+
+// serveBreakerOpen answers a cache miss while every origin's breaker is
+// open with a 503 and Retry-After. The body is the 503 error page if it is
+// cached, otherwise the not_found_file if one is configured.
+func (h *MinioStaticHTML) serveBreakerOpen(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Retry-After", "10")
+	if h.serveErrorPage(w, r, http.StatusServiceUnavailable) {
+		return
+	}
+	if name := h.GlobalConfig.NotFoundFile; name != "" {
+		f, err := os.Open(name)
+		if err == nil {
+			defer f.Close()
+			var info os.FileInfo
+			if info, err = f.Stat(); err == nil {
+				h.writeErrorPage(w, r, http.StatusServiceUnavailable, h.contentTypeByExtension(name), "", info.Size(), f)
+				return
+			}
+		}
+		h.logger.Warn("failed to open not_found_file", zap.String("file", name), zap.Error(err))
+	}
+	http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+}
@@ -0,0 +1,231 @@
+package miniohandler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"go.uber.org/zap"
+)
+
+// defaultBrowseEntries caps directory listings when max_entries is not
+// configured.
+const defaultBrowseEntries = 1000
+
+// Browse renders a listing of the objects under a directory that has no
+// index.html, built from ListObjects. Clients that accept
+// application/json get the listing as JSON; others get an HTML page.
+type Browse struct {
+	// A local html/template file rendering the listing, in place of the
+	// built-in page. It is executed with a dirListing.
+	TemplateFile string `json:"template_file,omitempty"`
+
+	// The most entries listed (default 1000). Larger directories are
+	// listed in part, and the listing is marked truncated.
+	MaxEntries int `json:"max_entries,omitempty"`
+
+	tmpl *template.Template
+}
+
+// dirListing is the data a listing is rendered from.
+type dirListing struct {
+	// The request path of the directory and the key prefix listed.
+	Path   string `json:"path"`
+	Prefix string `json:"prefix"`
+
+	Items []listItem `json:"items"`
+
+	// Set if more entries exist than were listed.
+	Truncated bool `json:"truncated"`
+}
+
+// listItem is an object, or a directory, in a listing.
+type listItem struct {
+	Name         string    `json:"name"`
+	Key          string    `json:"key"`
+	URL          string    `json:"url"`
+	IsDir        bool      `json:"is_dir"`
+	Size         int64     `json:"size"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified time.Time `json:"last_modified,omitzero"`
+}
+
+// HumanSize formats the item's size for templates.
+func (i listItem) HumanSize() string {
+	const unit = 1024
+	if i.Size < unit {
+		return fmt.Sprintf("%d B", i.Size)
+	}
+	div, exp := int64(unit), 0
+	for n := i.Size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(i.Size)/float64(div), "KMGTPE"[exp])
+}
+
+// provision parses the listing template.
+func (b *Browse) provision() error {
+	if b.TemplateFile == "" {
+		b.tmpl = defaultBrowseTemplate
+		return nil
+	}
+	text, err := os.ReadFile(b.TemplateFile)
+	if err != nil {
+		return fmt.Errorf("reading template_file: %w", err)
+	}
+	b.tmpl, err = template.New(path.Base(b.TemplateFile)).Parse(string(text))
+	if err != nil {
+		return fmt.Errorf("parsing template_file: %w", err)
+	}
+	return nil
+}
+
+// validate checks the listing settings.
+func (b *Browse) validate() error {
+	if b.MaxEntries < 0 {
+		return fmt.Errorf("max_entries must not be negative")
+	}
+	return nil
+}
+
+// serveBrowse lists the directory a request for a missing index.html
+// names, reporting false, having written nothing, if browsing is off or
+// the request is not for a directory.
+func (h *MinioStaticHTML) serveBrowse(w http.ResponseWriter, r *http.Request, bucket, objectKey string) bool {
+	if h.Browse == nil || h.HtmlFile != "" || !strings.HasSuffix(r.URL.Path, "/") ||
+		(r.Method != http.MethodGet && r.Method != http.MethodHead) {
+		return false
+	}
+	prefix := strings.TrimSuffix(objectKey, "index.html")
+
+	limit := h.Browse.MaxEntries
+	if limit == 0 {
+		limit = defaultBrowseEntries
+	}
+	items, truncated, err := h.listPrefix(r.Context(), bucket, prefix, "", limit, false)
+	if err != nil {
+		h.logger.Error("failed to list directory",
+			zap.String("bucket", bucket),
+			zap.String("prefix", prefix),
+			zap.Error(err))
+		return false
+	}
+	// Directories come first, as in file browsers.
+	slices.SortStableFunc(items, func(a, b listItem) int {
+		switch {
+		case a.IsDir == b.IsDir:
+			return 0
+		case a.IsDir:
+			return -1
+		}
+		return 1
+	})
+	listing := dirListing{Path: r.URL.Path, Prefix: prefix, Items: items, Truncated: truncated}
+
+	var buf bytes.Buffer
+	contentType := "text/html; charset=utf-8"
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		contentType = "application/json"
+		err = json.NewEncoder(&buf).Encode(listing)
+	} else {
+		err = h.Browse.tmpl.Execute(&buf, listing)
+	}
+	if err != nil {
+		h.logger.Error("failed to render directory listing", zap.String("prefix", prefix), zap.Error(err))
+		return false
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", buf.Len()))
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Add("Vary", "Accept")
+	if r.Method != http.MethodHead {
+		if _, err := buf.WriteTo(w); err != nil {
+			h.logger.Debug("failed to write directory listing", zap.Error(err))
+		}
+	}
+	return true
+}
+
+// listPrefix lists up to limit objects and directories directly under
+// prefix, or with recursive every object under it, after the key
+// startAfter if given. Hidden keys and objects the allow filter rejects are
+// left out. It reports whether more entries followed.
+func (h *MinioStaticHTML) listPrefix(ctx context.Context, bucket, prefix, startAfter string, limit int, recursive bool) ([]listItem, bool, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // stops the listing once enough entries are read
+
+	var items []listItem
+	for obj := range h.client.ListObjects(ctx, bucket, minio.ListObjectsOptions{
+		Prefix:     prefix,
+		StartAfter: startAfter,
+		Recursive:  recursive,
+	}) {
+		if obj.Err != nil {
+			return nil, false, obj.Err
+		}
+		isDir := strings.HasSuffix(obj.Key, "/")
+		if obj.Key == prefix || h.hidden(strings.TrimSuffix(obj.Key, "/")) || (!isDir && !h.allowed(obj.Key)) {
+			continue
+		}
+		if len(items) == limit {
+			return items, true, nil
+		}
+		name := strings.TrimSuffix(strings.TrimPrefix(obj.Key, prefix), "/")
+		item := listItem{
+			Name:  name,
+			Key:   obj.Key,
+			URL:   (&url.URL{Path: name}).EscapedPath(),
+			IsDir: isDir,
+		}
+		if isDir {
+			item.URL += "/"
+		} else {
+			item.Size = obj.Size
+			item.ETag = strings.Trim(obj.ETag, `"`)
+			item.LastModified = obj.LastModified
+		}
+		items = append(items, item)
+	}
+	return items, false, nil
+}
+
+// defaultBrowseTemplate is the built-in listing page.
+var defaultBrowseTemplate = template.Must(template.New("browse").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Path}}</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+td, th { padding: .25em 1.5em .25em 0; text-align: left; }
+td.size { text-align: right; }
+</style>
+</head>
+<body>
+<h1>{{.Path}}</h1>
+<table>
+<tr><th>Name</th><th>Size</th><th>Modified</th></tr>
+{{if ne .Path "/"}}<tr><td><a href="../">../</a></td><td></td><td></td></tr>
+{{end}}{{range .Items}}<tr>
+<td><a href="./{{.URL}}">{{.Name}}{{if .IsDir}}/{{end}}</a></td>
+<td class="size">{{if not .IsDir}}{{.HumanSize}}{{end}}</td>
+<td>{{if not .IsDir}}{{.LastModified.UTC.Format "2006-01-02 15:04"}}{{end}}</td>
+</tr>
+{{end}}</table>
+{{if .Truncated}}<p>Only the first {{len .Items}} entries are listed.</p>{{end}}
+</body>
+</html>
+`))
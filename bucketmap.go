@@ -0,0 +1,107 @@
+package miniohandler
+
+import (
+	"maps"
+	"net"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+// hostRoute is one wildcard entry of the bucket map.
+type hostRoute struct {
+	labels    []string
+	wildcards int // number of "*" labels
+	bucket    string
+}
+
+// provisionBucketMap splits BucketMap into exact hostnames and wildcard
+// patterns. Wildcards are ordered by how many labels they leave open, so
+// "*.docs.example.com" is tried before "*.*.example.com".
+func (h *MinioStaticHTML) provisionBucketMap() {
+	h.exactHosts = make(map[string]string, len(h.BucketMap))
+	h.wildcardHosts = nil
+	for pattern, bucket := range h.BucketMap {
+		pattern = strings.ToLower(pattern)
+		if !strings.Contains(pattern, "*") {
+			h.exactHosts[pattern] = bucket
+			continue
+		}
+		labels := strings.Split(pattern, ".")
+		h.wildcardHosts = append(h.wildcardHosts, hostRoute{
+			labels:    labels,
+			wildcards: strings.Count(pattern, "*"),
+			bucket:    bucket,
+		})
+	}
+	sort.Slice(h.wildcardHosts, func(i, j int) bool {
+		return h.wildcardHosts[i].wildcards < h.wildcardHosts[j].wildcards
+	})
+}
+
+// staticBuckets returns the configured buckets that don't depend on the
+// request, i.e. Bucket, the bucket_map targets and the fallback buckets
+// without placeholders.
+func (h *MinioStaticHTML) staticBuckets() []string {
+	var buckets []string
+	candidates := append([]string{h.Bucket}, slices.Collect(maps.Values(h.BucketMap))...)
+	for _, bucket := range append(candidates, h.FallbackBuckets...) {
+		if bucket == "" || strings.Contains(bucket, "{") || slices.Contains(buckets, bucket) {
+			continue
+		}
+		buckets = append(buckets, bucket)
+	}
+	return buckets
+}
+
+// resolveBucket returns the bucket to serve r from: the bucket_map entry
+// for the request's host if there is one, otherwise the configured Bucket,
+// unless the request is being served from a fallback bucket. Placeholders
+// are expanded with repl.
+func (h *MinioStaticHTML) resolveBucket(r *http.Request, repl *caddy.Replacer) string {
+	if i := fallbackIndex(r); i >= 0 {
+		return repl.ReplaceAll(h.FallbackBuckets[i], "")
+	}
+	if bucket, ok := h.bucketForHost(r.Host); ok {
+		return repl.ReplaceAll(bucket, "")
+	}
+	return repl.ReplaceAll(h.Bucket, "")
+}
+
+// bucketForHost looks host up in the bucket map. As with Caddy's host
+// matcher, each "*" in a pattern matches exactly one label.
+func (h *MinioStaticHTML) bucketForHost(host string) (string, bool) {
+	if len(h.exactHosts) == 0 && len(h.wildcardHosts) == 0 {
+		return "", false
+	}
+	if hostOnly, _, err := net.SplitHostPort(host); err == nil {
+		host = hostOnly
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	if bucket, ok := h.exactHosts[host]; ok {
+		return bucket, true
+	}
+	labels := strings.Split(host, ".")
+	for _, route := range h.wildcardHosts {
+		if matchLabels(route.labels, labels) {
+			return route.bucket, true
+		}
+	}
+	return "", false
+}
+
+func matchLabels(pattern, labels []string) bool {
+	if len(pattern) != len(labels) {
+		return false
+	}
+	for i, p := range pattern {
+		if p != "*" && p != labels[i] {
+			return false
+		}
+	}
+	return true
+}
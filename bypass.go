@@ -0,0 +1,73 @@
+package miniohandler
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+// CacheBypass lets clients skip the cache read. Bypassing requests are
+// fetched from MinIO, refresh the cache and are marked
+// X-Cache-Status: BYPASS.
+type CacheBypass struct {
+	// Bypass on a request Cache-Control: no-cache or Pragma: no-cache, as
+	// sent by browsers on a hard reload.
+	NoCache bool `json:"no_cache,omitempty"`
+
+	// Bypass when this query parameter is present, e.g. "nocache".
+	Query string `json:"query,omitempty"`
+
+	// If set, only bypass when the request also carries this secret,
+	// either in the X-Cache-Bypass-Token header or as the value of the
+	// query parameter. Placeholders are expanded at startup.
+	Token string `json:"token,omitempty"`
+}
+
+// provision expands placeholders in the token.
+func (b *CacheBypass) provision() {
+	b.Token = caddy.NewReplacer().ReplaceAll(b.Token, "")
+}
+
+// requested reports whether r asks to bypass the cache.
+func (b *CacheBypass) requested(r *http.Request) bool {
+	signalled := false
+	if b.NoCache {
+		signalled = headerListContains(r.Header.Get("Cache-Control"), "no-cache") ||
+			headerListContains(r.Header.Get("Pragma"), "no-cache")
+	}
+	queryValue := ""
+	if b.Query != "" && r.URL.Query().Has(b.Query) {
+		queryValue = r.URL.Query().Get(b.Query)
+		signalled = true
+	}
+	if !signalled {
+		return false
+	}
+	if b.Token == "" {
+		return true
+	}
+	for _, presented := range []string{r.Header.Get("X-Cache-Bypass-Token"), queryValue} {
+		if presented != "" && subtle.ConstantTimeCompare([]byte(presented), []byte(b.Token)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// markBypass records on r whether it bypasses the cache.
+func (h *MinioStaticHTML) markBypass(r *http.Request) {
+	if h.CacheBypass != nil && h.CacheBypass.requested(r) {
+		setCacheStatus(r, cacheStatusBypass)
+	}
+}
+
+// bypassed reports whether r bypasses the cache.
+func bypassed(r *http.Request) bool {
+	return cacheStatus(r, "") == cacheStatusBypass
+}
+
+// readCache reports whether r may be answered from the cache.
+func (h *MinioStaticHTML) readCache(r *http.Request) bool {
+	return h.cacheEnabled() && !bypassed(r)
+}
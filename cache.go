@@ -0,0 +1,95 @@
+package miniohandler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// CacheBackend stores the handler's cache entries. Backends are Caddy
+// modules in the minio_static_html.cache namespace, selected by the global
+// cache option; Redis and DragonflyDB are served by
+// minio_static_html.cache.redis.
+//
+// Keys are plain strings and values opaque bytes: encoding entries,
+// chunking and compression happen in the handler.
+type CacheBackend interface {
+	// Get returns the values stored under keys, in order, with nil for
+	// keys that are missing. Backends should fetch them together where
+	// they can, since lookups try several keys at once.
+	Get(ctx context.Context, keys ...string) ([][]byte, error)
+
+	// Set stores items, expiring after ttl, or never if ttl is zero.
+	// Where the backend allows it, either all of them are stored or none
+	// are.
+	Set(ctx context.Context, ttl time.Duration, items ...CacheItem) error
+
+	// Expire sets the expiry of those keys that exist to ttl from now.
+	Expire(ctx context.Context, ttl time.Duration, keys ...string) error
+
+	// Exists returns how many of keys exist.
+	Exists(ctx context.Context, keys ...string) (int64, error)
+
+	// Delete removes keys, returning how many existed.
+	Delete(ctx context.Context, keys ...string) (int64, error)
+
+	// DeletePrefix removes every key starting with prefix, returning how
+	// many were removed.
+	DeletePrefix(ctx context.Context, prefix string) (int64, error)
+
+	// Ping checks that the backend is reachable.
+	Ping(ctx context.Context) error
+}
+
+// CacheSets is implemented by backends that can also hold sets of
+// strings, which surrogate keys and pinned objects are listed in. The sets
+// live in the same keyspace as other entries, so Delete removes them.
+type CacheSets interface {
+	// SetAdd adds members to the set at key, which expires after ttl
+	// unless added to again, or never if ttl is zero.
+	SetAdd(ctx context.Context, ttl time.Duration, key string, members ...string) error
+
+	// SetMembers returns the members of the set at key, or none if it
+	// doesn't exist.
+	SetMembers(ctx context.Context, key string) ([]string, error)
+
+	// SetContains reports whether member is in the set at key.
+	SetContains(ctx context.Context, key, member string) (bool, error)
+}
+
+// CacheItem is a key and value written to a CacheBackend.
+type CacheItem struct {
+	Key   string
+	Value []byte
+}
+
+// errCacheMiss is returned when a key the handler relies on, such as a
+// chunk of a cached object, is no longer in the cache.
+var errCacheMiss = errors.New("not in cache")
+
+// getOne returns the value stored under key, or errCacheMiss.
+func getOne(ctx context.Context, cache CacheBackend, key string) ([]byte, error) {
+	values, err := cache.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 || values[0] == nil {
+		return nil, errCacheMiss
+	}
+	return values[0], nil
+}
+
+// cacheName describes the cache backend for log messages.
+func (m *MinioConfig) cacheName() string {
+	return backendName(m.cache)
+}
+
+// backendName describes a cache backend for log messages, using its String
+// method if it has one.
+func backendName(b CacheBackend) string {
+	if s, ok := b.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return fmt.Sprintf("%T", b)
+}
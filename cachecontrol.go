@@ -0,0 +1,69 @@
+package miniohandler
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// immutableCacheControl is sent for fingerprinted assets, which never
+// change under the same name.
+const immutableCacheControl = "public, max-age=31536000, immutable"
+
+// BrowserCacheControl sets the Cache-Control header sent to browsers,
+// independently of how long objects stay in DragonflyDB.
+type BrowserCacheControl struct {
+	// Objects whose request path matches this regular expression, such as
+	// fingerprinted bundles (`.*\.[0-9a-f]{8}\.(js|css)$`), are sent with
+	// "public, max-age=31536000, immutable".
+	ImmutablePattern string `json:"immutable_pattern,omitempty"`
+
+	// Cache-Control for HTML documents. Default: "no-cache", so browsers
+	// revalidate pages and pick up new asset fingerprints straight away.
+	HTML string `json:"html,omitempty"`
+
+	// Cache-Control for everything else. Default: "public, max-age=<ttl>"
+	// using the route's cache TTL, or nothing if caching is disabled.
+	Default string `json:"default,omitempty"`
+
+	immutable *regexp.Regexp
+}
+
+// provision compiles the immutable pattern.
+func (b *BrowserCacheControl) provision() error {
+	if b.ImmutablePattern == "" {
+		return nil
+	}
+	re, err := regexp.Compile(b.ImmutablePattern)
+	if err != nil {
+		return fmt.Errorf("invalid immutable_pattern: %w", err)
+	}
+	b.immutable = re
+	return nil
+}
+
+// cacheControl returns the Cache-Control value for a response to r with
+// the given content type, or "" to send none.
+func (h *MinioStaticHTML) cacheControl(r *http.Request, contentType string) string {
+	ttlPolicy := ""
+	if ttl := h.routeTTL(r, contentType); ttl > 0 {
+		ttlPolicy = fmt.Sprintf("public, max-age=%d", int(ttl.Seconds()))
+	}
+	b := h.BrowserCacheControl
+	if b == nil {
+		return ttlPolicy
+	}
+	switch {
+	case b.immutable != nil && b.immutable.MatchString(r.URL.Path):
+		return immutableCacheControl
+	case strings.HasPrefix(contentType, "text/html"):
+		if b.HTML != "" {
+			return b.HTML
+		}
+		return "no-cache"
+	case b.Default != "":
+		return b.Default
+	}
+	return ttlPolicy
+}
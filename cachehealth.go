@@ -0,0 +1,86 @@
+package miniohandler
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Supported values for MinioConfig.CacheFailureMode.
+const (
+	cacheFailStrict  = "strict"
+	cacheFailDegrade = "degrade"
+)
+
+// cacheAvailable reports whether DragonflyDB is configured and, as far as
+// the health monitor knows, reachable.
+func (m *MinioConfig) cacheAvailable() bool {
+	return m.cache != nil && m.cacheUp.Load()
+}
+
+// startCacheMonitor launches a goroutine that connects to DragonflyDB and
+// keeps track of its health. While the cache is down it retries with
+// exponential backoff capped at the retry interval; once up it is re-checked
+// every retry interval. It only runs in degrade mode, where the connection
+// is not attempted during Provision; in strict mode the cache is assumed to
+// stay up.
+func (m *MinioConfigModule) startCacheMonitor() {
+	if m.cache == nil || m.CacheFailureMode != cacheFailDegrade {
+		return
+	}
+
+	interval := 10 * time.Second
+	if m.CacheRetryInterval != "" {
+		// Already validated in Provision.
+		interval, _ = time.ParseDuration(m.CacheRetryInterval)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	m.stopMonitor = func() {
+		cancel()
+		<-done
+	}
+
+	go func() {
+		defer close(done)
+		backoff := time.Second
+		for {
+			m.checkCache(ctx)
+
+			wait := interval
+			if m.cacheUp.Load() {
+				backoff = time.Second
+			} else {
+				wait = backoff
+				backoff = min(backoff*2, interval)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+		}
+	}()
+}
+
+// checkCache pings DragonflyDB once and records the result, logging any
+// change in state.
+func (m *MinioConfigModule) checkCache(ctx context.Context) {
+	err := m.cache.Ping(ctx)
+	up := err == nil
+	setRedisUp(up)
+	if m.cacheUp.Swap(up) == up {
+		return
+	}
+	if up {
+		m.logger.Info("dragonflyDB reachable; caching enabled",
+			zap.String("cache", m.cacheName()))
+	} else {
+		m.logger.Warn("dragonflyDB unreachable; serving from origin until it recovers",
+			zap.String("cache", m.cacheName()),
+			zap.Error(err))
+	}
+}
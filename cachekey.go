@@ -0,0 +1,103 @@
+package miniohandler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+)
+
+// CacheKeyConfig adds request properties to the cache key, for responses
+// that differ by them.
+type CacheKeyConfig struct {
+	// Include the query string, normalized so that parameter order
+	// doesn't matter, e.g. for "?page=2".
+	Query bool `json:"query,omitempty"`
+
+	// Only include these query parameters. Implies query. Names may be
+	// globs like "filter_*".
+	QueryInclude []string `json:"query_include,omitempty"`
+
+	// Never include these query parameters, such as "utm_*" tracking
+	// parameters. Names may be globs.
+	QueryExclude []string `json:"query_exclude,omitempty"`
+
+	// Request headers to include. Unlike vary, they are not listed in the
+	// Vary response header.
+	Headers []string `json:"headers,omitempty"`
+}
+
+// validate checks the query parameter globs.
+func (c *CacheKeyConfig) validate() error {
+	for _, pattern := range slices.Concat(c.QueryInclude, c.QueryExclude) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid query parameter pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// matchAny reports whether name matches any of the globs in patterns.
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizedQuery returns the query parameters of r to cache by, sorted by
+// name and value. The version and cache bypass query parameters are left
+// out.
+func (h *MinioStaticHTML) normalizedQuery(r *http.Request) string {
+	c := h.CacheKey
+	if c == nil || (!c.Query && len(c.QueryInclude) == 0) {
+		return ""
+	}
+	query := r.URL.Query()
+	for name, values := range query {
+		if (len(c.QueryInclude) > 0 && !matchAny(c.QueryInclude, name)) ||
+			matchAny(c.QueryExclude, name) ||
+			(h.VersionQuery != "" && name == h.VersionQuery) ||
+			(h.CacheBypass != nil && name == h.CacheBypass.Query) {
+			delete(query, name)
+			continue
+		}
+		slices.Sort(values)
+	}
+	return query.Encode()
+}
+
+// variantCacheKey returns the key the variant of an object selected by r
+// is cached under, according to vary and cache_key. Variants live beside
+// the object's own entry so that purging the object drops them too.
+// Requests without any of the properties share the object's own entry.
+func (h *MinioStaticHTML) variantCacheKey(cacheKey string, r *http.Request) string {
+	var headers []string
+	if h.CacheKey != nil {
+		headers = h.CacheKey.Headers
+	}
+	if len(h.Vary) == 0 && len(headers) == 0 && h.CacheKey == nil {
+		return cacheKey
+	}
+	var b strings.Builder
+	for _, name := range slices.Concat(h.Vary, headers) {
+		value := strings.Join(r.Header.Values(name), ",")
+		if value == "" {
+			continue
+		}
+		fmt.Fprintf(&b, "%s=%s\n", strings.ToLower(name), strings.ToLower(strings.TrimSpace(value)))
+	}
+	if query := h.normalizedQuery(r); query != "" {
+		fmt.Fprintf(&b, "?%s\n", query)
+	}
+	if b.Len() == 0 {
+		return cacheKey
+	}
+	sum := sha256.Sum256([]byte(b.String()))
+	return cacheKey + ":vary:" + hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,128 @@
+package miniohandler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// Supported values for MinioConfig.CacheWriteOverflow.
+const (
+	cacheOverflowDrop = "drop"
+	cacheOverflowSync = "sync"
+)
+
+// defaultCacheWriteQueue is the queue size used when cache_write_queue is
+// not configured.
+const defaultCacheWriteQueue = 1000
+
+// cacheWriter runs cache writes on a fixed pool of goroutines, off the
+// request path.
+type cacheWriter struct {
+	queue    chan func()
+	overflow string
+	logger   *zap.Logger
+
+	cancel context.CancelFunc
+	done   sync.WaitGroup
+}
+
+// validateCacheWriter checks the async cache write settings.
+func (m *MinioConfig) validateCacheWriter() error {
+	if m.CacheWriteWorkers < 0 || m.CacheWriteQueue < 0 {
+		return fmt.Errorf("cache_write_workers and cache_write_queue must not be negative")
+	}
+	switch m.CacheWriteOverflow {
+	case "", cacheOverflowDrop, cacheOverflowSync:
+	default:
+		return fmt.Errorf("invalid cache_write_overflow %q; must be drop or sync", m.CacheWriteOverflow)
+	}
+	return nil
+}
+
+// startCacheWriter launches the cache write workers, if configured.
+func (m *MinioConfigModule) startCacheWriter() {
+	if m.CacheWriteWorkers <= 0 || m.cache == nil {
+		return
+	}
+	size := m.CacheWriteQueue
+	if size == 0 {
+		size = defaultCacheWriteQueue
+	}
+	overflow := m.CacheWriteOverflow
+	if overflow == "" {
+		overflow = cacheOverflowDrop
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cw := &cacheWriter{
+		queue:    make(chan func(), size),
+		overflow: overflow,
+		logger:   m.logger,
+		cancel:   cancel,
+	}
+	for range m.CacheWriteWorkers {
+		cw.done.Add(1)
+		go cw.run(ctx)
+	}
+	m.cacheWriter.Store(cw)
+}
+
+// stopCacheWriter finishes the queued writes and stops the workers. Later
+// writes are made synchronously.
+func (m *MinioConfigModule) stopCacheWriter() {
+	cw := m.cacheWriter.Swap(nil)
+	if cw == nil {
+		return
+	}
+	cw.cancel()
+	cw.done.Wait()
+}
+
+// run executes queued writes until ctx is cancelled, then drains the queue.
+func (cw *cacheWriter) run(ctx context.Context) {
+	defer cw.done.Done()
+	for {
+		select {
+		case write := <-cw.queue:
+			write()
+		case <-ctx.Done():
+			for {
+				select {
+				case write := <-cw.queue:
+					write()
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// enqueue queues write, reporting false if the caller should run it
+// itself. When the queue is full, the write is dropped or run by the caller
+// according to cache_write_overflow.
+func (cw *cacheWriter) enqueue(write func()) bool {
+	select {
+	case cw.queue <- write:
+		return true
+	default:
+	}
+	if cw.overflow == cacheOverflowSync {
+		return false
+	}
+	minioMetrics.cacheWritesDropped.Inc()
+	cw.logger.Debug("cache write queue full; dropping write")
+	return true
+}
+
+// writeCache performs a cache write, in the background if async writes are
+// enabled. The write gets a context that isn't cancelled with the request.
+func (h *MinioStaticHTML) writeCache(ctx context.Context, write func(ctx context.Context)) {
+	ctx = context.WithoutCancel(ctx)
+	if cw := h.GlobalConfig.cacheWriter.Load(); cw != nil && cw.enqueue(func() { write(ctx) }) {
+		return
+	}
+	write(ctx)
+}
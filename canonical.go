@@ -0,0 +1,63 @@
+package miniohandler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// redirectCanonical redirects r permanently to target, keeping its query
+// string. 308 keeps the method, unlike 301.
+func redirectCanonical(w http.ResponseWriter, r *http.Request, target string) {
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+	http.Redirect(w, r, target, http.StatusPermanentRedirect)
+}
+
+// serveIndexRedirect redirects a request for a directory's index.html to
+// the directory itself when redirect_index is enabled, reporting whether
+// it did.
+func (h *MinioStaticHTML) serveIndexRedirect(w http.ResponseWriter, r *http.Request) bool {
+	if !h.RedirectIndex || h.HtmlFile != "" || path.Base(r.URL.Path) != "index.html" {
+		return false
+	}
+	redirectCanonical(w, r, strings.TrimSuffix(r.URL.Path, "index.html"))
+	return true
+}
+
+// serveDirRedirect redirects a request for a missing object to the same
+// path with a trailing slash if the directory it names has an
+// index.html, when canonical_uris is enabled, reporting whether it did.
+func (h *MinioStaticHTML) serveDirRedirect(w http.ResponseWriter, r *http.Request, bucket, objectKey string) bool {
+	if !h.CanonicalURIs || h.HtmlFile != "" || strings.HasSuffix(r.URL.Path, "/") ||
+		(r.Method != http.MethodGet && r.Method != http.MethodHead) {
+		return false
+	}
+	if !h.objectExists(r.Context(), bucket, objectKey+"/index.html") {
+		return false
+	}
+	redirectCanonical(w, r, r.URL.Path+"/")
+	return true
+}
+
+// objectExists reports whether an object exists, trusting its cache entry
+// or missing marker if it has one. Errors count as the object not
+// existing.
+func (h *MinioStaticHTML) objectExists(ctx context.Context, bucket, objectKey string) bool {
+	if h.cacheEnabled() {
+		raw, err := getOne(ctx, h.cache, h.GlobalConfig.cacheKeyFor(ctx, bucket, objectKey))
+		if err == nil {
+			var obj CachedObject
+			if json.Unmarshal(raw, &obj) == nil {
+				return !obj.Missing
+			}
+		}
+	}
+	_, err := h.client.StatObject(ctx, bucket, objectKey, minio.StatObjectOptions{ServerSideEncryption: h.sse})
+	return err == nil
+}
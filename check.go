@@ -0,0 +1,267 @@
+package miniohandler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	caddycmd "github.com/caddyserver/caddy/v2/cmd"
+	"github.com/minio/minio-go/v7"
+	"github.com/spf13/cobra"
+)
+
+// checkTimeout bounds each probe made by minio-check.
+const checkTimeout = 10 * time.Second
+
+func init() {
+	caddycmd.RegisterCommand(caddycmd.Command{
+		Name:  "minio-check",
+		Usage: "[--config <path>] [--adapter <name>]",
+		Short: "Checks the MinIO and cache connections of a config",
+		Long: `
+Loads a config and checks, without starting Caddy, that everything the MinIO
+handlers depend on is in place: each MinIO endpoint they use (and its
+replicas) is reachable and accepts the configured credentials, each bucket
+they serve exists, and the cache backend answers.
+
+A line is printed per check. The exit status is non-zero if any failed, so
+the command can gate config rollouts in CI.
+`,
+		CobraFunc: func(cmd *cobra.Command) {
+			cmd.Flags().StringP("config", "c", "", "Configuration file to check (default ./Caddyfile)")
+			cmd.Flags().StringP("adapter", "a", "", "Name of config adapter to apply")
+			cmd.RunE = caddycmd.WrapCommandFuncForCobra(cmdCheck)
+		},
+	})
+}
+
+// checkReport prints the outcome of each check and remembers failures.
+type checkReport struct {
+	failed bool
+}
+
+func (c *checkReport) ok(format string, args ...any) {
+	fmt.Printf("OK    "+format+"\n", args...)
+}
+
+func (c *checkReport) fail(format string, args ...any) {
+	c.failed = true
+	fmt.Printf("FAIL  "+format+"\n", args...)
+}
+
+func (c *checkReport) skip(format string, args ...any) {
+	fmt.Printf("--    "+format+"\n", args...)
+}
+
+// checkTarget is an endpoint to check and the buckets served from it.
+type checkTarget struct {
+	name    string
+	ep      *MinioEndpoint
+	buckets []string
+}
+
+// cmdCheck checks the MinIO endpoints, buckets and cache of a config.
+func cmdCheck(fl caddycmd.Flags) (int, error) {
+	config, configFile, err := caddycmd.LoadConfig(fl.String("config"), fl.String("adapter"))
+	if err != nil {
+		return caddy.ExitCodeFailedStartup, err
+	}
+	if configFile == "" {
+		return caddy.ExitCodeFailedStartup, errors.New("no config file to check; use --config")
+	}
+	cfg, err := parseMinioConfig(config)
+	if err != nil {
+		return caddy.ExitCodeFailedStartup, err
+	}
+	handlers, err := findHandlers(config)
+	if err != nil {
+		return caddy.ExitCodeFailedStartup, err
+	}
+
+	report := new(checkReport)
+	targets, err := checkTargets(cfg, handlers)
+	if err != nil {
+		report.fail("%v", err)
+	}
+	for _, target := range targets {
+		checkEndpoint(report, target)
+	}
+	checkCache(report, cfg)
+
+	if report.failed {
+		return caddy.ExitCodeFailedStartup, errors.New("some checks failed")
+	}
+	return caddy.ExitCodeSuccess, nil
+}
+
+// findHandlers decodes every minio_static_html handler in a JSON config.
+func findHandlers(config []byte) ([]*MinioStaticHTML, error) {
+	var root any
+	if err := json.Unmarshal(config, &root); err != nil {
+		return nil, fmt.Errorf("decoding config: %v", err)
+	}
+	var handlers []*MinioStaticHTML
+	var walk func(v any) error
+	walk = func(v any) error {
+		switch v := v.(type) {
+		case map[string]any:
+			if v["handler"] == "minio_static_html" {
+				raw, err := json.Marshal(v)
+				if err != nil {
+					return err
+				}
+				h := new(MinioStaticHTML)
+				if err := json.Unmarshal(raw, h); err != nil {
+					return fmt.Errorf("decoding minio_static_html handler: %v", err)
+				}
+				handlers = append(handlers, h)
+				return nil
+			}
+			for _, child := range v {
+				if err := walk(child); err != nil {
+					return err
+				}
+			}
+		case []any:
+			for _, child := range v {
+				if err := walk(child); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	return handlers, walk(root)
+}
+
+// checkTargets groups the handlers' buckets by the endpoint serving them.
+// The default and named endpoints are checked even if no handler uses
+// them.
+func checkTargets(cfg *MinioConfig, handlers []*MinioStaticHTML) ([]*checkTarget, error) {
+	var targets []*checkTarget
+	add := func(name string, ep *MinioEndpoint, buckets []string) {
+		for _, target := range targets {
+			if endpointsEqual(target.ep, ep) {
+				for _, bucket := range buckets {
+					if !slices.Contains(target.buckets, bucket) {
+						target.buckets = append(target.buckets, bucket)
+					}
+				}
+				return
+			}
+		}
+		targets = append(targets, &checkTarget{name, ep, slices.Clone(buckets)})
+	}
+	if cfg.Endpoint != "" {
+		add("default endpoint", cfg.defaultEndpoint(), nil)
+	}
+	for _, name := range slices.Sorted(maps.Keys(cfg.Endpoints)) {
+		add(fmt.Sprintf("endpoint %q", name), cfg.Endpoints[name], nil)
+	}
+	var errs []error
+	for _, h := range handlers {
+		ep, err := h.resolveEndpoint(cfg)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("handler for bucket %q: %w", h.Bucket, err))
+			continue
+		}
+		add("handler endpoint", ep, h.staticBuckets())
+	}
+	return targets, errors.Join(errs...)
+}
+
+// endpointsEqual reports whether two endpoints connect to the same place
+// with the same credentials.
+func endpointsEqual(a, b *MinioEndpoint) bool {
+	x, errA := json.Marshal(a)
+	y, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(x) == string(y)
+}
+
+// checkEndpoint checks that each address of an endpoint is reachable and
+// accepts its credentials, and that the buckets served from it exist.
+// Without buckets to look for, listing the buckets proves the credentials.
+func checkEndpoint(report *checkReport, target *checkTarget) {
+	creds, err := target.ep.credentials()
+	if err != nil {
+		report.fail("%s: credentials: %v", target.name, err)
+		return
+	}
+	for _, addr := range target.ep.addresses() {
+		client, err := target.ep.newClient(addr, creds)
+		if err != nil {
+			report.fail("%s %s: %v", target.name, addr, err)
+			continue
+		}
+		if len(target.buckets) == 0 {
+			ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+			start := time.Now()
+			_, err := client.ListBuckets(ctx)
+			cancel()
+			if err != nil {
+				report.fail("%s %s: %s", target.name, addr, describeMinioError(err))
+			} else {
+				report.ok("%s %s (%s)", target.name, addr, time.Since(start).Round(time.Millisecond))
+			}
+			continue
+		}
+		for _, bucket := range target.buckets {
+			ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+			start := time.Now()
+			exists, err := client.BucketExists(ctx, bucket)
+			cancel()
+			switch {
+			case err != nil:
+				report.fail("%s %s, bucket %q: %s", target.name, addr, bucket, describeMinioError(err))
+			case !exists:
+				report.fail("%s %s, bucket %q: bucket does not exist", target.name, addr, bucket)
+			default:
+				report.ok("%s %s, bucket %q (%s)", target.name, addr, bucket, time.Since(start).Round(time.Millisecond))
+			}
+		}
+	}
+}
+
+// describeMinioError explains a failed MinIO probe.
+func describeMinioError(err error) string {
+	switch minio.ToErrorResponse(err).Code {
+	case "InvalidAccessKeyId", "SignatureDoesNotMatch", "AccessDenied", "ExpiredToken":
+		return "credentials rejected: " + err.Error()
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return "unreachable: " + err.Error()
+	}
+	return err.Error()
+}
+
+// checkCache checks that the configured cache backend answers a ping.
+func checkCache(report *checkReport, cfg *MinioConfig) {
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	defer cancel()
+	m := &MinioConfigModule{MinioConfig: cfg}
+	if err := m.provisionCache(ctx); err != nil {
+		report.fail("cache: %v", err)
+		return
+	}
+	if m.cache == nil {
+		report.skip("cache: not configured")
+		return
+	}
+	defer m.Cleanup()
+
+	pingCtx, cancelPing := context.WithTimeout(ctx, checkTimeout)
+	defer cancelPing()
+	start := time.Now()
+	if err := m.cache.Ping(pingCtx); err != nil {
+		report.fail("cache %s: %v", m.cacheName(), err)
+		return
+	}
+	report.ok("cache %s (%s)", m.cacheName(), time.Since(start).Round(time.Millisecond))
+}
@@ -0,0 +1,171 @@
+package miniohandler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// defaultMaxChunkedSize caps the objects cached in chunks when
+// max_chunked_size is not configured.
+const defaultMaxChunkedSize = 512 << 20 // 512 MB
+
+// chunkKey returns the key holding chunk i of a chunked cache entry.
+func chunkKey(cacheKey string, i int) string {
+	return fmt.Sprintf("%s:chunk:%d", cacheKey, i)
+}
+
+// chunkKeys returns the keys of every chunk belonging to obj.
+func chunkKeys(cacheKey string, obj *CachedObject) []string {
+	keys := make([]string, obj.Chunks)
+	for i := range keys {
+		keys[i] = chunkKey(cacheKey, i)
+	}
+	return keys
+}
+
+// storeChunked splits content into fixed-size chunks and writes them to
+// the cache alongside a metadata entry under cacheKey. Each chunk is
+// compressed on its own if obj.Encoding is set, keeping chunks
+// independently readable. Everything is written in one Set so that, with
+// backends that write atomically, readers never observe metadata without
+// chunks.
+func (h *MinioStaticHTML) storeChunked(ctx context.Context, cacheKey string, obj CachedObject, ttl time.Duration) error {
+	chunkSize := int64(1024 * 1024) // default 1 MB
+	if h.GlobalConfig.ChunkSize > 0 {
+		chunkSize = h.GlobalConfig.ChunkSize
+	}
+
+	content := obj.Content
+	size := int64(len(content))
+	obj.ChunkSize = chunkSize
+	obj.Chunks = int((size + chunkSize - 1) / chunkSize)
+	obj.Content = nil
+
+	meta, err := json.Marshal(obj)
+	if err != nil {
+		return fmt.Errorf("marshaling chunk metadata: %w", err)
+	}
+
+	items := make([]CacheItem, 0, obj.Chunks+1)
+	for i := 0; i < obj.Chunks; i++ {
+		start := int64(i) * chunkSize
+		end := min(start+chunkSize, size)
+		chunk, err := compressPayload(obj.Encoding, content[start:end])
+		if err != nil {
+			return err
+		}
+		items = append(items, CacheItem{chunkKey(cacheKey, i), chunk})
+	}
+	items = append(items, CacheItem{cacheKey, meta})
+	return h.cache.Set(ctx, ttl, items...)
+}
+
+// chunksPresent reports whether every chunk of obj is still in the cache.
+// Chunks may be evicted independently of the metadata key, and discovering
+// that halfway through a response would leave the client with a truncated
+// body. With prefetch the first chunk is also returned.
+func (h *MinioStaticHTML) chunksPresent(ctx context.Context, cacheKey string, obj *CachedObject, prefetch bool) ([]byte, bool) {
+	n, err := h.cache.Exists(ctx, chunkKeys(cacheKey, obj)...)
+	if err != nil {
+		h.logger.Error("dragonflyDB EXISTS error", zap.String("key", cacheKey), zap.Error(err))
+		h.observeRedisError("exists")
+		return nil, false
+	}
+	if n != int64(obj.Chunks) || !prefetch {
+		return nil, n == int64(obj.Chunks)
+	}
+	first, err := getOne(ctx, h.cache, chunkKey(cacheKey, 0))
+	if err != nil {
+		// The reader fetches it again when needed.
+		return nil, true
+	}
+	return first, true
+}
+
+// newChunkReader returns a reader over the chunks of a cached object.
+func (h *MinioStaticHTML) newChunkReader(ctx context.Context, cacheKey string, obj *CachedObject) *chunkReader {
+	return &chunkReader{
+		ctx:       ctx,
+		cache:     h.cache,
+		cacheKey:  cacheKey,
+		size:      obj.Size,
+		chunkSize: obj.ChunkSize,
+		encoding:  obj.Encoding,
+		cur:       -1,
+	}
+}
+
+// chunkReader is an io.ReadSeeker over an object cached in chunks. Chunks
+// are fetched lazily as the read offset reaches them, so http.ServeContent
+// only pulls the chunks that overlap a requested Range.
+type chunkReader struct {
+	ctx       context.Context
+	cache     CacheBackend
+	cacheKey  string
+	size      int64
+	chunkSize int64
+	encoding  string
+	offset    int64
+
+	cur int    // index of the chunk currently held in buf, or -1
+	buf []byte // contents of chunk cur
+}
+
+// prime loads the first chunk from data already read from Redis.
+func (c *chunkReader) prime(data []byte) error {
+	data, err := decompressPayload(c.encoding, data)
+	if err != nil {
+		return err
+	}
+	c.cur, c.buf = 0, data
+	return nil
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	if c.offset >= c.size {
+		return 0, io.EOF
+	}
+	idx := int(c.offset / c.chunkSize)
+	if idx != c.cur {
+		data, err := getOne(c.ctx, c.cache, chunkKey(c.cacheKey, idx))
+		if err != nil {
+			return 0, fmt.Errorf("fetching chunk %d of %s: %w", idx, c.cacheKey, err)
+		}
+		if data, err = decompressPayload(c.encoding, data); err != nil {
+			return 0, fmt.Errorf("decompressing chunk %d of %s: %w", idx, c.cacheKey, err)
+		}
+		c.cur, c.buf = idx, data
+	}
+	start := c.offset - int64(idx)*c.chunkSize
+	if start >= int64(len(c.buf)) {
+		return 0, io.ErrUnexpectedEOF
+	}
+	n := copy(p, c.buf[start:])
+	c.offset += int64(n)
+	return n, nil
+}
+
+func (c *chunkReader) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = c.offset + offset
+	case io.SeekEnd:
+		abs = c.size + offset
+	default:
+		return 0, errors.New("chunkReader.Seek: invalid whence")
+	}
+	if abs < 0 {
+		return 0, errors.New("chunkReader.Seek: negative position")
+	}
+	c.offset = abs
+	return abs, nil
+}
@@ -0,0 +1,130 @@
+package miniohandler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2"
+	caddycmd "github.com/caddyserver/caddy/v2/cmd"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	caddycmd.RegisterCommand(caddycmd.Command{
+		Name:  "minio-cache",
+		Usage: "purge|stats [--config <path>] [--address <interface>]",
+		Short: "Purges and inspects the MinIO handler's cache",
+		Long: `
+Manages the cache of the running Caddy instance through its admin API, as the
+/minio_static_html/cache/ endpoints do.
+
+The admin endpoint is taken from the --address flag if specified; otherwise
+from the config file given with --config (and --adapter); otherwise the
+default is assumed.
+`,
+		CobraFunc: func(cmd *cobra.Command) {
+			purgeCmd := &cobra.Command{
+				Use:   "purge --bucket <name> [--key <key> | --prefix <prefix>] [--soft] | --tag <tag>",
+				Short: "Purges cache entries",
+				Long: `
+Deletes cached objects: a single --key, every key under --prefix, or the whole
+bucket if neither is given. --soft marks a key's entry stale instead, to be
+revalidated with MinIO. --tag alone purges every entry with that surrogate key.
+Leading slashes are ignored, so --prefix /blog/ purges the objects under blog/.
+`,
+				RunE: caddycmd.WrapCommandFuncForCobra(cmdPurgeCache),
+			}
+			purgeCmd.Flags().StringP("bucket", "b", "", "Bucket whose entries to purge")
+			purgeCmd.Flags().StringP("key", "k", "", "Object key to purge")
+			purgeCmd.Flags().StringP("prefix", "p", "", "Object key prefix to purge")
+			purgeCmd.Flags().Bool("soft", false, "Mark the key's entry stale instead of deleting it")
+			purgeCmd.Flags().StringP("tag", "t", "", "Surrogate key whose entries to purge")
+			cmd.AddCommand(purgeCmd)
+
+			statsCmd := &cobra.Command{
+				Use:   "stats",
+				Short: "Prints cache statistics",
+				Long: `
+Prints the cache statistics reported by the running instance as JSON.
+`,
+				RunE: caddycmd.WrapCommandFuncForCobra(cmdCacheStats),
+			}
+			cmd.AddCommand(statsCmd)
+
+			cmd.PersistentFlags().StringP("config", "c", "", "Configuration file to find the admin address in")
+			cmd.PersistentFlags().StringP("adapter", "a", "", "Name of config adapter to apply")
+			cmd.PersistentFlags().StringP("address", "", "", "Address of the administration listener, if different from config")
+		},
+	})
+}
+
+// cmdPurgeCache asks the running instance to purge cache entries.
+func cmdPurgeCache(fl caddycmd.Flags) (int, error) {
+	req := purgeRequest{
+		Bucket:    fl.String("bucket"),
+		Key:       strings.TrimPrefix(fl.String("key"), "/"),
+		KeyPrefix: strings.TrimPrefix(fl.String("prefix"), "/"),
+		Soft:      fl.Bool("soft"),
+		Tag:       fl.String("tag"),
+	}
+	if req.Bucket == "" && req.Tag == "" {
+		return caddy.ExitCodeFailedStartup, errors.New("--bucket or --tag is required")
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return caddy.ExitCodeFailedStartup, err
+	}
+	resp, err := cacheAdminRequest(fl, http.MethodPost, "cache/purge", bytes.NewReader(body))
+	if err != nil {
+		return caddy.ExitCodeFailedStartup, err
+	}
+	var result map[string]int64
+	if err := json.Unmarshal(resp, &result); err != nil {
+		return caddy.ExitCodeFailedStartup, fmt.Errorf("decoding response: %v", err)
+	}
+	if n, ok := result["marked_stale"]; ok {
+		fmt.Printf("marked %d entries stale\n", n)
+	} else {
+		fmt.Printf("deleted %d keys\n", result["deleted"])
+	}
+	return caddy.ExitCodeSuccess, nil
+}
+
+// cmdCacheStats prints the running instance's cache statistics.
+func cmdCacheStats(fl caddycmd.Flags) (int, error) {
+	resp, err := cacheAdminRequest(fl, http.MethodGet, "cache/stats", nil)
+	if err != nil {
+		return caddy.ExitCodeFailedStartup, err
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, resp, "", "  "); err != nil {
+		return caddy.ExitCodeFailedStartup, fmt.Errorf("decoding response: %v", err)
+	}
+	out.WriteByte('\n')
+	if _, err := out.WriteTo(os.Stdout); err != nil {
+		return caddy.ExitCodeFailedStartup, err
+	}
+	return caddy.ExitCodeSuccess, nil
+}
+
+// cacheAdminRequest calls one of this module's admin API endpoints on the
+// running instance, found from the --address or --config flags, and
+// returns the response body.
+func cacheAdminRequest(fl caddycmd.Flags, method, path string, body io.Reader) ([]byte, error) {
+	adminAddr, err := caddycmd.DetermineAdminAPIAddress(fl.String("address"), nil, fl.String("config"), fl.String("adapter"))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't determine admin API address: %v", err)
+	}
+	resp, err := caddycmd.AdminAPIRequest(adminAddr, method, adminBasePath+path, nil, body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
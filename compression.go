@@ -0,0 +1,107 @@
+package miniohandler
+
+import (
+	"fmt"
+	"mime"
+	"strings"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Supported values for MinioConfig.CacheCompression.
+const (
+	compressionNone   = ""
+	compressionZstd   = "zstd"
+	compressionSnappy = "snappy"
+)
+
+// defaultCompressTypes lists the media type prefixes compressed when
+// compress_types is not configured. Already-compressed formats such as
+// images and archives gain nothing and are left alone.
+var defaultCompressTypes = []string{
+	"text/",
+	"application/javascript",
+	"application/json",
+	"application/xml",
+	"image/svg+xml",
+}
+
+// The zstd encoder and decoder are safe for concurrent use through
+// EncodeAll and DecodeAll, so one of each is shared by every handler.
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+// validCompression reports whether alg names a supported algorithm.
+func validCompression(alg string) bool {
+	switch alg {
+	case compressionNone, compressionZstd, compressionSnappy:
+		return true
+	}
+	return false
+}
+
+// cacheEncoding returns the algorithm to compress an object with before it
+// is written to the cache, or "" if it should be stored as-is.
+func (h *MinioStaticHTML) cacheEncoding(contentType string, size int64) string {
+	cfg := h.GlobalConfig
+	if cfg.CacheCompression == compressionNone || !cfg.compressible(contentType, size) {
+		return compressionNone
+	}
+	return cfg.CacheCompression
+}
+
+// compressible reports whether content of this type and size is worth
+// compressing, according to compress_types and compress_min_size.
+func (cfg *MinioConfig) compressible(contentType string, size int64) bool {
+	minSize := int64(1024) // default 1 KB
+	if cfg.CompressMinSize > 0 {
+		minSize = cfg.CompressMinSize
+	}
+	if size < minSize {
+		return false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	types := cfg.CompressTypes
+	if len(types) == 0 {
+		types = defaultCompressTypes
+	}
+	for _, prefix := range types {
+		if strings.HasPrefix(mediaType, strings.ToLower(prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// compressPayload compresses b with alg.
+func compressPayload(alg string, b []byte) ([]byte, error) {
+	switch alg {
+	case compressionNone:
+		return b, nil
+	case compressionZstd:
+		return zstdEncoder.EncodeAll(b, nil), nil
+	case compressionSnappy:
+		return snappy.Encode(nil, b), nil
+	}
+	return nil, fmt.Errorf("unknown cache compression %q", alg)
+}
+
+// decompressPayload reverses compressPayload.
+func decompressPayload(alg string, b []byte) ([]byte, error) {
+	switch alg {
+	case compressionNone:
+		return b, nil
+	case compressionZstd:
+		return zstdDecoder.DecodeAll(b, nil)
+	case compressionSnappy:
+		return snappy.Decode(nil, b)
+	}
+	return nil, fmt.Errorf("unknown cache compression %q", alg)
+}
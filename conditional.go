@@ -0,0 +1,38 @@
+package miniohandler
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// setConditions forwards the client's revalidation headers to MinIO, so an
+// unchanged object is answered with 304 by MinIO itself instead of being
+// transferred into Caddy only to be discarded. As in RFC 9110,
+// If-Modified-Since is ignored when If-None-Match is present.
+func setConditions(r *http.Request, opts *minio.GetObjectOptions) {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if strings.Contains(inm, ",") || inm == "*" {
+			opts.Set("If-None-Match", inm)
+			return
+		}
+		// Our ETag header is unquoted; accept it either way.
+		etag := strings.Trim(strings.TrimPrefix(inm, "W/"), `"`)
+		if etag != "" {
+			_ = opts.SetMatchETagExcept(etag)
+		}
+		return
+	}
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" {
+		if t, err := http.ParseTime(ims); err == nil {
+			_ = opts.SetModified(t)
+		}
+	}
+}
+
+// isNotModified reports whether err is MinIO answering a conditional
+// request with 304 Not Modified.
+func isNotModified(err error) bool {
+	return minio.ToErrorResponse(err).StatusCode == http.StatusNotModified
+}
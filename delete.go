@@ -0,0 +1,55 @@
+package miniohandler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/minio/minio-go/v7"
+	"go.uber.org/zap"
+)
+
+// serveDelete removes the object a DELETE request names and purges its
+// cached copy, when allow_delete is enabled, reporting false, having
+// written nothing, for other methods. Like uploads, deletes are not
+// authenticated here.
+func (h *MinioStaticHTML) serveDelete(w http.ResponseWriter, r *http.Request, bucket, objectKey string) (bool, error) {
+	if !h.AllowDelete || h.HtmlFile != "" || r.Method != http.MethodDelete {
+		return false, nil
+	}
+	if strings.HasSuffix(r.URL.Path, "/") {
+		return true, caddyhttp.Error(http.StatusBadRequest, errors.New("directories cannot be deleted"))
+	}
+
+	// RemoveObject succeeds for missing keys, so they are looked for
+	// first to answer with 404.
+	_, err := h.client.StatObject(r.Context(), bucket, objectKey, minio.StatObjectOptions{ServerSideEncryption: h.sse})
+	if code := minio.ToErrorResponse(err).Code; code == "NoSuchKey" {
+		return true, caddyhttp.Error(http.StatusNotFound, fmt.Errorf("no object %q", objectKey))
+	} else if err != nil {
+		return true, caddyhttp.Error(http.StatusBadGateway, fmt.Errorf("stat object: %w", err))
+	}
+	if err := h.client.RemoveObject(r.Context(), bucket, objectKey, minio.RemoveObjectOptions{}); err != nil {
+		return true, caddyhttp.Error(http.StatusBadGateway, fmt.Errorf("removing object: %w", err))
+	}
+
+	if h.cache != nil {
+		n, err := h.GlobalConfig.purgeObject(r.Context(), bucket, objectKey)
+		if err != nil {
+			h.logger.Error("failed to purge deleted object from cache",
+				zap.String("bucket", bucket),
+				zap.String("key", objectKey),
+				zap.Error(err))
+		} else {
+			h.events.emitPurged("delete", n, map[string]any{"bucket": bucket, "key": objectKey})
+		}
+	}
+	h.logger.Info("deleted object",
+		zap.String("bucket", bucket),
+		zap.String("key", objectKey))
+
+	w.WriteHeader(http.StatusNoContent)
+	return true, nil
+}
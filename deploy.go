@@ -0,0 +1,300 @@
+package miniohandler
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/caddyserver/caddy/v2"
+	caddycmd "github.com/caddyserver/caddy/v2/cmd"
+	"github.com/minio/minio-go/v7"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	caddycmd.RegisterCommand(caddycmd.Command{
+		Name:  "minio-deploy",
+		Usage: "<dir> --bucket <name> [--prefix <key prefix>] [--gzip] [--cache-control <value>] [--immutable <regexp>] [--config <path>]",
+		Short: "Uploads a directory to a bucket and purges the changed objects",
+		Long: `
+Uploads every file under <dir> to the bucket, under --prefix if given, then
+purges the cache entries of the objects that changed through the running
+instance's admin API.
+
+The MinIO endpoint and credentials are those of the minio.config app in the
+config file given with --config (and --adapter), or the named endpoint chosen
+with --endpoint-name. Files whose content matches the uploaded object's ETag
+are skipped unless --force is given.
+
+Each object gets a Content-Type from its extension, or its content if the
+extension is unknown. --cache-control sets its Cache-Control metadata, except
+for files whose path matches the --immutable regular expression, such as
+'\.[0-9a-f]{8,}\.(js|css)$', which are sent as cacheable for a year. With
+--gzip, compressible files (per compress_types and compress_min_size) also get
+a <key>.gz sidecar for the handler's precompressed option.
+
+If the config enables cache_generations, the bucket starts a new generation
+instead of purging each object. --purge=false skips purging altogether.
+`,
+		CobraFunc: func(cmd *cobra.Command) {
+			cmd.Args = cobra.ExactArgs(1)
+			cmd.Flags().StringP("bucket", "b", "", "Bucket to upload to (required)")
+			cmd.Flags().StringP("prefix", "p", "", "Key prefix to upload under")
+			cmd.Flags().StringP("config", "c", "", "Configuration file with the minio.config app (default ./Caddyfile)")
+			cmd.Flags().StringP("adapter", "a", "", "Name of config adapter to apply")
+			cmd.Flags().StringP("address", "", "", "Address of the administration listener, if different from config")
+			cmd.Flags().String("endpoint-name", "", "Named endpoint to upload to instead of the default one")
+			cmd.Flags().String("cache-control", "", "Cache-Control metadata for uploaded objects")
+			cmd.Flags().String("immutable", "", "Regular expression matching paths of fingerprinted files")
+			cmd.Flags().Bool("gzip", false, "Upload gzip sidecars of compressible files")
+			cmd.Flags().Bool("force", false, "Upload files even if they are unchanged")
+			cmd.Flags().Bool("purge", true, "Purge the cache entries of changed objects")
+			cmd.Flags().IntP("jobs", "j", 4, "Number of files uploaded at once")
+			cmd.RunE = caddycmd.WrapCommandFuncForCobra(cmdDeploy)
+		},
+	})
+}
+
+// deployer uploads a directory to a bucket.
+type deployer struct {
+	cfg          *MinioConfig
+	client       *minio.Client
+	bucket       string
+	prefix       string
+	cacheControl string
+	immutable    *regexp.Regexp
+	gzip         bool
+	force        bool
+
+	mu      sync.Mutex
+	changed []string
+	errs    []error
+}
+
+// cmdDeploy uploads a directory and purges the objects that changed.
+func cmdDeploy(fl caddycmd.Flags) (int, error) {
+	dir := fl.Arg(0)
+	d := &deployer{
+		bucket:       fl.String("bucket"),
+		prefix:       strings.TrimPrefix(fl.String("prefix"), "/"),
+		cacheControl: fl.String("cache-control"),
+		gzip:         fl.Bool("gzip"),
+		force:        fl.Bool("force"),
+	}
+	if d.bucket == "" {
+		return caddy.ExitCodeFailedStartup, errors.New("--bucket is required")
+	}
+	if d.prefix != "" && !strings.HasSuffix(d.prefix, "/") {
+		d.prefix += "/"
+	}
+	if expr := fl.String("immutable"); expr != "" {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return caddy.ExitCodeFailedStartup, fmt.Errorf("invalid --immutable: %v", err)
+		}
+		d.immutable = re
+	}
+	jobs := fl.Int("jobs")
+	if jobs < 1 {
+		return caddy.ExitCodeFailedStartup, errors.New("--jobs must be positive")
+	}
+
+	config, _, err := caddycmd.LoadConfig(fl.String("config"), fl.String("adapter"))
+	if err != nil {
+		return caddy.ExitCodeFailedStartup, err
+	}
+	cfg, err := parseMinioConfig(config)
+	if err != nil {
+		return caddy.ExitCodeFailedStartup, err
+	}
+	d.cfg = cfg
+	ep, err := cfg.endpoint(fl.String("endpoint-name"))
+	if err != nil {
+		return caddy.ExitCodeFailedStartup, err
+	}
+	creds, err := ep.credentials()
+	if err != nil {
+		return caddy.ExitCodeFailedStartup, fmt.Errorf("initializing MinIO credentials: %v", err)
+	}
+	d.client, err = ep.newClient(ep.Endpoint, creds)
+	if err != nil {
+		return caddy.ExitCodeFailedStartup, fmt.Errorf("initializing MinIO client: %v", err)
+	}
+
+	var files []string
+	err = filepath.WalkDir(dir, func(p string, entry fs.DirEntry, err error) error {
+		if err == nil && entry.Type().IsRegular() {
+			files = append(files, p)
+		}
+		return err
+	})
+	if err != nil {
+		return caddy.ExitCodeFailedStartup, err
+	}
+
+	ctx := context.Background()
+	sem := make(chan struct{}, jobs)
+	var wg sync.WaitGroup
+	for _, file := range files {
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return caddy.ExitCodeFailedStartup, err
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			d.upload(ctx, file, filepath.ToSlash(rel))
+		}()
+	}
+	wg.Wait()
+	fmt.Printf("uploaded %d of %d files to %s\n", len(d.changed), len(files), d.bucket)
+	if err := errors.Join(d.errs...); err != nil {
+		return caddy.ExitCodeFailedStartup, err
+	}
+
+	if !fl.Bool("purge") || len(d.changed) == 0 {
+		return caddy.ExitCodeSuccess, nil
+	}
+	if err := d.purge(fl); err != nil {
+		return caddy.ExitCodeFailedStartup, fmt.Errorf("files were uploaded, but purging the cache failed: %v", err)
+	}
+	return caddy.ExitCodeSuccess, nil
+}
+
+// parseMinioConfig decodes the minio.config app of a JSON config.
+func parseMinioConfig(config []byte) (*MinioConfig, error) {
+	var parsed struct {
+		Apps map[string]json.RawMessage `json:"apps"`
+	}
+	if err := json.Unmarshal(config, &parsed); err != nil {
+		return nil, fmt.Errorf("decoding config: %v", err)
+	}
+	raw, ok := parsed.Apps["minio.config"]
+	if !ok {
+		return nil, errors.New("the config has no minio.config app; use --config to name one that does")
+	}
+	cfg := new(MinioConfig)
+	if err := json.Unmarshal(raw, cfg); err != nil {
+		return nil, fmt.Errorf("decoding minio.config: %v", err)
+	}
+	return cfg, nil
+}
+
+// upload puts one file in the bucket, with its gzip sidecar if enabled,
+// unless the object is unchanged.
+func (d *deployer) upload(ctx context.Context, file, rel string) {
+	key := d.prefix + rel
+	data, err := os.ReadFile(file)
+	if err != nil {
+		d.fail(err)
+		return
+	}
+	sum := md5.Sum(data)
+	if !d.force {
+		info, err := d.client.StatObject(ctx, d.bucket, key, minio.StatObjectOptions{})
+		if err == nil && strings.Trim(info.ETag, `"`) == hex.EncodeToString(sum[:]) {
+			return
+		}
+	}
+
+	contentType := mime.TypeByExtension(strings.ToLower(path.Ext(key)))
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+	opts := minio.PutObjectOptions{
+		ContentType:  contentType,
+		CacheControl: d.cacheControl,
+	}
+	if d.immutable != nil && d.immutable.MatchString(rel) {
+		opts.CacheControl = immutableCacheControl
+	}
+	if _, err := d.client.PutObject(ctx, d.bucket, key, bytes.NewReader(data), int64(len(data)), opts); err != nil {
+		d.fail(fmt.Errorf("uploading %s: %w", key, err))
+		return
+	}
+
+	if d.gzip && path.Ext(key) != ".gz" && d.cfg.compressible(contentType, int64(len(data))) {
+		compressed, err := encodeBody("gzip", data)
+		if err != nil {
+			d.fail(fmt.Errorf("compressing %s: %w", key, err))
+			return
+		}
+		opts.ContentEncoding = "gzip"
+		sidecar := key + precompressedExts["gzip"]
+		if _, err := d.client.PutObject(ctx, d.bucket, sidecar, bytes.NewReader(compressed), int64(len(compressed)), opts); err != nil {
+			d.fail(fmt.Errorf("uploading %s: %w", sidecar, err))
+			return
+		}
+	}
+
+	fmt.Println("uploaded", key)
+	d.mu.Lock()
+	d.changed = append(d.changed, key)
+	d.mu.Unlock()
+}
+
+// fail records an upload error.
+func (d *deployer) fail(err error) {
+	d.mu.Lock()
+	d.errs = append(d.errs, err)
+	d.mu.Unlock()
+}
+
+// purge invalidates the cache entries of the changed objects through the
+// admin API: the whole bucket at once with cache_generations, otherwise
+// one object at a time. Purging an object drops its encoded variants, so
+// sidecars need no purge of their own.
+func (d *deployer) purge(fl caddycmd.Flags) error {
+	if d.cfg.CacheGenerations {
+		body, err := json.Marshal(generationRequest{Bucket: d.bucket})
+		if err != nil {
+			return err
+		}
+		resp, err := cacheAdminRequest(fl, http.MethodPost, "cache/generation", bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		var result map[string]string
+		if err := json.Unmarshal(resp, &result); err != nil {
+			return fmt.Errorf("decoding response: %v", err)
+		}
+		fmt.Printf("started cache generation %s for %s\n", result["generation"], d.bucket)
+		return nil
+	}
+
+	var deleted int64
+	for _, key := range d.changed {
+		body, err := json.Marshal(purgeRequest{Bucket: d.bucket, Key: key})
+		if err != nil {
+			return err
+		}
+		resp, err := cacheAdminRequest(fl, http.MethodPost, "cache/purge", bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		var result map[string]int64
+		if err := json.Unmarshal(resp, &result); err != nil {
+			return fmt.Errorf("decoding response: %v", err)
+		}
+		deleted += result["deleted"]
+	}
+	fmt.Printf("purged %d cache keys\n", deleted)
+	return nil
+}
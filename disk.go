@@ -0,0 +1,408 @@
+package miniohandler
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+)
+
+func init() {
+	caddy.RegisterModule(new(DiskBackend))
+}
+
+// defaultDiskCacheSize is the limit used when max_size is not configured.
+const defaultDiskCacheSize = 1 << 30 // 1 GB
+
+// diskHeaderSize is the length of the header at the start of every cache
+// file: the expiry in Unix nanoseconds (zero for none) and the length of
+// the key, which follows it before the value.
+const diskHeaderSize = 8 + 4
+
+// DiskBackend caches entries as files in a local directory, evicting the
+// least recently used once they take up more than MaxSize bytes. It suits
+// single-node deployments without DragonflyDB, or objects too large to
+// keep in memory, on its own or beneath Redis in a tiered backend.
+//
+// The index of cached keys is kept in memory and rebuilt from the
+// directory at startup, so entries survive restarts.
+type DiskBackend struct {
+	// Directory to keep cache files in. Default: "minio_cache" in Caddy's
+	// data directory. May contain placeholders such as {env.CACHE_DIR}.
+	Directory string `json:"directory,omitempty"`
+
+	// Total size of the cache files in bytes. Default: 1 GB.
+	MaxSize int64 `json:"max_size,omitempty"`
+
+	logger *zap.Logger
+
+	mu    sync.Mutex
+	index map[string]*list.Element // values are *diskEntry
+	lru   *list.List               // most recently used first
+	size  int64
+}
+
+// diskEntry is the in-memory record of a cache file.
+type diskEntry struct {
+	key     string
+	size    int64
+	expires time.Time // zero if the entry never expires
+}
+
+// CaddyModule returns the Caddy module information for the backend.
+func (*DiskBackend) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "minio_static_html.cache.disk",
+		New: func() caddy.Module { return new(DiskBackend) },
+	}
+}
+
+// Provision creates the cache directory and indexes the files already in
+// it.
+func (d *DiskBackend) Provision(ctx caddy.Context) error {
+	d.logger = ctx.Logger()
+	d.Directory = caddy.NewReplacer().ReplaceAll(d.Directory, "")
+	if d.Directory == "" {
+		d.Directory = filepath.Join(caddy.AppDataDir(), "minio_cache")
+	}
+	if d.MaxSize == 0 {
+		d.MaxSize = defaultDiskCacheSize
+	}
+	if err := os.MkdirAll(d.Directory, 0o700); err != nil {
+		return fmt.Errorf("creating disk cache directory: %w", err)
+	}
+	d.index = make(map[string]*list.Element)
+	d.lru = list.New()
+	return d.load()
+}
+
+// Validate checks the size limit.
+func (d *DiskBackend) Validate() error {
+	if d.MaxSize < 0 {
+		return fmt.Errorf("max_size must not be negative")
+	}
+	return nil
+}
+
+// String describes the backend for log messages.
+func (d *DiskBackend) String() string {
+	return "disk " + d.Directory
+}
+
+// load indexes the cache files left by a previous run, removing expired,
+// unreadable and temporary ones. Files written most recently are treated
+// as most recently used.
+func (d *DiskBackend) load() error {
+	type found struct {
+		entry   *diskEntry
+		modTime time.Time
+	}
+	var files []found
+	now := time.Now()
+	err := filepath.WalkDir(d.Directory, func(path string, de fs.DirEntry, err error) error {
+		if err != nil || de.IsDir() {
+			return err
+		}
+		if strings.HasPrefix(de.Name(), ".tmp") {
+			os.Remove(path)
+			return nil
+		}
+		info, err := de.Info()
+		if err != nil {
+			return nil
+		}
+		entry, err := readDiskHeader(path)
+		if err != nil || entry.expired(now) || d.path(entry.key) != path {
+			os.Remove(path)
+			return nil
+		}
+		entry.size = info.Size()
+		files = append(files, found{entry, info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("loading disk cache: %w", err)
+	}
+
+	slices.SortFunc(files, func(a, b found) int { return a.modTime.Compare(b.modTime) })
+	d.mu.Lock()
+	for _, f := range files {
+		d.index[f.entry.key] = d.lru.PushFront(f.entry)
+		d.size += f.entry.size
+	}
+	d.evict()
+	d.mu.Unlock()
+
+	d.logger.Info("loaded disk cache",
+		zap.String("directory", d.Directory),
+		zap.Int("entries", len(files)),
+		zap.Int64("size_bytes", d.size))
+	return nil
+}
+
+// path returns the file key is stored in, spread over 256 subdirectories.
+func (d *DiskBackend) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(d.Directory, name[:2], name)
+}
+
+// expired reports whether the entry has expired at now.
+func (e *diskEntry) expired(now time.Time) bool {
+	return !e.expires.IsZero() && now.After(e.expires)
+}
+
+// readDiskHeader reads the expiry and key of a cache file.
+func readDiskHeader(path string) (*diskEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var header [diskHeaderSize]byte
+	if _, err := io.ReadFull(f, header[:]); err != nil {
+		return nil, err
+	}
+	key := make([]byte, binary.BigEndian.Uint32(header[8:]))
+	if _, err := io.ReadFull(f, key); err != nil {
+		return nil, err
+	}
+	entry := &diskEntry{key: string(key)}
+	if ns := int64(binary.BigEndian.Uint64(header[:8])); ns != 0 {
+		entry.expires = time.Unix(0, ns)
+	}
+	return entry, nil
+}
+
+// lookup returns the live entry for key, marking it as recently used, or
+// nil. Expired entries are removed. d.mu must be held.
+func (d *DiskBackend) lookup(key string, now time.Time) *diskEntry {
+	el, ok := d.index[key]
+	if !ok {
+		return nil
+	}
+	entry := el.Value.(*diskEntry)
+	if entry.expired(now) {
+		d.remove(el)
+		return nil
+	}
+	d.lru.MoveToFront(el)
+	return entry
+}
+
+// remove drops an entry and its file. d.mu must be held.
+func (d *DiskBackend) remove(el *list.Element) {
+	entry := d.lru.Remove(el).(*diskEntry)
+	delete(d.index, entry.key)
+	d.size -= entry.size
+	if err := os.Remove(d.path(entry.key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		d.logger.Warn("failed to remove disk cache file", zap.String("key", entry.key), zap.Error(err))
+	}
+}
+
+// evict removes the least recently used entries until the cache fits in
+// MaxSize. d.mu must be held.
+func (d *DiskBackend) evict() {
+	for d.size > d.MaxSize && d.lru.Len() > 0 {
+		d.remove(d.lru.Back())
+	}
+}
+
+// Get reads the values of keys from their files.
+func (d *DiskBackend) Get(_ context.Context, keys ...string) ([][]byte, error) {
+	values := make([][]byte, len(keys))
+	now := time.Now()
+	for i, key := range keys {
+		d.mu.Lock()
+		entry := d.lookup(key, now)
+		d.mu.Unlock()
+		if entry == nil {
+			continue
+		}
+		data, err := os.ReadFile(d.path(key))
+		if errors.Is(err, fs.ErrNotExist) {
+			// Evicted since the lookup.
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		offset := diskHeaderSize + len(key)
+		if len(data) < offset {
+			continue
+		}
+		values[i] = data[offset:]
+	}
+	return values, nil
+}
+
+// Set writes each item to a temporary file and renames it into place, so
+// readers never see a partly written file.
+func (d *DiskBackend) Set(_ context.Context, ttl time.Duration, items ...CacheItem) error {
+	var expires time.Time
+	if ttl > 0 {
+		expires = time.Now().Add(ttl)
+	}
+	for _, item := range items {
+		if err := d.write(item, expires); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write stores a single item.
+func (d *DiskBackend) write(item CacheItem, expires time.Time) error {
+	path := d.path(item.Key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	var header [diskHeaderSize]byte
+	if !expires.IsZero() {
+		binary.BigEndian.PutUint64(header[:8], uint64(expires.UnixNano()))
+	}
+	binary.BigEndian.PutUint32(header[8:], uint32(len(item.Key)))
+	_, err = tmp.Write(header[:])
+	if err == nil {
+		_, err = io.WriteString(tmp, item.Key)
+	}
+	if err == nil {
+		_, err = tmp.Write(item.Value)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	entry := &diskEntry{
+		key:     item.Key,
+		size:    int64(diskHeaderSize + len(item.Key) + len(item.Value)),
+		expires: expires,
+	}
+	if el, ok := d.index[item.Key]; ok {
+		d.size -= el.Value.(*diskEntry).size
+		el.Value = entry
+		d.lru.MoveToFront(el)
+	} else {
+		d.index[item.Key] = d.lru.PushFront(entry)
+	}
+	d.size += entry.size
+	d.evict()
+	return nil
+}
+
+// Expire rewrites the expiry in the header of each existing key's file.
+func (d *DiskBackend) Expire(_ context.Context, ttl time.Duration, keys ...string) error {
+	expires := time.Now().Add(ttl)
+	var header [8]byte
+	binary.BigEndian.PutUint64(header[:], uint64(expires.UnixNano()))
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	for _, key := range keys {
+		entry := d.lookup(key, now)
+		if entry == nil {
+			continue
+		}
+		f, err := os.OpenFile(d.path(key), os.O_WRONLY, 0)
+		if err != nil {
+			return err
+		}
+		_, err = f.WriteAt(header[:], 0)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+		entry.expires = expires
+	}
+	return nil
+}
+
+// Exists counts the live keys.
+func (d *DiskBackend) Exists(_ context.Context, keys ...string) (int64, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var n int64
+	now := time.Now()
+	for _, key := range keys {
+		if d.lookup(key, now) != nil {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Delete removes keys and their files.
+func (d *DiskBackend) Delete(_ context.Context, keys ...string) (int64, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var n int64
+	for _, key := range keys {
+		if el, ok := d.index[key]; ok {
+			d.remove(el)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// DeletePrefix removes every key starting with prefix, walking the index.
+func (d *DiskBackend) DeletePrefix(_ context.Context, prefix string) (int64, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var n int64
+	for key, el := range d.index {
+		if strings.HasPrefix(key, prefix) {
+			d.remove(el)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Ping checks that the cache directory is still there.
+func (d *DiskBackend) Ping(context.Context) error {
+	info, err := os.Stat(d.Directory)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", d.Directory)
+	}
+	return nil
+}
+
+var (
+	_ caddy.Provisioner = (*DiskBackend)(nil)
+	_ caddy.Validator   = (*DiskBackend)(nil)
+	_ CacheBackend      = (*DiskBackend)(nil)
+)
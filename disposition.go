@@ -0,0 +1,84 @@
+package miniohandler
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+// DispositionRule sets the Content-Disposition of responses to matching
+// request paths.
+type DispositionRule struct {
+	// Request paths to match, with the same syntax as Caddy's path
+	// matcher, e.g. "/downloads/*" or "*.pdf".
+	Path []string `json:"path"`
+
+	// "attachment" to make browsers download the object, or "inline" to
+	// display it.
+	Type string `json:"type"`
+
+	// The file name to save the object as. Placeholders are allowed. If
+	// empty, browsers use the last segment of the URL.
+	Filename string `json:"filename,omitempty"`
+
+	path caddyhttp.MatchPath
+}
+
+// provisionDispositionRules prepares the path matchers of each rule.
+func (h *MinioStaticHTML) provisionDispositionRules(ctx caddy.Context) error {
+	for i := range h.ContentDisposition {
+		rule := &h.ContentDisposition[i]
+		rule.path = append(caddyhttp.MatchPath(nil), rule.Path...)
+		if err := rule.path.Provision(ctx); err != nil {
+			return fmt.Errorf("content_disposition[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// validateDispositionRules checks each rule has paths and a known type.
+func (h *MinioStaticHTML) validateDispositionRules() error {
+	for i, rule := range h.ContentDisposition {
+		if len(rule.Path) == 0 {
+			return fmt.Errorf("content_disposition[%d]: path is required", i)
+		}
+		switch rule.Type {
+		case "attachment", "inline":
+		default:
+			return fmt.Errorf("content_disposition[%d]: type must be attachment or inline, got %q", i, rule.Type)
+		}
+	}
+	return nil
+}
+
+// contentDisposition returns the Content-Disposition for a response to r:
+// that of the first matching rule, or else the object's own (stored),
+// which may be empty.
+func (h *MinioStaticHTML) contentDisposition(r *http.Request, stored string) string {
+	for _, rule := range h.ContentDisposition {
+		if !rule.path.Match(r) {
+			continue
+		}
+		if rule.Filename == "" {
+			return rule.Type
+		}
+		repl := r.Context().Value(caddy.ReplacerCtxKey).(*caddy.Replacer)
+		filename := repl.ReplaceAll(rule.Filename, "")
+		if filename == "" {
+			return rule.Type
+		}
+		return mime.FormatMediaType(rule.Type, map[string]string{"filename": filename})
+	}
+	return stored
+}
+
+// setContentDisposition sets the Content-Disposition header, if any, for a
+// response to r.
+func (h *MinioStaticHTML) setContentDisposition(w http.ResponseWriter, r *http.Request, stored string) {
+	if cd := h.contentDisposition(r, stored); cd != "" {
+		w.Header().Set("Content-Disposition", cd)
+	}
+}
@@ -0,0 +1,155 @@
+package miniohandler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"go.uber.org/zap"
+)
+
+// encodeEncodings lists the encodings encode can compress responses with.
+var encodeEncodings = []string{"zstd", "gzip"}
+
+// validateEncode checks encode lists only supported encodings.
+func (h *MinioStaticHTML) validateEncode() error {
+	for _, enc := range h.Encode {
+		if !slices.Contains(encodeEncodings, enc) {
+			return fmt.Errorf("encode: unknown encoding %q; must be gzip or zstd", enc)
+		}
+	}
+	return nil
+}
+
+// encodings returns the encode encodings r accepts, best first. Range
+// requests are served unencoded.
+func (h *MinioStaticHTML) encodings(r *http.Request) []string {
+	if len(h.Encode) == 0 || r.Header.Get("Range") != "" {
+		return nil
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return nil
+	}
+	return acceptedEncodings(r.Header.Get("Accept-Encoding"), h.Encode)
+}
+
+// encodeBody compresses b with the named Content-Encoding.
+func encodeBody(enc string, b []byte) ([]byte, error) {
+	switch enc {
+	case "zstd":
+		return zstdEncoder.EncodeAll(b, nil), nil
+	case "gzip":
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(b); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, fmt.Errorf("unknown encoding %q", enc)
+}
+
+// encodable reports whether an object should be compressed for a client
+// accepting encodings.
+func (h *MinioStaticHTML) encodable(encodings []string, contentType, contentEncoding, redirectLocation string, size int64) bool {
+	return len(encodings) > 0 && contentEncoding == "" && redirectLocation == "" &&
+		h.GlobalConfig.compressible(contentType, size)
+}
+
+// encodeObject compresses an object with enc and caches the result beside
+// the object's cacheKey, returning the info and content of the variant.
+func (h *MinioStaticHTML) encodeObject(r *http.Request, bucket, objectKey, cacheKey string, objInfo *minio.ObjectInfo, content []byte, enc string) (minio.ObjectInfo, []byte, error) {
+	start := time.Now()
+	encoded, err := encodeBody(enc, content)
+	if err != nil {
+		return minio.ObjectInfo{}, nil, err
+	}
+	h.logger.Debug("compressed response",
+		zap.String("key", cacheKey),
+		zap.String("encoding", enc),
+		zap.Int("size", len(content)),
+		zap.Int("encoded_size", len(encoded)),
+		zap.Duration("duration", time.Since(start)))
+
+	variant := *objInfo
+	variant.ETag = objInfo.ETag + "-" + enc
+	variant.Size = int64(len(encoded))
+	variant.Metadata = objInfo.Metadata.Clone()
+	if variant.Metadata == nil {
+		variant.Metadata = make(http.Header)
+	}
+	variant.Metadata.Set("Content-Encoding", enc)
+	if h.cacheEnabled() {
+		h.storeInCache(r.Context(), compressedCacheKey(cacheKey, enc), bucket, objectKey, &variant, encoded, h.cacheTTLFor(r, objInfo))
+	}
+	return variant, encoded, nil
+}
+
+// serveEncoded compresses an object just fetched from MinIO with the
+// client's preferred encoding, caches and serves it. It reports false,
+// having written nothing, if the object should be served as-is.
+func (h *MinioStaticHTML) serveEncoded(w http.ResponseWriter, r *http.Request, bucket, objectKey, cacheKey string, objInfo *minio.ObjectInfo, content []byte, encodings []string) bool {
+	if !h.encodable(encodings, objInfo.ContentType, objInfo.Metadata.Get("Content-Encoding"),
+		objInfo.Metadata.Get(websiteRedirectHeader), int64(len(content))) {
+		return false
+	}
+	variant, encoded, err := h.encodeObject(r, bucket, objectKey, cacheKey, objInfo, content, encodings[0])
+	if err != nil {
+		h.logger.Error("failed to compress response", zap.String("encoding", encodings[0]), zap.Error(err))
+		return false
+	}
+	h.serveFromOrigin(w, r, &variant, encoded)
+	return true
+}
+
+// serveCachedEncoded is serveEncoded for an object read from the cache. On
+// failure content is rewound so it can still be served as-is.
+func (h *MinioStaticHTML) serveCachedEncoded(w http.ResponseWriter, r *http.Request, bucket, objectKey, cacheKey string, obj *CachedObject, content io.ReadSeeker, encodings []string) bool {
+	if !h.encodable(encodings, obj.ContentType, obj.ContentEncoding, obj.RedirectLocation, obj.Size) {
+		return false
+	}
+	b, err := io.ReadAll(content)
+	if err == nil {
+		objInfo := obj.objectInfo()
+		var variant minio.ObjectInfo
+		var encoded []byte
+		if variant, encoded, err = h.encodeObject(r, bucket, objectKey, cacheKey, &objInfo, b, encodings[0]); err == nil {
+			cachedVariant := *obj
+			cachedVariant.ETag = variant.ETag
+			cachedVariant.Size = variant.Size
+			cachedVariant.ContentEncoding = encodings[0]
+			h.serveFromCache(w, r, &cachedVariant, bytes.NewReader(encoded))
+			return true
+		}
+	}
+	h.logger.Warn("failed to compress cached object", zap.String("key", cacheKey), zap.Error(err))
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		h.logger.Warn("failed to rewind cached object", zap.String("key", cacheKey), zap.Error(err))
+	}
+	return false
+}
+
+// objectInfo rebuilds the parts of an object's info kept in the cache, for
+// re-encoding a cached object. Its content must be read separately.
+func (obj *CachedObject) objectInfo() minio.ObjectInfo {
+	metadata := make(http.Header)
+	if obj.ContentDisposition != "" {
+		metadata.Set("Content-Disposition", obj.ContentDisposition)
+	}
+	return minio.ObjectInfo{
+		ContentType:  obj.ContentType,
+		ETag:         obj.ETag,
+		LastModified: obj.LastModified,
+		Size:         obj.Size,
+		Metadata:     metadata,
+		UserMetadata: obj.UserMetadata,
+	}
+}
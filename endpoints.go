@@ -0,0 +1,470 @@
+package miniohandler
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"go.uber.org/zap"
+)
+
+// Supported values for MinioEndpoint.CredentialsSource.
+const (
+	credsStatic = "static"
+	credsEnv    = "env"
+	credsFile   = "file"
+	credsIAM    = "iam"
+	credsAnon   = "anonymous"
+)
+
+// MinioEndpoint holds the connection settings for one MinIO/S3 deployment.
+type MinioEndpoint struct {
+	Endpoint  string `json:"endpoint,omitempty"`
+	AccessKey string `json:"access_key,omitempty"`
+	SecretKey string `json:"secret_key,omitempty"`
+	Secure    bool   `json:"secure,omitempty"`
+	// The S3 region, e.g. "eu-west-1". Setting it avoids a
+	// GetBucketLocation round trip per bucket and is required for correct
+	// signatures against AWS buckets outside us-east-1.
+	Region string `json:"region,omitempty"`
+
+	// Replicas are further addresses (host:port) serving the same buckets,
+	// e.g. the other sites of a MinIO site-replication deployment. They
+	// share every other setting of the endpoint. Reads that fail against
+	// Endpoint with a transport error, timeout or 5xx are retried on each
+	// replica in turn.
+	Replicas []string `json:"replicas,omitempty"`
+
+	// BucketLookup selects the addressing style: "path" (host/bucket/key),
+	// "dns" (bucket.host/key) or "auto" (the default), which lets minio-go
+	// decide based on the endpoint.
+	BucketLookup string `json:"bucket_lookup,omitempty"`
+
+	// CredentialsSource selects where credentials come from: "static" (the
+	// default) uses AccessKey and SecretKey; "env" reads AWS_ACCESS_KEY_ID
+	// and friends; "file" reads a shared credentials file (CredentialsFile,
+	// default ~/.aws/credentials, with CredentialsProfile); "iam" uses the
+	// EC2 instance role or an EKS service account (IRSA); "anonymous" sends
+	// unsigned requests, for public buckets. Leaving both keys empty with
+	// the static source is also anonymous.
+	CredentialsSource  string `json:"credentials_source,omitempty"`
+	CredentialsFile    string `json:"credentials_file,omitempty"`
+	CredentialsProfile string `json:"credentials_profile,omitempty"`
+
+	// TLS settings for secure endpoints: a PEM bundle of extra trusted CAs
+	// (added to the system pool), a client certificate and key for mutual
+	// TLS, and an option to skip server certificate verification, which
+	// should only be used for testing.
+	TLSCAFile             string `json:"tls_ca_file,omitempty"`
+	TLSClientCert         string `json:"tls_client_cert,omitempty"`
+	TLSClientKey          string `json:"tls_client_key,omitempty"`
+	TLSInsecureSkipVerify bool   `json:"tls_insecure_skip_verify,omitempty"`
+
+	// Connection pool and timeout settings for the HTTP transport. Unset
+	// values keep minio-go's defaults: 256 idle connections, 16 per host,
+	// a 1m idle timeout, a 30s dial timeout and a 1m response header
+	// timeout.
+	MaxIdleConns          int    `json:"max_idle_conns,omitempty"`
+	MaxIdleConnsPerHost   int    `json:"max_idle_conns_per_host,omitempty"`
+	IdleConnTimeout       string `json:"idle_conn_timeout,omitempty"`
+	DialTimeout           string `json:"dial_timeout,omitempty"`
+	ResponseHeaderTimeout string `json:"response_header_timeout,omitempty"`
+
+	// AssumeRole, if set, exchanges AccessKey and SecretKey for temporary
+	// credentials from an STS endpoint.
+	AssumeRole *AssumeRoleConfig `json:"assume_role,omitempty"`
+}
+
+// AssumeRoleConfig configures STS AssumeRole for an endpoint.
+type AssumeRoleConfig struct {
+	RoleARN     string `json:"role_arn,omitempty"`
+	SessionName string `json:"session_name,omitempty"`
+	ExternalID  string `json:"external_id,omitempty"`
+
+	// The STS endpoint URL. Defaults to the MinIO endpoint itself, which
+	// is where MinIO serves STS; use https://sts.amazonaws.com for AWS.
+	STSEndpoint string `json:"sts_endpoint,omitempty"`
+
+	// How long the temporary credentials are valid for (default 1h).
+	Duration string `json:"duration,omitempty"`
+}
+
+// addresses returns the endpoint's primary address followed by its
+// replicas.
+func (e *MinioEndpoint) addresses() []string {
+	return append([]string{e.Endpoint}, e.Replicas...)
+}
+
+// bucketLookupTypes maps bucket_lookup values to minio-go's lookup types.
+// The empty string maps to the zero value, BucketLookupAuto.
+var bucketLookupTypes = map[string]minio.BucketLookupType{
+	"auto": minio.BucketLookupAuto,
+	"path": minio.BucketLookupPath,
+	"dns":  minio.BucketLookupDNS,
+}
+
+// newClient creates a MinIO client for addr, one of the endpoint's
+// addresses, using the endpoint's settings and the given credentials.
+func (e *MinioEndpoint) newClient(addr string, creds *credentials.Credentials) (*minio.Client, error) {
+	transport, err := e.transport()
+	if err != nil {
+		return nil, err
+	}
+	return minio.New(addr, &minio.Options{
+		Creds:        creds,
+		Secure:       e.Secure,
+		Region:       e.Region,
+		Transport:    transport,
+		BucketLookup: bucketLookupTypes[e.BucketLookup],
+	})
+}
+
+// credentials returns the credential provider selected by CredentialsSource.
+// Providers other than static refresh themselves as their values expire.
+func (e *MinioEndpoint) credentials() (*credentials.Credentials, error) {
+	if e.AssumeRole != nil {
+		return e.assumeRole()
+	}
+	switch e.CredentialsSource {
+	case credsEnv:
+		return credentials.NewEnvAWS(), nil
+	case credsFile:
+		return credentials.NewFileAWSCredentials(e.CredentialsFile, e.CredentialsProfile), nil
+	case credsIAM:
+		return credentials.NewIAM(""), nil
+	case credsAnon:
+		// The static provider signs anonymously when it has no keys.
+		return credentials.NewStaticV4("", "", ""), nil
+	default:
+		return credentials.NewStaticV4(e.AccessKey, e.SecretKey, ""), nil
+	}
+}
+
+// assumeRole returns STS credentials obtained with the endpoint's keys.
+func (e *MinioEndpoint) assumeRole() (*credentials.Credentials, error) {
+	ar := e.AssumeRole
+	stsEndpoint := ar.STSEndpoint
+	if stsEndpoint == "" {
+		scheme := "http"
+		if e.Secure {
+			scheme = "https"
+		}
+		stsEndpoint = scheme + "://" + e.Endpoint
+	}
+	var seconds int
+	if ar.Duration != "" {
+		// Already validated in Validate.
+		dur, _ := time.ParseDuration(ar.Duration)
+		seconds = int(dur.Seconds())
+	}
+	return credentials.NewSTSAssumeRole(stsEndpoint, credentials.STSAssumeRoleOptions{
+		AccessKey:       e.AccessKey,
+		SecretKey:       e.SecretKey,
+		Location:        e.Region,
+		DurationSeconds: seconds,
+		RoleARN:         ar.RoleARN,
+		RoleSessionName: ar.SessionName,
+		ExternalID:      ar.ExternalID,
+	})
+}
+
+// credentialRefreshInterval is how often refreshCredentials checks whether
+// temporary credentials are due for renewal.
+const credentialRefreshInterval = time.Minute
+
+// refreshCredentials renews creds in the background as they approach
+// expiry, so requests don't pay for the STS round trip and a failing STS
+// endpoint is logged before the current credentials run out. It returns a
+// function that stops the refresher.
+func refreshCredentials(creds *credentials.Credentials, logger *zap.Logger) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(credentialRefreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			// Get only contacts STS once the credentials are inside their
+			// expiry window.
+			if _, err := creds.Get(); err != nil {
+				logger.Warn("failed to refresh temporary MinIO credentials", zap.Error(err))
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// anonymous reports whether requests to the endpoint are unsigned.
+func (e *MinioEndpoint) anonymous() bool {
+	switch e.CredentialsSource {
+	case credsAnon:
+		return true
+	case "", credsStatic:
+		return e.AssumeRole == nil && e.AccessKey == "" && e.SecretKey == ""
+	}
+	return false
+}
+
+// validate checks the endpoint's settings.
+func (e *MinioEndpoint) validate() error {
+	switch e.CredentialsSource {
+	case "", credsStatic:
+		if (e.AccessKey == "") != (e.SecretKey == "") {
+			return fmt.Errorf("access_key and secret_key must be set together, or both left empty for anonymous access")
+		}
+	case credsAnon:
+		if e.AccessKey != "" || e.SecretKey != "" {
+			return fmt.Errorf("access_key and secret_key must not be set with credentials_source anonymous")
+		}
+	case credsEnv, credsFile, credsIAM:
+	default:
+		return fmt.Errorf("invalid credentials_source %q; must be static, env, file, iam or anonymous", e.CredentialsSource)
+	}
+	if (e.CredentialsFile != "" || e.CredentialsProfile != "") && e.CredentialsSource != credsFile {
+		return fmt.Errorf("credentials_file and credentials_profile require credentials_source file")
+	}
+	if _, ok := bucketLookupTypes[e.BucketLookup]; !ok && e.BucketLookup != "" {
+		return fmt.Errorf("invalid bucket_lookup %q; must be auto, path or dns", e.BucketLookup)
+	}
+	if err := e.validateTransport(); err != nil {
+		return err
+	}
+	if e.hasTLSConfig() && !e.Secure {
+		return fmt.Errorf("TLS options require secure to be true")
+	}
+	if (e.TLSClientCert == "") != (e.TLSClientKey == "") {
+		return fmt.Errorf("tls_client_cert and tls_client_key must be set together")
+	}
+	if ar := e.AssumeRole; ar != nil {
+		if e.CredentialsSource != "" && e.CredentialsSource != credsStatic {
+			return fmt.Errorf("assume_role requires static credentials")
+		}
+		if e.AccessKey == "" || e.SecretKey == "" {
+			return fmt.Errorf("assume_role requires access_key and secret_key")
+		}
+		if ar.Duration != "" {
+			if dur, err := time.ParseDuration(ar.Duration); err != nil {
+				return fmt.Errorf("invalid assume_role duration: %w", err)
+			} else if dur <= 0 {
+				return fmt.Errorf("assume_role duration must be positive")
+			}
+		}
+	}
+	return nil
+}
+
+// defaultEndpoint returns a copy of the endpoint described by the top-level
+// fields of the global config.
+func (m *MinioConfig) defaultEndpoint() *MinioEndpoint {
+	ep := m.MinioEndpoint
+	return &ep
+}
+
+// endpoint looks up a named endpoint, or the default one if name is empty.
+func (m *MinioConfig) endpoint(name string) (*MinioEndpoint, error) {
+	if name == "" {
+		if m.Endpoint == "" {
+			return nil, fmt.Errorf("no default endpoint is configured; set endpoint or endpoint_name")
+		}
+		return m.defaultEndpoint(), nil
+	}
+	ep, ok := m.Endpoints[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown endpoint_name %q", name)
+	}
+	return ep, nil
+}
+
+// resolveEndpoint returns the endpoint the handler connects to: the named or
+// default endpoint from cfg, with the handler's own settings layered on top.
+func (h *MinioStaticHTML) resolveEndpoint(cfg *MinioConfig) (*MinioEndpoint, error) {
+	var ep MinioEndpoint
+	if h.EndpointName != "" || h.Endpoint == "" {
+		base, err := cfg.endpoint(h.EndpointName)
+		if err != nil {
+			return nil, err
+		}
+		ep = *base
+	} else {
+		ep = *cfg.defaultEndpoint()
+	}
+	if h.Endpoint != "" {
+		ep.Endpoint = h.Endpoint
+		ep.Secure = h.Secure
+		ep.Replicas = nil
+	}
+	if h.AccessKey != "" {
+		ep.AccessKey = h.AccessKey
+		ep.SecretKey = h.SecretKey
+		ep.CredentialsSource = credsStatic
+	}
+	if h.Region != "" {
+		ep.Region = h.Region
+	}
+	return &ep, nil
+}
+
+// newMinioClient creates a MinIO client from the global connection settings.
+func (m *MinioConfig) newMinioClient() (*minio.Client, error) {
+	ep := m.defaultEndpoint()
+	creds, err := ep.credentials()
+	if err != nil {
+		return nil, err
+	}
+	return ep.newClient(ep.Endpoint, creds)
+}
+
+// unmarshalEndpoint parses the block of a named_endpoint subdirective:
+//
+//	named_endpoint <name> {
+//	    endpoint   <host:port>
+//	    access_key <key>
+//	    secret_key <secret>
+//	    secure     true|false
+//	    region     <region>
+//	    ...
+//	}
+//
+// It accepts every option unmarshalOption does.
+func unmarshalEndpoint(d *caddyfile.Dispenser) (*MinioEndpoint, error) {
+	ep := new(MinioEndpoint)
+	for nesting := d.Nesting(); d.NextBlock(nesting); {
+		option := d.Val()
+		ok, err := ep.unmarshalOption(d, option)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, d.Errf("unrecognized named_endpoint option '%s'", option)
+		}
+	}
+	return ep, nil
+}
+
+// unmarshalOption parses one endpoint option, shared by the top level of the
+// global config and named_endpoint blocks. It reports false, without
+// consuming any tokens, if option is not an endpoint option.
+func (e *MinioEndpoint) unmarshalOption(d *caddyfile.Dispenser, option string) (bool, error) {
+	var field *string
+	switch option {
+	case "endpoint":
+		field = &e.Endpoint
+	case "access_key":
+		field = &e.AccessKey
+	case "secret_key":
+		field = &e.SecretKey
+	case "region":
+		field = &e.Region
+	case "bucket_lookup":
+		field = &e.BucketLookup
+	case "credentials_source":
+		field = &e.CredentialsSource
+	case "credentials_file":
+		field = &e.CredentialsFile
+	case "credentials_profile":
+		field = &e.CredentialsProfile
+	case "tls_ca_file":
+		field = &e.TLSCAFile
+	case "tls_client_cert":
+		field = &e.TLSClientCert
+	case "tls_client_key":
+		field = &e.TLSClientKey
+	case "idle_conn_timeout":
+		field = &e.IdleConnTimeout
+	case "dial_timeout":
+		field = &e.DialTimeout
+	case "response_header_timeout":
+		field = &e.ResponseHeaderTimeout
+	case "max_idle_conns", "max_idle_conns_per_host":
+		if !d.NextArg() {
+			return true, d.ArgErr()
+		}
+		n, err := strconv.Atoi(d.Val())
+		if err != nil {
+			return true, d.Errf("invalid %s: %v", option, err)
+		}
+		if option == "max_idle_conns" {
+			e.MaxIdleConns = n
+		} else {
+			e.MaxIdleConnsPerHost = n
+		}
+		return true, nil
+	case "secure":
+		if !d.NextArg() {
+			return true, d.ArgErr()
+		}
+		e.Secure = (d.Val() == "true")
+		return true, nil
+	case "tls_insecure_skip_verify":
+		if !d.NextArg() {
+			return true, d.ArgErr()
+		}
+		e.TLSInsecureSkipVerify = (d.Val() == "true")
+		return true, nil
+	case "replicas":
+		e.Replicas = d.RemainingArgs()
+		if len(e.Replicas) == 0 {
+			return true, d.ArgErr()
+		}
+		return true, nil
+	case "assume_role":
+		ar, err := unmarshalAssumeRole(d)
+		if err != nil {
+			return true, err
+		}
+		e.AssumeRole = ar
+		return true, nil
+	default:
+		return false, nil
+	}
+	if !d.NextArg() {
+		return true, d.ArgErr()
+	}
+	*field = d.Val()
+	return true, nil
+}
+
+// unmarshalAssumeRole parses an assume_role block:
+//
+//	assume_role {
+//	    role_arn     <arn>
+//	    session_name <name>
+//	    external_id  <id>
+//	    sts_endpoint <url>
+//	    duration     <duration>
+//	}
+func unmarshalAssumeRole(d *caddyfile.Dispenser) (*AssumeRoleConfig, error) {
+	ar := new(AssumeRoleConfig)
+	for nesting := d.Nesting(); d.NextBlock(nesting); {
+		option := d.Val()
+		if !d.NextArg() {
+			return nil, d.ArgErr()
+		}
+		switch option {
+		case "role_arn":
+			ar.RoleARN = d.Val()
+		case "session_name":
+			ar.SessionName = d.Val()
+		case "external_id":
+			ar.ExternalID = d.Val()
+		case "sts_endpoint":
+			ar.STSEndpoint = d.Val()
+		case "duration":
+			ar.Duration = d.Val()
+		default:
+			return nil, d.Errf("unrecognized assume_role option '%s'", option)
+		}
+	}
+	return ar, nil
+}
@@ -0,0 +1,54 @@
+package miniohandler
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// minioErrorHeader carries the S3 error code of a failed request when
+// expose_error_code is enabled.
+const minioErrorHeader = "X-Minio-Error-Code"
+
+// slowDownRetryAfter is the Retry-After sent when MinIO asks clients to
+// back off.
+const slowDownRetryAfter = "5"
+
+// minioErrorStatuses maps S3 error codes to the status of the response
+// sent for them. Codes not listed are answered with a 500.
+var minioErrorStatuses = map[string]int{
+	"NoSuchKey":     http.StatusNotFound,
+	"NoSuchVersion": http.StatusNotFound,
+	"NoSuchBucket":  http.StatusNotFound,
+
+	"AccessDenied":       http.StatusForbidden,
+	"AllAccessDisabled":  http.StatusForbidden,
+	"AccountProblem":     http.StatusForbidden,
+	"InvalidObjectState": http.StatusForbidden,
+
+	"InvalidRange": http.StatusRequestedRangeNotSatisfiable,
+
+	"SlowDown":                   http.StatusServiceUnavailable,
+	"ServiceUnavailable":         http.StatusServiceUnavailable,
+	"XMinioServerNotInitialized": http.StatusServiceUnavailable,
+}
+
+// validateErrorCodes checks the error translation settings.
+func (h *MinioStaticHTML) validateErrorCodes() error {
+	switch h.NoSuchBucketStatus {
+	case 0, http.StatusNotFound, http.StatusBadGateway:
+		return nil
+	}
+	return fmt.Errorf("no_such_bucket_status must be 404 or 502")
+}
+
+// statusForMinioError returns the status to respond with for an S3 error
+// code.
+func (h *MinioStaticHTML) statusForMinioError(code string) int {
+	if code == "NoSuchBucket" && h.NoSuchBucketStatus != 0 {
+		return h.NoSuchBucketStatus
+	}
+	if status, ok := minioErrorStatuses[code]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,155 @@
+package miniohandler
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/minio/minio-go/v7"
+	"go.uber.org/zap"
+)
+
+// validateErrorPages checks the not_found_object and error_pages settings.
+func (h *MinioStaticHTML) validateErrorPages() error {
+	if h.NotFoundBucket != "" && h.NotFoundObject == "" {
+		return fmt.Errorf("not_found_bucket requires not_found_object")
+	}
+	if h.ErrorBucket != "" && len(h.ErrorPages) == 0 {
+		return fmt.Errorf("error_bucket requires error_pages")
+	}
+	if err := validatePageKey(h.NotFoundObject); err != nil {
+		return fmt.Errorf("not_found_object: %w", err)
+	}
+	for status, key := range h.ErrorPages {
+		if !validErrorStatus(status) {
+			return fmt.Errorf("error_pages: invalid status %q; must be a 4xx or 5xx code, or 4xx or 5xx", status)
+		}
+		if key == "" {
+			return fmt.Errorf("error_pages[%s]: object key must not be empty", status)
+		}
+		if err := validatePageKey(key); err != nil {
+			return fmt.Errorf("error_pages[%s]: %w", status, err)
+		}
+	}
+	return nil
+}
+
+func validatePageKey(key string) error {
+	if key != "" && (strings.TrimPrefix(key, "/") == "" || strings.Contains(key, "..")) {
+		return fmt.Errorf("invalid object key %q", key)
+	}
+	return nil
+}
+
+// validErrorStatus reports whether status is an error_pages key: a 4xx or
+// 5xx code, or one of the classes "4xx" and "5xx".
+func validErrorStatus(status string) bool {
+	if status == "4xx" || status == "5xx" {
+		return true
+	}
+	code, err := strconv.Atoi(status)
+	return err == nil && code >= 400 && code <= 599
+}
+
+// errorPage returns the bucket, unexpanded, and object key of the page for
+// status: its own error_pages entry, else its class's, with
+// not_found_object taking precedence for 404s. The key is "" if there is
+// no page.
+func (h *MinioStaticHTML) errorPage(status int) (string, string) {
+	if status == http.StatusNotFound && h.NotFoundObject != "" {
+		return h.NotFoundBucket, h.NotFoundObject
+	}
+	if key, ok := h.ErrorPages[strconv.Itoa(status)]; ok {
+		return h.ErrorBucket, key
+	}
+	if key, ok := h.ErrorPages[strconv.Itoa(status/100)+"xx"]; ok {
+		return h.ErrorBucket, key
+	}
+	return "", ""
+}
+
+// serveErrorPage responds with status and the page configured for it,
+// served from the cache like any other object. It reports false, having
+// written nothing, if there is no page or it can't be had, such as when
+// it is missing itself.
+func (h *MinioStaticHTML) serveErrorPage(w http.ResponseWriter, r *http.Request, status int) bool {
+	bucketTemplate, keyTemplate := h.errorPage(status)
+	if keyTemplate == "" {
+		return false
+	}
+	repl := r.Context().Value(caddy.ReplacerCtxKey).(*caddy.Replacer)
+	bucket := repl.ReplaceAll(bucketTemplate, "")
+	if bucket == "" {
+		bucket = h.resolveBucket(r, repl)
+	}
+	objectKey := strings.TrimPrefix(repl.ReplaceAll(keyTemplate, ""), "/")
+	return h.servePage(w, r, status, bucket, objectKey)
+}
+
+// servePage responds with status and the object at objectKey, served from
+// the cache like any other object, reporting false, having written
+// nothing, if it can't be had.
+func (h *MinioStaticHTML) servePage(w http.ResponseWriter, r *http.Request, status int, bucket, objectKey string) bool {
+	if bucket == "" || objectKey == "" || strings.Contains(objectKey, "..") {
+		return false
+	}
+	cacheKey := h.GlobalConfig.cacheKeyFor(r.Context(), bucket, objectKey)
+
+	if h.cacheEnabled() {
+		entries := h.lookupCacheKeys(r.Context(), bucket, objectKey, true, cacheKey)
+		if entry := entries[0]; entry != nil && !entry.obj.expired(time.Now()) {
+			if entry.obj.Missing || entry.obj.RedirectLocation != "" {
+				return false
+			}
+			h.writeErrorPage(w, r, status, entry.obj.ContentType, entry.obj.ContentEncoding, entry.obj.Size, entry.content)
+			return true
+		}
+	}
+
+	opts := minio.GetObjectOptions{ServerSideEncryption: h.sse}
+	objInfo, content, err := h.fetchWithFailover(r.Context(), bucket, objectKey, opts)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			if h.cacheEnabled() {
+				h.storeMissing(r.Context(), cacheKey)
+			}
+		} else {
+			h.logger.Warn("failed to fetch page",
+				zap.Int("status", status),
+				zap.String("bucket", bucket),
+				zap.String("object_key", objectKey),
+				zap.Error(err))
+		}
+		return false
+	}
+	content = h.prepareObject(objectKey, &objInfo, content)
+	if h.cacheEnabled() {
+		h.storeInCache(r.Context(), cacheKey, bucket, objectKey, &objInfo, content, h.cacheTTLFor(r, &objInfo))
+	}
+	h.writeErrorPage(w, r, status, objInfo.ContentType, objInfo.Metadata.Get("Content-Encoding"), objInfo.Size, bytes.NewReader(content))
+	return true
+}
+
+// writeErrorPage writes an error page with its status. Unlike objects, it
+// is never served partially or as not modified, and clients and shared
+// caches are told not to keep it.
+func (h *MinioStaticHTML) writeErrorPage(w http.ResponseWriter, r *http.Request, status int, contentType, contentEncoding string, size int64, body io.Reader) {
+	w.Header().Set("Content-Type", contentType)
+	if contentEncoding != "" {
+		w.Header().Set("Content-Encoding", contentEncoding)
+	}
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", size))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if r.Method == http.MethodHead {
+		return
+	}
+	if _, err := io.Copy(w, body); err != nil {
+		h.logger.Debug("failed to write error page", zap.Int("status", status), zap.Error(err))
+	}
+}
@@ -0,0 +1,51 @@
+package miniohandler
+
+import (
+	"fmt"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyevents"
+)
+
+// Names of the events emitted through Caddy's events app.
+const (
+	eventCacheHit    = "minio.cache_hit"
+	eventCacheMiss   = "minio.cache_miss"
+	eventOriginError = "minio.origin_error"
+	eventPurged      = "minio.purged"
+)
+
+// eventEmitter emits events on behalf of the module it was provisioned
+// for, which subscribers see as the events' origin.
+type eventEmitter struct {
+	ctx    caddy.Context
+	events *caddyevents.App
+}
+
+// newEventEmitter returns an emitter for the module being provisioned
+// with ctx.
+func newEventEmitter(ctx caddy.Context) (*eventEmitter, error) {
+	app, err := ctx.App("events")
+	if err != nil {
+		return nil, fmt.Errorf("getting events app: %v", err)
+	}
+	return &eventEmitter{ctx: ctx, events: app.(*caddyevents.App)}, nil
+}
+
+// emit sends an event to its subscribers, which run before emit returns.
+// A nil emitter, such as one of a module the CLI built without
+// provisioning, emits nothing.
+func (e *eventEmitter) emit(name string, data map[string]any) {
+	if e == nil {
+		return
+	}
+	e.events.Emit(e.ctx, name, data)
+}
+
+// emitPurged reports a purge, from source, of the entries described by
+// data, which gains the source and the number of keys affected.
+func (e *eventEmitter) emitPurged(source string, n int64, data map[string]any) {
+	data["source"] = source
+	data["count"] = n
+	e.emit(eventPurged, data)
+}
@@ -0,0 +1,41 @@
+package miniohandler
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"go.uber.org/zap"
+)
+
+// fallbackCtxKey holds, in a request's context, the index into
+// FallbackBuckets of the bucket the request is being served from.
+type fallbackCtxKey struct{}
+
+// fallbackIndex returns the index of the fallback bucket r is served
+// from, or -1 if it is served from its own bucket.
+func fallbackIndex(r *http.Request) int {
+	if i, ok := r.Context().Value(fallbackCtxKey{}).(int); ok {
+		return i
+	}
+	return -1
+}
+
+// serveFallback serves r from the next of FallbackBuckets once the object
+// is missing from the current bucket, reporting false, having written
+// nothing, if there is none left. If cacheKey is set, a marker is cached
+// there so later requests skip the bucket without asking MinIO.
+func (h *MinioStaticHTML) serveFallback(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler, bucket, objectKey, cacheKey string) (bool, error) {
+	i := fallbackIndex(r) + 1
+	if i >= len(h.FallbackBuckets) {
+		return false, nil
+	}
+	if cacheKey != "" && h.cacheEnabled() {
+		h.storeMissing(r.Context(), cacheKey)
+	}
+	h.logger.Debug("object not found in bucket; trying fallback",
+		zap.String("bucket", bucket),
+		zap.String("object_key", objectKey),
+		zap.String("fallback", h.FallbackBuckets[i]))
+	return true, h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), fallbackCtxKey{}, i)), next)
+}
@@ -0,0 +1,76 @@
+package miniohandler
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// generationRefresh is how long a bucket's generation is remembered
+// before it is read from the cache again, and so how long other nodes
+// take to follow a bump.
+const generationRefresh = time.Second
+
+// cachedGeneration is a bucket's generation as last read from the cache.
+type cachedGeneration struct {
+	value   string
+	fetched time.Time
+}
+
+// generationKey returns the key a bucket's generation is stored under.
+func (m *MinioConfig) generationKey(bucket string) string {
+	prefix := m.keyPrefix
+	if prefix == "" {
+		prefix = defaultCacheKeyPrefix
+	}
+	return prefix + ":_gen:" + bucket
+}
+
+// generation returns the current generation of bucket's cache entries, or
+// "" if cache_generations is off or the bucket's generation was never
+// bumped. If the cache can't be read, the last generation seen is used.
+func (m *MinioConfig) generation(ctx context.Context, bucket string) string {
+	if !m.CacheGenerations || m.cache == nil {
+		return ""
+	}
+	last, ok := m.generations.Load(bucket)
+	if ok && time.Since(last.(cachedGeneration).fetched) < generationRefresh {
+		return last.(cachedGeneration).value
+	}
+	raw, err := getOne(ctx, m.cache, m.generationKey(bucket))
+	if err != nil && !errors.Is(err, errCacheMiss) {
+		if ok {
+			return last.(cachedGeneration).value
+		}
+		return ""
+	}
+	gen := string(raw)
+	m.generations.Store(bucket, cachedGeneration{gen, time.Now()})
+	return gen
+}
+
+// bumpGeneration starts a new generation for bucket, so every entry cached
+// under the old one is ignored from then on. It returns the old and new
+// generations. Generations are timestamps rather than counters, so
+// concurrent bumps need no atomic increment and still differ.
+func (m *MinioConfig) bumpGeneration(ctx context.Context, bucket string) (string, string, error) {
+	raw, err := getOne(ctx, m.cache, m.generationKey(bucket))
+	if err != nil && !errors.Is(err, errCacheMiss) {
+		return "", "", err
+	}
+	old := string(raw)
+	gen := strconv.FormatInt(time.Now().UnixNano(), 36)
+	if err := m.cache.Set(ctx, 0, CacheItem{m.generationKey(bucket), []byte(gen)}); err != nil {
+		return "", "", err
+	}
+	m.generations.Store(bucket, cachedGeneration{gen, time.Now()})
+	return old, gen, nil
+}
+
+// purgeGeneration deletes the entries cached under one of bucket's old
+// generations, which would otherwise linger until they expire, or forever
+// if pinned.
+func (m *MinioConfig) purgeGeneration(ctx context.Context, bucket, gen string) (int64, error) {
+	return m.cache.DeletePrefix(ctx, m.bucketKeyPrefix(bucket, gen))
+}
@@ -0,0 +1,121 @@
+package miniohandler
+
+import (
+	"bufio"
+	"bytes"
+	"net/http"
+	"net/textproto"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"go.uber.org/zap"
+)
+
+// headerRule is one block of a Netlify-style _headers file: a path pattern
+// followed by indented "Name: value" lines.
+//
+//	/assets/*
+//	  Cache-Control: public, max-age=31536000, immutable
+type headerRule struct {
+	path   []string
+	header http.Header
+}
+
+// parseHeaders parses a _headers file. Header lines outside a path block
+// or without a colon are skipped and reported through logger.
+func parseHeaders(data []byte, logger *zap.Logger) []headerRule {
+	var rules []headerRule
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		trimmed := strings.TrimSpace(text)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if !strings.HasPrefix(text, " ") && !strings.HasPrefix(text, "\t") {
+			if !strings.HasPrefix(trimmed, "/") {
+				logger.Warn("skipping invalid _headers path", zap.Int("line", line), zap.String("path", trimmed))
+				continue
+			}
+			rules = append(rules, headerRule{path: splitPattern(trimmed), header: make(http.Header)})
+			continue
+		}
+		name, value, ok := strings.Cut(trimmed, ":")
+		if !ok || len(rules) == 0 {
+			logger.Warn("skipping invalid _headers line", zap.Int("line", line), zap.String("header", trimmed))
+			continue
+		}
+		rules[len(rules)-1].header.Add(textproto.TrimString(name), textproto.TrimString(value))
+	}
+	return rules
+}
+
+// matchingHeaders collects the headers of every _headers rule matching
+// path. As on Netlify, when several rules set the same header all values
+// are sent.
+func matchingHeaders(rules []headerRule, path string) http.Header {
+	var header http.Header
+	for _, rule := range rules {
+		if _, ok := matchPath(rule.path, path); !ok {
+			continue
+		}
+		if header == nil {
+			header = make(http.Header)
+		}
+		for name, values := range rule.header {
+			header[name] = append(header[name], values...)
+		}
+	}
+	return header
+}
+
+// responseHeaders returns the configured headers for r: the route's
+// headers with placeholders expanded, overridden by any matching _headers
+// rules from bucket.
+func (h *MinioStaticHTML) responseHeaders(r *http.Request, repl *caddy.Replacer, bucket string) http.Header {
+	header := make(http.Header, len(h.Headers))
+	for name, value := range h.Headers {
+		header.Set(name, repl.ReplaceAll(value, ""))
+	}
+	if h.headers != nil {
+		for name, values := range matchingHeaders(h.headers.get(bucket), r.URL.Path) {
+			header[name] = values
+		}
+	}
+	return header
+}
+
+// headerWriter adds a set of headers to the response just before the
+// status line is written, replacing any the handler set itself, so
+// configured policy such as Cache-Control wins over the defaults.
+type headerWriter struct {
+	*caddyhttp.ResponseWriterWrapper
+	header      http.Header
+	wroteHeader bool
+}
+
+func newHeaderWriter(w http.ResponseWriter, header http.Header) *headerWriter {
+	return &headerWriter{
+		ResponseWriterWrapper: &caddyhttp.ResponseWriterWrapper{ResponseWriter: w},
+		header:                header,
+	}
+}
+
+func (hw *headerWriter) WriteHeader(status int) {
+	// Informational responses are sent before the final headers are known.
+	if !hw.wroteHeader && status >= http.StatusOK {
+		hw.wroteHeader = true
+		for name, values := range hw.header {
+			hw.Header()[name] = values
+		}
+	}
+	hw.ResponseWriterWrapper.WriteHeader(status)
+}
+
+func (hw *headerWriter) Write(p []byte) (int, error) {
+	if !hw.wroteHeader {
+		hw.WriteHeader(http.StatusOK)
+	}
+	return hw.ResponseWriterWrapper.Write(p)
+}
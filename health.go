@@ -0,0 +1,176 @@
+package miniohandler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// defaultHealthInterval is how often MinIO and the cache are probed for
+// health_path when health_interval is not configured.
+const defaultHealthInterval = 5 * time.Second
+
+// healthProbeBucket is looked up when the handler has no fixed bucket to
+// probe. Whether it exists doesn't matter, only that MinIO answers.
+const healthProbeBucket = "caddy-minio-health-probe"
+
+// healthStatus is the outcome of one round of probes, served as the body
+// of health_path responses.
+type healthStatus struct {
+	Ready     bool      `json:"ready"`
+	MinIO     string    `json:"minio"`
+	Cache     string    `json:"cache"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// validateHealth checks the health endpoint settings.
+func (h *MinioStaticHTML) validateHealth() error {
+	if h.HealthPath == "" {
+		if h.HealthInterval != "" {
+			return fmt.Errorf("health_interval requires health_path")
+		}
+		return nil
+	}
+	if !strings.HasPrefix(h.HealthPath, "/") {
+		return fmt.Errorf("health_path must start with /")
+	}
+	if h.HealthInterval != "" {
+		if dur, err := time.ParseDuration(h.HealthInterval); err != nil {
+			return fmt.Errorf("invalid health_interval: %w", err)
+		} else if dur <= 0 {
+			return fmt.Errorf("health_interval must be positive")
+		}
+	}
+	return nil
+}
+
+// startHealthProbes probes MinIO and the cache every health_interval until
+// Cleanup, so health checks are answered from the last result instead of
+// making load balancers wait on a slow or unreachable backend.
+func (h *MinioStaticHTML) startHealthProbes() {
+	interval := defaultHealthInterval
+	if h.HealthInterval != "" {
+		// Already validated in Validate.
+		interval, _ = time.ParseDuration(h.HealthInterval)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	h.stopHealth = func() {
+		cancel()
+		<-done
+	}
+	h.health = new(atomic.Pointer[healthStatus])
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			h.probeHealth(ctx, interval)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// probeHealth checks MinIO and the cache once, each within timeout, and
+// records the result, logging any change in readiness.
+func (h *MinioStaticHTML) probeHealth(ctx context.Context, timeout time.Duration) {
+	status := &healthStatus{MinIO: "ok", Cache: "ok"}
+	if err := h.probeMinIO(ctx, timeout); err != nil {
+		status.MinIO = err.Error()
+	}
+	if h.cache == nil {
+		status.Cache = "not configured"
+	} else {
+		pingCtx, cancel := context.WithTimeout(ctx, timeout)
+		err := h.cache.Ping(pingCtx)
+		cancel()
+		if err != nil {
+			status.Cache = err.Error()
+		}
+	}
+	if ctx.Err() != nil {
+		return
+	}
+	status.Ready = status.MinIO == "ok" && (h.cache == nil || status.Cache == "ok")
+	status.CheckedAt = time.Now()
+
+	last := h.health.Swap(status)
+	if last == nil || last.Ready == status.Ready {
+		return
+	}
+	if status.Ready {
+		h.logger.Info("minio handler ready", zap.String("health_path", h.HealthPath))
+	} else {
+		h.logger.Warn("minio handler not ready",
+			zap.String("health_path", h.HealthPath),
+			zap.String("minio", status.MinIO),
+			zap.String("cache", status.Cache))
+	}
+}
+
+// probeMinIO checks that the handler's buckets exist on at least one of its
+// origins, so a node that can still fail over to a replica stays ready.
+func (h *MinioStaticHTML) probeMinIO(ctx context.Context, timeout time.Duration) error {
+	buckets := h.staticBuckets()
+	var errs []error
+	for _, o := range h.origins {
+		err := h.probeOrigin(ctx, o, buckets, timeout)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", o.endpoint, err))
+	}
+	return errors.Join(errs...)
+}
+
+func (h *MinioStaticHTML) probeOrigin(ctx context.Context, o *origin, buckets []string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if len(buckets) == 0 {
+		_, err := o.client.BucketExists(ctx, healthProbeBucket)
+		return err
+	}
+	for _, bucket := range buckets {
+		exists, err := o.client.BucketExists(ctx, bucket)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("bucket %q does not exist", bucket)
+		}
+	}
+	return nil
+}
+
+// serveHealth answers a request for health_path with the last probe
+// result: 200 if MinIO and the cache were reachable, 503 otherwise or if
+// no probe has finished yet.
+func (h *MinioStaticHTML) serveHealth(w http.ResponseWriter, r *http.Request) error {
+	status := h.health.Load()
+	if status == nil {
+		status = &healthStatus{MinIO: "unknown", Cache: "unknown"}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if status.Ready {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if r.Method == http.MethodHead {
+		return nil
+	}
+	return json.NewEncoder(w).Encode(status)
+}
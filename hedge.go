@@ -0,0 +1,74 @@
+package miniohandler
+
+import (
+	"context"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// hedgeResult is the outcome of one hedged fetch.
+type hedgeResult struct {
+	objInfo minio.ObjectInfo
+	content []byte
+	err     error
+}
+
+// fetchHedged fetches an object from the primary origin and, each time
+// hedge_delay passes without an answer, from the next replica as well. The
+// first successful (or definitive, such as NoSuchKey) response wins and the
+// other requests are cancelled. An origin that fails outright is replaced
+// by the next one immediately rather than after the delay.
+func (h *MinioStaticHTML) fetchHedged(ctx context.Context, bucket, objectKey string, opts minio.GetObjectOptions) (minio.ObjectInfo, []byte, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Buffered so that requests still running when we return don't block.
+	results := make(chan hedgeResult, len(h.origins))
+	next, inFlight := 0, 0
+	launch := func() bool {
+		for next < len(h.origins) {
+			o := h.origins[next]
+			next++
+			if o.breaker != nil && !o.breaker.allow() {
+				continue
+			}
+			inFlight++
+			go func() {
+				objInfo, content, err := h.fetchOrigin(ctx, o.client, bucket, objectKey, opts)
+				if o.breaker != nil {
+					o.breaker.done(err)
+				}
+				results <- hedgeResult{objInfo, content, err}
+			}()
+			return true
+		}
+		return false
+	}
+
+	if !launch() {
+		return minio.ObjectInfo{}, nil, errBreakerOpen
+	}
+	timer := time.NewTimer(h.hedgeDelay)
+	defer timer.Stop()
+
+	var last hedgeResult
+	for inFlight > 0 {
+		select {
+		case <-timer.C:
+			if launch() {
+				timer.Reset(h.hedgeDelay)
+			}
+		case res := <-results:
+			inFlight--
+			if res.err == nil || !originFailure(res.err) || ctx.Err() != nil {
+				return res.objInfo, res.content, res.err
+			}
+			last = res
+			if inFlight == 0 {
+				launch()
+			}
+		}
+	}
+	return last.objInfo, last.content, last.err
+}
@@ -0,0 +1,95 @@
+package miniohandler
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// defaultHide lists the objects hidden when hide is not configured:
+// repository metadata, environment files and site configuration files.
+var defaultHide = []string{".git/*", "*.env", "_headers", "_redirects"}
+
+// validateHide checks the hide patterns.
+func (h *MinioStaticHTML) validateHide() error {
+	for i, pattern := range h.Hide {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("hide[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// hidden reports whether objectKey matches one of the hide patterns, or
+// the defaults if hide is not configured. A pattern without a slash
+// matches any segment of the key, so "*.env" hides "config/prod.env"; one
+// with a slash matches the key or any of its parent directories, so
+// ".git/*" hides everything under .git.
+func (h *MinioStaticHTML) hidden(objectKey string) bool {
+	patterns := h.Hide
+	if patterns == nil {
+		patterns = defaultHide
+	}
+	segments := strings.Split(objectKey, "/")
+	for _, pattern := range patterns {
+		pattern = strings.TrimPrefix(pattern, "/")
+		if !strings.Contains(pattern, "/") {
+			for _, segment := range segments {
+				if ok, _ := path.Match(pattern, segment); ok {
+					return true
+				}
+			}
+			continue
+		}
+		for i := len(segments); i > 0; i-- {
+			if ok, _ := path.Match(pattern, strings.Join(segments[:i], "/")); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// validateAllow checks the allow patterns.
+func (h *MinioStaticHTML) validateAllow() error {
+	for i, pattern := range h.Allow {
+		if pattern == "" {
+			return fmt.Errorf("allow[%d]: pattern must not be empty", i)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("allow[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// allowed reports whether objectKey passes the allow filter, which every
+// key does if it is not configured. A pattern starting with a dot and
+// free of wildcards is an extension, so ".css" allows "assets/site.css";
+// another pattern without a slash matches the key's file name and one
+// with a slash the whole key.
+func (h *MinioStaticHTML) allowed(objectKey string) bool {
+	if len(h.Allow) == 0 {
+		return true
+	}
+	name := path.Base(objectKey)
+	ext := strings.ToLower(path.Ext(objectKey))
+	for _, pattern := range h.Allow {
+		pattern = strings.TrimPrefix(pattern, "/")
+		switch {
+		case strings.HasPrefix(pattern, ".") && !strings.ContainsAny(pattern, `*?[\/`):
+			if strings.EqualFold(pattern, ext) {
+				return true
+			}
+		case strings.Contains(pattern, "/"):
+			if ok, _ := path.Match(pattern, objectKey); ok {
+				return true
+			}
+		default:
+			if ok, _ := path.Match(pattern, name); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+package miniohandler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"go.uber.org/zap"
+)
+
+// Layouts of localized objects.
+const (
+	languageSuffix    = "suffix"    // index.fr.html
+	languageDirectory = "directory" // fr/index.html
+)
+
+// validateLanguages checks the localization settings.
+func (h *MinioStaticHTML) validateLanguages() error {
+	switch h.LanguageLayout {
+	case "", languageSuffix, languageDirectory:
+	default:
+		return fmt.Errorf("invalid language_layout %q; must be suffix or directory", h.LanguageLayout)
+	}
+	for i, lang := range h.Languages {
+		if lang == "" || strings.ContainsAny(lang, "/.*") {
+			return fmt.Errorf("languages[%d]: invalid language %q", i, lang)
+		}
+	}
+	return nil
+}
+
+// localize returns the localized object to serve for an HTML page in the
+// language the client prefers, if it exists, setting Content-Language,
+// or objectKey itself if there is none. Responses vary on
+// Accept-Language either way.
+func (h *MinioStaticHTML) localize(w http.ResponseWriter, r *http.Request, bucket, objectKey string) string {
+	if len(h.Languages) == 0 || h.HtmlFile != "" || path.Ext(objectKey) != ".html" ||
+		(r.Method != http.MethodGet && r.Method != http.MethodHead) {
+		return objectKey
+	}
+	w.Header().Add("Vary", "Accept-Language")
+
+	for _, lang := range negotiateLanguages(r.Header.Get("Accept-Language"), h.Languages) {
+		key := localizedKey(objectKey, lang, h.LanguageLayout)
+		if h.localizedExists(r.Context(), bucket, key) {
+			w.Header().Set("Content-Language", lang)
+			return key
+		}
+	}
+	return objectKey
+}
+
+// localizedKey returns the key of objectKey's translation into lang.
+func localizedKey(objectKey, lang, layout string) string {
+	if layout == languageDirectory {
+		dir, file := path.Split(objectKey)
+		return dir + lang + "/" + file
+	}
+	ext := path.Ext(objectKey)
+	return strings.TrimSuffix(objectKey, ext) + "." + lang + ext
+}
+
+// localizedExists reports whether a translation exists, trusting its
+// cache entry or missing marker if it has one. Translations MinIO says are
+// missing are recorded as such, so untranslated pages cost one lookup per
+// cache TTL rather than one per request.
+func (h *MinioStaticHTML) localizedExists(ctx context.Context, bucket, objectKey string) bool {
+	cacheKey := h.GlobalConfig.cacheKeyFor(ctx, bucket, objectKey)
+	if h.cacheEnabled() {
+		raw, err := getOne(ctx, h.cache, cacheKey)
+		if err == nil {
+			var obj CachedObject
+			if json.Unmarshal(raw, &obj) == nil {
+				return !obj.Missing
+			}
+		}
+	}
+	_, err := h.client.StatObject(ctx, bucket, objectKey, minio.StatObjectOptions{ServerSideEncryption: h.sse})
+	if err == nil {
+		return true
+	}
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		if h.cacheEnabled() {
+			h.storeMissing(ctx, cacheKey)
+		}
+	} else {
+		h.logger.Debug("failed to look up translation", zap.String("key", objectKey), zap.Error(err))
+	}
+	return false
+}
+
+// negotiateLanguages returns the languages from available the client
+// accepts, most preferred first. A tag such as "fr-CA" also accepts "fr"
+// if "fr-CA" itself is not available.
+func negotiateLanguages(acceptLanguage string, available []string) []string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+	var accepted []weighted
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if tag == "" || tag == "*" || q <= 0 {
+			continue
+		}
+		accepted = append(accepted, weighted{tag, q})
+	}
+	sort.SliceStable(accepted, func(i, j int) bool { return accepted[i].q > accepted[j].q })
+
+	var langs []string
+	add := func(tag string) bool {
+		for _, lang := range available {
+			if strings.EqualFold(lang, tag) {
+				if !slices.Contains(langs, lang) {
+					langs = append(langs, lang)
+				}
+				return true
+			}
+		}
+		return false
+	}
+	for _, a := range accepted {
+		if !add(a.tag) {
+			if base, _, ok := strings.Cut(a.tag, "-"); ok {
+				add(base)
+			}
+		}
+	}
+	return langs
+}
@@ -0,0 +1,123 @@
+package miniohandler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"go.uber.org/zap"
+)
+
+// imageFormatTypes maps the formats accepted by image_formats to their
+// content types. Sidecars are named after the format, e.g. photo.jpg.webp.
+var imageFormatTypes = map[string]string{
+	"avif": "image/avif",
+	"webp": "image/webp",
+}
+
+// validateImageFormats checks image_formats lists only known formats.
+func (h *MinioStaticHTML) validateImageFormats() error {
+	for _, format := range h.ImageFormats {
+		if _, ok := imageFormatTypes[format]; !ok {
+			return fmt.Errorf("image_formats: unknown format %q; must be avif or webp", format)
+		}
+	}
+	return nil
+}
+
+// negotiatesImage reports whether objectKey is an image that may be served
+// in another format.
+func (h *MinioStaticHTML) negotiatesImage(objectKey string) bool {
+	if len(h.ImageFormats) == 0 {
+		return false
+	}
+	switch strings.ToLower(path.Ext(objectKey)) {
+	case ".jpg", ".jpeg", ".png", ".gif":
+		return true
+	}
+	return false
+}
+
+// serveImageFormat serves a sidecar of the image objectKey in a format the
+// client accepts, such as objectKey+".webp", if one exists. It reports
+// false if the original should be served instead. Only formats the Accept
+// header names explicitly count, as browsers send image/* whether or not
+// they can decode them. Like precompressed sidecars, missing ones are
+// remembered in the cache.
+func (h *MinioStaticHTML) serveImageFormat(w http.ResponseWriter, r *http.Request, bucket, objectKey, cacheKey string, opts minio.GetObjectOptions) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	// The original is served to clients that accept neither, so its
+	// response varies too.
+	if !headerListContains(strings.Join(w.Header().Values("Vary"), ","), "Accept") {
+		w.Header().Add("Vary", "Accept")
+	}
+	ctx := r.Context()
+	if h.requestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.requestTimeout)
+		defer cancel()
+	}
+	offered := make([]string, len(h.ImageFormats))
+	for i, format := range h.ImageFormats {
+		offered[i] = imageFormatTypes[format]
+	}
+	accepted := acceptedEncodings(r.Header.Get("Accept"), offered)
+	if len(accepted) == 0 {
+		return false
+	}
+	// Under :vary: so purging the original purges its sidecars.
+	cacheKeys := make([]string, len(accepted))
+	for i, contentType := range accepted {
+		cacheKeys[i] = cacheKey + ":vary:fmt:" + strings.TrimPrefix(contentType, "image/")
+	}
+	cached := make([]*cacheEntry, len(accepted))
+	if h.readCache(r) {
+		cached = h.lookupCacheKeys(r.Context(), bucket, objectKey, r.Header.Get("Range") == "", cacheKeys...)
+	}
+	for i, contentType := range accepted {
+		sidecarKey := objectKey + "." + strings.TrimPrefix(contentType, "image/")
+		sidecarCacheKey := cacheKeys[i]
+
+		if entry := cached[i]; entry != nil && !entry.obj.expired(time.Now()) {
+			if entry.obj.Missing {
+				continue
+			}
+			h.observeCache(cacheHit)
+			h.events.emit(eventCacheHit, map[string]any{"bucket": bucket, "key": sidecarKey})
+			h.serveFromCache(w, r, entry.obj, entry.content)
+			return true
+		}
+
+		objInfo, content, err := h.fetchWithFailover(ctx, bucket, sidecarKey, opts)
+		if err != nil {
+			if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+				if h.cacheEnabled() {
+					h.storeMissing(r.Context(), sidecarCacheKey)
+				}
+				continue
+			}
+			// Let the original's fetch deal with the failure.
+			h.logger.Debug("fetching image sidecar failed",
+				zap.String("bucket", bucket),
+				zap.String("object_key", sidecarKey),
+				zap.Error(err))
+			return false
+		}
+
+		objInfo.ContentType = contentType
+		if h.cacheEnabled() {
+			h.observeCache(cacheMiss)
+			h.events.emit(eventCacheMiss, map[string]any{"bucket": bucket, "key": sidecarKey})
+			h.storeInCache(r.Context(), sidecarCacheKey, bucket, sidecarKey, &objInfo, content, h.cacheTTLFor(r, &objInfo))
+		}
+		h.serveFromOrigin(w, r, &objInfo, content)
+		return true
+	}
+	return false
+}
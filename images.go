@@ -0,0 +1,315 @@
+package miniohandler
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif" // decoded by image.Decode
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HugoSmits86/nativewebp"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/minio/minio-go/v7"
+	"go.uber.org/zap"
+	_ "golang.org/x/image/webp" // decoded by image.Decode
+)
+
+// Defaults for image transformation.
+const (
+	defaultImageMaxWidth  = 4096
+	defaultImageMaxHeight = 4096
+	defaultImageQuality   = 85
+
+	// maxImagePixels caps the size of the images decoded, so a small
+	// object can't make the handler allocate gigabytes.
+	maxImagePixels = 50_000_000
+)
+
+// Images resizes and transcodes JPEG, PNG, GIF and WebP objects on the
+// fly, as asked by query parameters: ?w=400 and ?h=300 scale the image
+// down to fit within that box, keeping its aspect ratio, ?format=webp,
+// jpeg or png converts it, and ?q=70 sets the JPEG quality. Each variant is
+// cached under its object's key, so purging the object purges its
+// variants.
+//
+// Images are never scaled up. WebP is encoded lossless, in pure Go, so q
+// doesn't apply to it. There is no AVIF encoder, so AVIF is not offered;
+// image_formats can serve AVIF files stored alongside the originals.
+type Images struct {
+	// The widest and tallest images produced (default 4096 each).
+	MaxWidth  int `json:"max_width,omitempty"`
+	MaxHeight int `json:"max_height,omitempty"`
+
+	// If set, the only widths that may be asked for, which keeps clients
+	// from filling the cache with arbitrary sizes.
+	Widths []int `json:"widths,omitempty"`
+
+	// The JPEG quality when ?q is not given, from 1 to 100 (default 85).
+	Quality int `json:"quality,omitempty"`
+}
+
+// validate checks the image settings.
+func (i *Images) validate() error {
+	if i.MaxWidth < 0 || i.MaxHeight < 0 {
+		return fmt.Errorf("max_width and max_height must not be negative")
+	}
+	for n, w := range i.Widths {
+		if w <= 0 {
+			return fmt.Errorf("widths[%d]: must be positive", n)
+		}
+	}
+	if i.Quality < 0 || i.Quality > 100 {
+		return fmt.Errorf("quality must be between 1 and 100")
+	}
+	return nil
+}
+
+// imageTransform is a resize and conversion asked for by a request. A zero
+// width or height is derived from the other, or from the source.
+type imageTransform struct {
+	width, height int
+	format        string
+	quality       int
+}
+
+// key identifies the variant produced by t.
+func (t imageTransform) key() string {
+	return fmt.Sprintf("w=%d,h=%d,f=%s,q=%d", t.width, t.height, t.format, t.quality)
+}
+
+// imageRequested reports whether r asks for a transformed image.
+func (h *MinioStaticHTML) imageRequested(r *http.Request, objectKey string) bool {
+	if h.Images == nil || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+		return false
+	}
+	switch strings.ToLower(path.Ext(objectKey)) {
+	case ".jpg", ".jpeg", ".png", ".gif", ".webp":
+	default:
+		return false
+	}
+	query := r.URL.Query()
+	return query.Has("w") || query.Has("h") || query.Has("format") || query.Has("q")
+}
+
+// parseTransform reads the transformation asked for by r.
+func (i *Images) parseTransform(r *http.Request) (imageTransform, error) {
+	query := r.URL.Query()
+	t := imageTransform{format: strings.ToLower(query.Get("format"))}
+	dimension := func(name string, limit int) (int, error) {
+		v := query.Get(name)
+		if v == "" {
+			return 0, nil
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid %s %q", name, v)
+		}
+		if n > limit {
+			return 0, fmt.Errorf("%s %d exceeds the maximum of %d", name, n, limit)
+		}
+		return n, nil
+	}
+	var err error
+	if t.width, err = dimension("w", orDefault(i.MaxWidth, defaultImageMaxWidth)); err != nil {
+		return t, err
+	}
+	if t.height, err = dimension("h", orDefault(i.MaxHeight, defaultImageMaxHeight)); err != nil {
+		return t, err
+	}
+	if t.width > 0 && len(i.Widths) > 0 && !slices.Contains(i.Widths, t.width) {
+		return t, fmt.Errorf("width %d is not allowed", t.width)
+	}
+	switch t.format {
+	case "", "png", "webp":
+	case "jpeg", "jpg":
+		t.format = "jpeg"
+	default:
+		return t, fmt.Errorf("invalid format %q; must be webp, jpeg or png", t.format)
+	}
+	t.quality = orDefault(i.Quality, defaultImageQuality)
+	if v := query.Get("q"); v != "" {
+		q, err := strconv.Atoi(v)
+		if err != nil || q < 1 || q > 100 {
+			return t, fmt.Errorf("invalid q %q; must be between 1 and 100", v)
+		}
+		t.quality = q
+	}
+	return t, nil
+}
+
+// orDefault returns v, or def if v is zero.
+func orDefault(v, def int) int {
+	if v == 0 {
+		return def
+	}
+	return v
+}
+
+// serveImage serves the variant of the image the request asks for,
+// producing and caching it if it isn't cached yet.
+func (h *MinioStaticHTML) serveImage(w http.ResponseWriter, r *http.Request, bucket, objectKey string) error {
+	t, err := h.Images.parseTransform(r)
+	if err != nil {
+		return caddyhttp.Error(http.StatusBadRequest, err)
+	}
+	// Under :vary: so purging the object purges its variants.
+	variantKey := h.GlobalConfig.cacheKeyFor(r.Context(), bucket, objectKey) + ":vary:img:" + t.key()
+
+	if h.cacheEnabled() {
+		raw, err := getOne(r.Context(), h.cache, variantKey)
+		if err == nil {
+			var obj CachedObject
+			if json.Unmarshal(raw, &obj) == nil && !obj.expired(time.Now()) {
+				h.observeCache(cacheHit)
+				h.writeGenerated(w, r, &obj)
+				return nil
+			}
+		}
+	}
+
+	_, source, err := h.objectContent(r.Context(), bucket, objectKey)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "" {
+			return caddyhttp.Error(http.StatusBadGateway, err)
+		}
+		h.handleMinioError(w, r, err)
+		return nil
+	}
+	contentType, out, err := transformImage(source, t)
+	if err != nil {
+		return caddyhttp.Error(http.StatusUnsupportedMediaType, fmt.Errorf("transforming %s: %w", objectKey, err))
+	}
+	etag := sha256.Sum256(out)
+	now := time.Now()
+	ttl := h.routeTTL(r, contentType)
+	obj := CachedObject{
+		ContentType:  contentType,
+		ETag:         `"` + hex.EncodeToString(etag[:16]) + `"`,
+		LastModified: now,
+		Size:         int64(len(out)),
+		Content:      out,
+		CachedAt:     now,
+		ExpiresAt:    now.Add(ttl),
+	}
+	if h.cacheEnabled() && ttl > 0 {
+		data, err := json.Marshal(obj)
+		if err == nil {
+			h.writeCache(r.Context(), func(ctx context.Context) {
+				if err := h.cache.Set(ctx, h.jitterTTL(ttl), CacheItem{variantKey, data}); err != nil {
+					h.logger.Error("failed to SET image variant in cache", zap.String("key", variantKey), zap.Error(err))
+					h.observeRedisError("set")
+				}
+			})
+		}
+	}
+	h.writeGenerated(w, r, &obj)
+	return nil
+}
+
+// transformImage decodes source, scales it as t asks and encodes it,
+// returning the content type and content of the result. GIFs are encoded
+// as PNG unless t asks for JPEG, as only their first frame is kept.
+func transformImage(source []byte, t imageTransform) (string, []byte, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(source))
+	if err != nil {
+		return "", nil, err
+	}
+	if cfg.Width*cfg.Height > maxImagePixels {
+		return "", nil, fmt.Errorf("image of %dx%d is too large", cfg.Width, cfg.Height)
+	}
+	src, _, err := image.Decode(bytes.NewReader(source))
+	if err != nil {
+		return "", nil, err
+	}
+
+	width, height := fitWithin(cfg.Width, cfg.Height, t.width, t.height)
+	img := src
+	if width != cfg.Width || height != cfg.Height {
+		img = scaleDown(src, width, height)
+	}
+
+	if t.format == "" {
+		t.format = format
+		if format == "gif" {
+			t.format = "png"
+		}
+	}
+	var buf bytes.Buffer
+	switch t.format {
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: t.quality})
+	case "webp":
+		err = nativewebp.Encode(&buf, img, nil)
+	default:
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	return "image/" + t.format, buf.Bytes(), nil
+}
+
+// fitWithin returns the size of a width by height image scaled down to fit
+// within maxWidth by maxHeight, either of which may be zero for no limit.
+func fitWithin(width, height, maxWidth, maxHeight int) (int, int) {
+	scale := 1.0
+	if maxWidth > 0 && maxWidth < width {
+		scale = float64(maxWidth) / float64(width)
+	}
+	if maxHeight > 0 && maxHeight < height {
+		scale = min(scale, float64(maxHeight)/float64(height))
+	}
+	if scale == 1 {
+		return width, height
+	}
+	return max(1, int(float64(width)*scale+0.5)), max(1, int(float64(height)*scale+0.5))
+}
+
+// scaleDown resizes src to width by height, averaging the source pixels
+// each destination pixel covers.
+func scaleDown(src image.Image, width, height int) *image.RGBA {
+	bounds := src.Bounds()
+	rgba, ok := src.(*image.RGBA)
+	if !ok || bounds.Min != (image.Point{}) {
+		rgba = image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+		draw.Draw(rgba, rgba.Bounds(), src, bounds.Min, draw.Src)
+	}
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		y0 := y * srcH / height
+		y1 := max(y0+1, (y+1)*srcH/height)
+		for x := range width {
+			x0 := x * srcW / width
+			x1 := max(x0+1, (x+1)*srcW/width)
+			var r, g, b, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				row := rgba.Pix[sy*rgba.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r += uint32(p[0])
+					g += uint32(p[1])
+					b += uint32(p[2])
+					a += uint32(p[3])
+					n++
+				}
+			}
+			d := dst.Pix[y*dst.Stride+x*4:]
+			d[0], d[1], d[2], d[3] = uint8(r/n), uint8(g/n), uint8(b/n), uint8(a/n)
+		}
+	}
+	return dst
+}
@@ -0,0 +1,113 @@
+package miniohandler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"go.uber.org/zap"
+)
+
+// defaultListKeys is the page size of the listing API when max_keys is
+// not configured.
+const defaultListKeys = 1000
+
+// ListAPI answers requests for Path with a JSON page of the objects under
+// a prefix, so browser apps can enumerate a bucket without credentials:
+//
+//	GET <path>?prefix=docs/&limit=100&cursor=<next>&recursive=true
+//
+// Without recursive, the prefix's subdirectories are listed as entries
+// with is_dir set instead of their contents. The response's "next", when
+// present, is the cursor of the following page.
+type ListAPI struct {
+	// The request path answered with listings, such as "/_list".
+	// (Required)
+	Path string `json:"path,omitempty"`
+
+	// The largest page returned, and the default size (default 1000).
+	MaxKeys int `json:"max_keys,omitempty"`
+}
+
+// listPage is a page of the listing API.
+type listPage struct {
+	Prefix string     `json:"prefix"`
+	Items  []listItem `json:"items"`
+	Next   string     `json:"next,omitempty"`
+}
+
+// validate checks the listing API settings.
+func (l *ListAPI) validate() error {
+	if !strings.HasPrefix(l.Path, "/") {
+		return fmt.Errorf("path must start with /")
+	}
+	if l.MaxKeys < 0 {
+		return fmt.Errorf("max_keys must not be negative")
+	}
+	return nil
+}
+
+// serveListAPI answers a listing API request for bucket.
+func (h *MinioStaticHTML) serveListAPI(w http.ResponseWriter, r *http.Request, bucket string) error {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		return caddyhttp.Error(http.StatusMethodNotAllowed, fmt.Errorf("method not allowed: %v", r.Method))
+	}
+	query := r.URL.Query()
+	prefix := strings.TrimPrefix(query.Get("prefix"), "/")
+	cursor := query.Get("cursor")
+	if strings.Contains(prefix, "..") || h.hidden(strings.TrimSuffix(prefix, "/")) {
+		return caddyhttp.Error(http.StatusBadRequest, errors.New("invalid prefix"))
+	}
+	if cursor != "" && !strings.HasPrefix(cursor, prefix) {
+		return caddyhttp.Error(http.StatusBadRequest, errors.New("cursor does not belong to prefix"))
+	}
+
+	maxKeys := h.ListAPI.MaxKeys
+	if maxKeys == 0 {
+		maxKeys = defaultListKeys
+	}
+	limit := maxKeys
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return caddyhttp.Error(http.StatusBadRequest, errors.New("limit must be a positive integer"))
+		}
+		limit = min(n, maxKeys)
+	}
+	recursive, _ := strconv.ParseBool(query.Get("recursive"))
+
+	items, truncated, err := h.listPrefix(r.Context(), bucket, prefix, cursor, limit, recursive)
+	if err != nil {
+		h.logger.Error("failed to list objects",
+			zap.String("bucket", bucket),
+			zap.String("prefix", prefix),
+			zap.Error(err))
+		return caddyhttp.Error(http.StatusBadGateway, fmt.Errorf("listing objects: %w", err))
+	}
+	page := listPage{Prefix: prefix, Items: items}
+	if page.Items == nil {
+		page.Items = []listItem{}
+	}
+	if truncated {
+		// A directory's contents sort after it, so the next page starts
+		// after the last key it could hold rather than after its name.
+		last := items[len(items)-1]
+		page.Next = last.Key
+		if last.IsDir {
+			page.Next += string(utf8.MaxRune)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	if r.Method == http.MethodHead {
+		return nil
+	}
+	return json.NewEncoder(w).Encode(page)
+}
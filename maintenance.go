@@ -0,0 +1,130 @@
+package miniohandler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+)
+
+// Defaults of the maintenance mode settings.
+const (
+	defaultMaintenancePrefix  = "minio-maintenance:"
+	defaultMaintenanceRetry   = 300
+	defaultMaintenanceRefresh = time.Second
+)
+
+// Maintenance answers every request with 503 while a flag is set in the
+// cache, so operators can take a site down for maintenance, and bring it
+// back, without reloading the config. Any value other than "", "0",
+// "false" or "off" sets the flag.
+type Maintenance struct {
+	// The cache key of the flag (default "minio-maintenance:<bucket>").
+	// May contain placeholders.
+	Key string `json:"key,omitempty"`
+
+	// The object served with the 503, from the request's bucket. Without
+	// one a plain-text response is sent.
+	Object string `json:"object,omitempty"`
+
+	// The Retry-After sent, in seconds (default 300).
+	RetryAfter int `json:"retry_after,omitempty"`
+
+	// How long the flag is remembered before it is read again (default
+	// 1s).
+	Refresh string `json:"refresh,omitempty"`
+
+	refresh time.Duration
+	flags   sync.Map // key -> cachedFlag
+}
+
+// cachedFlag is a maintenance flag as last read from the cache.
+type cachedFlag struct {
+	on      bool
+	fetched time.Time
+}
+
+// provision applies defaults and parses refresh.
+func (m *Maintenance) provision() error {
+	if m.RetryAfter == 0 {
+		m.RetryAfter = defaultMaintenanceRetry
+	}
+	m.refresh = defaultMaintenanceRefresh
+	if m.Refresh != "" {
+		dur, err := time.ParseDuration(m.Refresh)
+		if err != nil {
+			return fmt.Errorf("invalid refresh: %w", err)
+		}
+		m.refresh = dur
+	}
+	return nil
+}
+
+// validate checks the maintenance settings.
+func (m *Maintenance) validate() error {
+	if err := validatePageKey(m.Object); err != nil {
+		return fmt.Errorf("object: %w", err)
+	}
+	if m.RetryAfter < 0 {
+		return fmt.Errorf("retry_after must not be negative")
+	}
+	return nil
+}
+
+// serveMaintenance answers r with 503 if the bucket is in maintenance,
+// reporting whether it did.
+func (h *MinioStaticHTML) serveMaintenance(w http.ResponseWriter, r *http.Request, repl *caddy.Replacer, bucket string) bool {
+	m := h.Maintenance
+	if m == nil || h.cache == nil {
+		return false
+	}
+	key := defaultMaintenancePrefix + bucket
+	if m.Key != "" {
+		key = repl.ReplaceAll(m.Key, "")
+	}
+	if !h.maintenanceOn(r.Context(), key) {
+		return false
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(m.RetryAfter))
+	if h.servePage(w, r, http.StatusServiceUnavailable, bucket, strings.TrimPrefix(m.Object, "/")) {
+		return true
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	http.Error(w, "Service Unavailable: down for maintenance", http.StatusServiceUnavailable)
+	return true
+}
+
+// maintenanceOn reports whether the flag at key is set, read from the
+// cache at most once per refresh. If the cache can't be read, the flag's
+// last state is kept, or it is taken to be clear.
+func (h *MinioStaticHTML) maintenanceOn(ctx context.Context, key string) bool {
+	m := h.Maintenance
+	last, ok := m.flags.Load(key)
+	if ok && time.Since(last.(cachedFlag).fetched) < m.refresh {
+		return last.(cachedFlag).on
+	}
+	raw, err := getOne(ctx, h.cache, key)
+	if err != nil && !errors.Is(err, errCacheMiss) {
+		h.logger.Debug("failed to read maintenance flag", zap.String("key", key), zap.Error(err))
+		return ok && last.(cachedFlag).on
+	}
+	on := false
+	switch strings.ToLower(strings.TrimSpace(string(raw))) {
+	case "", "0", "false", "off":
+	default:
+		on = true
+	}
+	if on != (ok && last.(cachedFlag).on) {
+		h.logger.Info("maintenance mode changed", zap.String("key", key), zap.Bool("on", on))
+	}
+	m.flags.Store(key, cachedFlag{on, time.Now()})
+	return on
+}
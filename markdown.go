@@ -0,0 +1,231 @@
+package miniohandler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/minio/minio-go/v7"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	gmhtml "github.com/yuin/goldmark/renderer/html"
+	"go.uber.org/zap"
+)
+
+// Markdown renders Markdown objects to HTML pages, so a bucket of
+// Markdown is published as a site with no build step. Pages are rendered
+// with goldmark, as CommonMark with the GitHub extensions (tables, task
+// lists, strikethrough and autolinks) and raw HTML. The rendered page is
+// cached along with the object, and purged with it.
+type Markdown struct {
+	// The extensions of the objects rendered (default [".md",
+	// ".markdown"]).
+	Extensions []string `json:"extensions,omitempty"`
+
+	// An object in the bucket holding the html/template the page is laid
+	// out with, in place of the built-in one. It is executed with a
+	// markdownPage.
+	Layout string `json:"layout,omitempty"`
+}
+
+// markdownPage is the data a Markdown layout is executed with.
+type markdownPage struct {
+	// The page's title: its front matter's title, else its first
+	// heading, else its file name.
+	Title string
+
+	// The rendered Markdown.
+	Content template.HTML
+
+	// The request path and the object key of the page.
+	Path string
+	Key  string
+}
+
+// validate checks the Markdown settings.
+func (m *Markdown) validate() error {
+	for i, ext := range m.Extensions {
+		if !strings.HasPrefix(ext, ".") {
+			return fmt.Errorf("extensions[%d]: %q must start with a dot", i, ext)
+		}
+	}
+	if err := validatePageKey(m.Layout); err != nil {
+		return fmt.Errorf("layout: %w", err)
+	}
+	return nil
+}
+
+// renders reports whether objectKey is rendered as Markdown.
+func (m *Markdown) renders(objectKey string) bool {
+	ext := strings.ToLower(path.Ext(objectKey))
+	if len(m.Extensions) == 0 {
+		return ext == ".md" || ext == ".markdown"
+	}
+	return slices.ContainsFunc(m.Extensions, func(e string) bool { return strings.EqualFold(e, ext) })
+}
+
+// markdownRequested reports whether r is for an object rendered as
+// Markdown.
+func (h *MinioStaticHTML) markdownRequested(r *http.Request, objectKey string) bool {
+	return h.Markdown != nil && h.Markdown.renders(objectKey) &&
+		(r.Method == http.MethodGet || r.Method == http.MethodHead)
+}
+
+// serveMarkdown serves the object rendered to an HTML page.
+func (h *MinioStaticHTML) serveMarkdown(w http.ResponseWriter, r *http.Request, bucket, objectKey string) error {
+	// Under :vary: so purging the object purges its rendering.
+	renderKey := h.GlobalConfig.cacheKeyFor(r.Context(), bucket, objectKey) + ":vary:md"
+	if h.cacheEnabled() {
+		raw, err := getOne(r.Context(), h.cache, renderKey)
+		if err == nil {
+			var obj CachedObject
+			if json.Unmarshal(raw, &obj) == nil && !obj.expired(time.Now()) {
+				h.observeCache(cacheHit)
+				writeRendered(w, r, obj.ContentType, obj.Content)
+				return nil
+			}
+		}
+	}
+
+	_, source, err := h.objectContent(r.Context(), bucket, objectKey)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "" {
+			return caddyhttp.Error(http.StatusBadGateway, err)
+		}
+		h.handleMinioError(w, r, err)
+		return nil
+	}
+	layout := defaultMarkdownLayout
+	if h.Markdown.Layout != "" {
+		layoutKey := strings.TrimPrefix(h.Markdown.Layout, "/")
+		_, text, err := h.objectContent(r.Context(), bucket, layoutKey)
+		if err != nil {
+			return caddyhttp.Error(http.StatusBadGateway, fmt.Errorf("fetching layout %s: %w", layoutKey, err))
+		}
+		if layout, err = template.New(path.Base(layoutKey)).Parse(string(text)); err != nil {
+			return caddyhttp.Error(http.StatusInternalServerError, fmt.Errorf("parsing layout %s: %w", layoutKey, err))
+		}
+	}
+
+	title, body := splitFrontMatter(string(source))
+	content, err := renderMarkdown(body)
+	if err != nil {
+		return caddyhttp.Error(http.StatusInternalServerError, fmt.Errorf("rendering %s: %w", objectKey, err))
+	}
+	if title == "" {
+		title = firstHeading(body)
+	}
+	if title == "" {
+		title = strings.TrimSuffix(path.Base(objectKey), path.Ext(objectKey))
+	}
+	var buf bytes.Buffer
+	err = layout.Execute(&buf, markdownPage{
+		Title:   title,
+		Content: template.HTML(content),
+		Path:    r.URL.Path,
+		Key:     objectKey,
+	})
+	if err != nil {
+		return caddyhttp.Error(http.StatusInternalServerError, fmt.Errorf("executing layout: %w", err))
+	}
+
+	const contentType = "text/html; charset=utf-8"
+	if ttl := h.routeTTL(r, contentType); h.cacheEnabled() && ttl > 0 {
+		now := time.Now()
+		data, err := json.Marshal(CachedObject{
+			ContentType: contentType,
+			Size:        int64(buf.Len()),
+			Content:     buf.Bytes(),
+			CachedAt:    now,
+			ExpiresAt:   now.Add(ttl),
+		})
+		if err == nil {
+			h.writeCache(r.Context(), func(ctx context.Context) {
+				if err := h.cache.Set(ctx, h.jitterTTL(ttl), CacheItem{renderKey, data}); err != nil {
+					h.logger.Error("failed to SET rendered Markdown in cache", zap.String("key", renderKey), zap.Error(err))
+					h.observeRedisError("set")
+				}
+			})
+		}
+	}
+	writeRendered(w, r, contentType, buf.Bytes())
+	return nil
+}
+
+// splitFrontMatter strips a leading "---" front matter block from a
+// document, returning the title it sets, if any, and the rest.
+func splitFrontMatter(doc string) (string, string) {
+	doc = strings.TrimPrefix(doc, "\ufeff")
+	rest, ok := strings.CutPrefix(doc, "---\n")
+	if !ok {
+		return "", doc
+	}
+	front, body, ok := strings.Cut(rest, "\n---\n")
+	if !ok {
+		return "", doc
+	}
+	for _, line := range strings.Split(front, "\n") {
+		if value, ok := strings.CutPrefix(line, "title:"); ok {
+			return strings.Trim(strings.TrimSpace(value), `"'`), body
+		}
+	}
+	return "", body
+}
+
+// firstHeading returns the text of a document's first level 1 heading.
+func firstHeading(doc string) string {
+	for _, line := range strings.Split(doc, "\n") {
+		if text, ok := strings.CutPrefix(line, "# "); ok {
+			return strings.TrimSpace(strings.TrimRight(text, "# "))
+		}
+	}
+	return ""
+}
+
+// markdownRenderer renders Markdown as Caddy's markdown template function
+// does: CommonMark with the GitHub extensions, heading IDs, and raw HTML
+// passed through.
+var markdownRenderer = goldmark.New(
+	goldmark.WithExtensions(extension.GFM, extension.Footnote),
+	goldmark.WithParserOptions(parser.WithAutoHeadingID()),
+	goldmark.WithRendererOptions(gmhtml.WithUnsafe()),
+)
+
+// renderMarkdown renders a Markdown document to HTML.
+func renderMarkdown(doc string) (string, error) {
+	var buf bytes.Buffer
+	if err := markdownRenderer.Convert([]byte(doc), &buf); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// defaultMarkdownLayout is the built-in page Markdown is rendered into.
+var defaultMarkdownLayout = template.Must(template.New("markdown").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+body { font-family: system-ui, sans-serif; line-height: 1.6; max-width: 46em; margin: 2em auto; padding: 0 1em; }
+pre { background: #f5f5f5; padding: 1em; overflow-x: auto; }
+code { font-size: .9em; }
+blockquote { border-left: 4px solid #ddd; margin-left: 0; padding-left: 1em; color: #555; }
+img { max-width: 100%; }
+</style>
+</head>
+<body>
+{{.Content}}
+</body>
+</html>
+`))
@@ -0,0 +1,171 @@
+package miniohandler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/minio/minio-go/v7"
+	"go.uber.org/zap"
+)
+
+func init() {
+	caddy.RegisterModule(MatchObjectExists{})
+}
+
+// MatchObjectExists matches requests whose object exists in a bucket, the
+// object key being the request path minus PathPrefix as in the handler's
+// path mode. It lets a route serve from MinIO only what the bucket has and
+// send everything else elsewhere, such as to an application server:
+//
+//	@static minio_object_exists mybucket
+//	handle @static {
+//		minio_static_html
+//	}
+//	reverse_proxy app:8080
+//
+// The object is looked up in the cache first, so that the objects the
+// handler serves, and those it recorded as missing, cost no request to
+// MinIO.
+type MatchObjectExists struct {
+	// The bucket to look in. Placeholders are expanded per request.
+	// (Required)
+	Bucket string `json:"bucket,omitempty"`
+
+	// The prefix stripped from the request path to make the object key.
+	PathPrefix string `json:"path_prefix,omitempty"`
+
+	// Selects one of the global config's named endpoints. If empty, the
+	// default endpoint is used.
+	EndpointName string `json:"endpoint_name,omitempty"`
+
+	config *MinioConfig
+	client *minio.Client
+	logger *zap.Logger
+}
+
+// CaddyModule returns the Caddy module information for the matcher.
+func (MatchObjectExists) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.matchers.minio_object_exists",
+		New: func() caddy.Module { return new(MatchObjectExists) },
+	}
+}
+
+// Provision sets up the matcher's MinIO client.
+func (m *MatchObjectExists) Provision(ctx caddy.Context) error {
+	m.logger = ctx.Logger()
+
+	val, err := ctx.App("minio.config")
+	if err != nil {
+		return fmt.Errorf("the 'minio.config' app is not loaded; please configure it globally")
+	}
+	m.config = val.(*MinioConfigModule).MinioConfig
+
+	ep, err := m.config.endpoint(m.EndpointName)
+	if err != nil {
+		return err
+	}
+	creds, err := ep.credentials()
+	if err != nil {
+		return fmt.Errorf("failed to initialize MinIO credentials: %w", err)
+	}
+	m.client, err = ep.newClient(ep.Endpoint, creds)
+	if err != nil {
+		return fmt.Errorf("failed to initialize MinIO client: %w", err)
+	}
+	return nil
+}
+
+// Validate ensures a bucket is configured.
+func (m *MatchObjectExists) Validate() error {
+	if m.Bucket == "" {
+		return fmt.Errorf("bucket must be specified")
+	}
+	return nil
+}
+
+// MatchWithError reports whether the object mapped from the request path
+// exists. Errors other than the object not existing abort the request.
+func (m *MatchObjectExists) MatchWithError(r *http.Request) (bool, error) {
+	if strings.Contains(r.URL.Path, "..") {
+		return false, nil
+	}
+	repl := r.Context().Value(caddy.ReplacerCtxKey).(*caddy.Replacer)
+	bucket := repl.ReplaceAll(m.Bucket, "")
+	if bucket == "" {
+		return false, nil
+	}
+	objectKey := objectKeyForPath(r.URL.Path, repl.ReplaceAll(m.PathPrefix, ""))
+
+	if m.config.cacheAvailable() {
+		cacheKey := m.config.cacheKeyFor(r.Context(), bucket, objectKey)
+		raw, err := getOne(r.Context(), m.config.cache, cacheKey)
+		if err == nil {
+			var obj CachedObject
+			if json.Unmarshal(raw, &obj) == nil {
+				return !obj.Missing, nil
+			}
+		} else if !errors.Is(err, errCacheMiss) {
+			m.logger.Debug("cache lookup failed; asking MinIO",
+				zap.String("key", cacheKey),
+				zap.Error(err))
+		}
+	}
+
+	_, err := m.client.StatObject(r.Context(), bucket, objectKey, minio.StatObjectOptions{})
+	if err == nil {
+		return true, nil
+	}
+	if code := minio.ToErrorResponse(err).Code; code == "NoSuchKey" || code == "NoSuchBucket" {
+		return false, nil
+	}
+	return false, caddyhttp.Error(http.StatusBadGateway, fmt.Errorf("checking object %s/%s: %w", bucket, objectKey, err))
+}
+
+// UnmarshalCaddyfile sets up the matcher from Caddyfile tokens. Syntax:
+//
+//	minio_object_exists [<bucket>] {
+//		bucket        <bucket>
+//		path_prefix   <prefix>
+//		endpoint_name <name>
+//	}
+func (m *MatchObjectExists) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	for d.Next() {
+		if d.NextArg() {
+			m.Bucket = d.Val()
+		}
+		if d.NextArg() {
+			return d.ArgErr()
+		}
+		for nesting := d.Nesting(); d.NextBlock(nesting); {
+			option := d.Val()
+			if !d.NextArg() {
+				return d.ArgErr()
+			}
+			switch option {
+			case "bucket":
+				m.Bucket = d.Val()
+			case "path_prefix":
+				m.PathPrefix = d.Val()
+			case "endpoint_name":
+				m.EndpointName = d.Val()
+			default:
+				return d.Errf("unrecognized minio_object_exists option '%s'", option)
+			}
+		}
+	}
+	return nil
+}
+
+var (
+	_ caddy.Provisioner                 = (*MatchObjectExists)(nil)
+	_ caddy.Validator                   = (*MatchObjectExists)(nil)
+	_ caddyhttp.RequestMatcherWithError = (*MatchObjectExists)(nil)
+	_ caddyfile.Unmarshaler             = (*MatchObjectExists)(nil)
+)
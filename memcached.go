@@ -0,0 +1,402 @@
+package miniohandler
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func init() {
+	caddy.RegisterModule(new(MemcachedBackend))
+}
+
+const (
+	// defaultMemcachedTimeout bounds each memcached operation.
+	defaultMemcachedTimeout = 500 * time.Millisecond
+
+	// defaultMemcachedIdleConns is how many idle connections are kept
+	// per server.
+	defaultMemcachedIdleConns = 8
+
+	// memcachedMaxKeyLength is the longest key memcached accepts.
+	memcachedMaxKeyLength = 250
+
+	// memcachedMaxRelativeTTL is the longest expiry memcached takes as a
+	// duration; longer ones must be given as a Unix time.
+	memcachedMaxRelativeTTL = 30 * 24 * time.Hour
+)
+
+// MemcachedBackend caches in a fleet of memcached servers, spreading keys
+// across them by consistent hashing.
+//
+// Memcached can't list its keys, so DeletePrefix isn't supported: purging
+// a single object removes its entry, which is what requests look up first,
+// but leaves encoded and vary variants to expire, and purging by prefix
+// fails.
+type MemcachedBackend struct {
+	// Addresses (host:port) of the memcached servers. Required.
+	Servers []string `json:"servers,omitempty"`
+
+	// Timeout of each operation. Default: 500ms.
+	Timeout string `json:"timeout,omitempty"`
+
+	// Idle connections kept open per server. Default: 8.
+	MaxIdleConns int `json:"max_idle_conns,omitempty"`
+
+	timeout time.Duration
+	ring    hashRing
+	pools   map[string]*memcachedPool
+}
+
+// memcachedPool holds idle connections to one server.
+type memcachedPool struct {
+	addr    string
+	timeout time.Duration
+	idle    chan *memcachedConn
+}
+
+// memcachedConn is a connection to a memcached server.
+type memcachedConn struct {
+	net.Conn
+	rw *bufio.ReadWriter
+}
+
+// CaddyModule returns the Caddy module information for the backend.
+func (*MemcachedBackend) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "minio_static_html.cache.memcached",
+		New: func() caddy.Module { return new(MemcachedBackend) },
+	}
+}
+
+// Provision sets up a connection pool per server. Connections are made
+// when first needed.
+func (m *MemcachedBackend) Provision(caddy.Context) error {
+	m.timeout = defaultMemcachedTimeout
+	if m.Timeout != "" {
+		dur, err := time.ParseDuration(m.Timeout)
+		if err != nil {
+			return fmt.Errorf("invalid timeout: %w", err)
+		}
+		m.timeout = dur
+	}
+	idle := m.MaxIdleConns
+	if idle == 0 {
+		idle = defaultMemcachedIdleConns
+	}
+	m.pools = make(map[string]*memcachedPool, len(m.Servers))
+	for _, addr := range m.Servers {
+		m.pools[addr] = &memcachedPool{addr: addr, timeout: m.timeout, idle: make(chan *memcachedConn, idle)}
+	}
+	m.ring.set(m.Servers)
+	return nil
+}
+
+// Validate checks the server list.
+func (m *MemcachedBackend) Validate() error {
+	if len(m.Servers) == 0 {
+		return fmt.Errorf("servers must be specified")
+	}
+	if m.MaxIdleConns < 0 {
+		return fmt.Errorf("max_idle_conns must not be negative")
+	}
+	if m.timeout <= 0 {
+		return fmt.Errorf("timeout must be positive")
+	}
+	return nil
+}
+
+// Cleanup closes the idle connections.
+func (m *MemcachedBackend) Cleanup() error {
+	for _, pool := range m.pools {
+		for len(pool.idle) > 0 {
+			(<-pool.idle).Close()
+		}
+	}
+	return nil
+}
+
+// String describes the backend for log messages.
+func (m *MemcachedBackend) String() string {
+	return "memcached " + strings.Join(m.Servers, ",")
+}
+
+// memcachedKey returns the key to store key under: key itself if memcached
+// accepts it, otherwise a hash of it.
+func memcachedKey(key string) string {
+	valid := len(key) <= memcachedMaxKeyLength
+	for i := 0; valid && i < len(key); i++ {
+		valid = key[i] > ' ' && key[i] != 0x7f
+	}
+	if valid {
+		return key
+	}
+	sum := sha256.Sum256([]byte(key))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// memcachedExpiry converts ttl to memcached's exptime, rounding up to
+// whole seconds.
+func memcachedExpiry(ttl time.Duration) int64 {
+	switch {
+	case ttl <= 0:
+		return 0
+	case ttl > memcachedMaxRelativeTTL:
+		return time.Now().Add(ttl).Unix()
+	}
+	return int64((ttl + time.Second - 1) / time.Second)
+}
+
+// get takes an idle connection or dials a new one.
+func (p *memcachedPool) get(ctx context.Context) (*memcachedConn, error) {
+	select {
+	case conn := <-p.idle:
+		return conn, nil
+	default:
+	}
+	dialer := net.Dialer{Timeout: p.timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", p.addr)
+	if err != nil {
+		return nil, err
+	}
+	return &memcachedConn{conn, bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))}, nil
+}
+
+// put returns a healthy connection to the pool.
+func (p *memcachedPool) put(conn *memcachedConn) {
+	select {
+	case p.idle <- conn:
+	default:
+		conn.Close()
+	}
+}
+
+// with runs fn on a connection to the server addr. The connection is
+// discarded if fn fails, as it may be left mid-response.
+func (m *MemcachedBackend) with(ctx context.Context, addr string, fn func(*memcachedConn) error) error {
+	pool := m.pools[addr]
+	conn, err := pool.get(ctx)
+	if err != nil {
+		return fmt.Errorf("memcached %s: %w", addr, err)
+	}
+	deadline := time.Now().Add(m.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+	if err := fn(conn); err != nil {
+		conn.Close()
+		return fmt.Errorf("memcached %s: %w", addr, err)
+	}
+	pool.put(conn)
+	return nil
+}
+
+// byServer groups the indexes of keys by the server they belong to, along
+// with their memcached keys.
+func (m *MemcachedBackend) byServer(keys []string) (map[string][]int, []string) {
+	mkeys := make([]string, len(keys))
+	for i, key := range keys {
+		mkeys[i] = memcachedKey(key)
+	}
+	return m.ring.group(mkeys), mkeys
+}
+
+// readLine reads a response line without its CRLF.
+func (c *memcachedConn) readLine() (string, error) {
+	line, err := c.rw.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(line, "\r\n"), nil
+}
+
+// command sends a single-line command and returns the reply line.
+func (c *memcachedConn) command(format string, args ...any) (string, error) {
+	fmt.Fprintf(c.rw, format+"\r\n", args...)
+	if err := c.rw.Flush(); err != nil {
+		return "", err
+	}
+	return c.readLine()
+}
+
+// Get fetches keys with one multi-key get per server.
+func (m *MemcachedBackend) Get(ctx context.Context, keys ...string) ([][]byte, error) {
+	values := make([][]byte, len(keys))
+	groups, mkeys := m.byServer(keys)
+	for addr, idx := range groups {
+		want := make(map[string][]int, len(idx))
+		names := make([]string, 0, len(idx))
+		for _, i := range idx {
+			if _, ok := want[mkeys[i]]; !ok {
+				names = append(names, mkeys[i])
+			}
+			want[mkeys[i]] = append(want[mkeys[i]], i)
+		}
+		err := m.with(ctx, addr, func(c *memcachedConn) error {
+			fmt.Fprintf(c.rw, "get %s\r\n", strings.Join(names, " "))
+			if err := c.rw.Flush(); err != nil {
+				return err
+			}
+			for {
+				line, err := c.readLine()
+				if err != nil {
+					return err
+				}
+				if line == "END" {
+					return nil
+				}
+				// VALUE <key> <flags> <bytes>
+				fields := strings.Fields(line)
+				if len(fields) < 4 || fields[0] != "VALUE" {
+					return fmt.Errorf("unexpected reply %q", line)
+				}
+				n, err := strconv.Atoi(fields[3])
+				if err != nil {
+					return fmt.Errorf("unexpected reply %q", line)
+				}
+				data := make([]byte, n+2)
+				if _, err := io.ReadFull(c.rw, data); err != nil {
+					return err
+				}
+				for _, i := range want[fields[1]] {
+					values[i] = data[:n]
+				}
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// Set stores each item on the server it belongs to. Memcached has no
+// transactions, so a failure may leave some items stored.
+func (m *MemcachedBackend) Set(ctx context.Context, ttl time.Duration, items ...CacheItem) error {
+	keys := make([]string, len(items))
+	for i, item := range items {
+		keys[i] = item.Key
+	}
+	groups, mkeys := m.byServer(keys)
+	exptime := memcachedExpiry(ttl)
+	for addr, idx := range groups {
+		err := m.with(ctx, addr, func(c *memcachedConn) error {
+			// Pipeline the sets, then read the replies.
+			for _, i := range idx {
+				fmt.Fprintf(c.rw, "set %s 0 %d %d\r\n", mkeys[i], exptime, len(items[i].Value))
+				c.rw.Write(items[i].Value)
+				c.rw.WriteString("\r\n")
+			}
+			if err := c.rw.Flush(); err != nil {
+				return err
+			}
+			for range idx {
+				line, err := c.readLine()
+				if err != nil {
+					return err
+				}
+				if line != "STORED" {
+					return fmt.Errorf("set: %s", line)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Expire renews keys with touch.
+func (m *MemcachedBackend) Expire(ctx context.Context, ttl time.Duration, keys ...string) error {
+	exptime := memcachedExpiry(ttl)
+	_, err := m.eachKey(ctx, keys, func(key string) string { return fmt.Sprintf("touch %s %d", key, exptime) }, "TOUCHED")
+	return err
+}
+
+// Exists counts the keys present using the meta get command with no flags,
+// which reports a hit without returning the value. It needs memcached 1.6
+// or later.
+func (m *MemcachedBackend) Exists(ctx context.Context, keys ...string) (int64, error) {
+	return m.eachKey(ctx, keys, func(key string) string { return "mg " + key }, "HD")
+}
+
+// Delete removes keys.
+func (m *MemcachedBackend) Delete(ctx context.Context, keys ...string) (int64, error) {
+	return m.eachKey(ctx, keys, func(key string) string { return "delete " + key }, "DELETED")
+}
+
+// eachKey sends a pipelined command per key to the server it belongs to,
+// counting the replies equal to hit. Any other reply must report the key
+// missing.
+func (m *MemcachedBackend) eachKey(ctx context.Context, keys []string, command func(string) string, hit string) (int64, error) {
+	var n int64
+	groups, mkeys := m.byServer(keys)
+	for addr, idx := range groups {
+		err := m.with(ctx, addr, func(c *memcachedConn) error {
+			for _, i := range idx {
+				fmt.Fprintf(c.rw, "%s\r\n", command(mkeys[i]))
+			}
+			if err := c.rw.Flush(); err != nil {
+				return err
+			}
+			for range idx {
+				line, err := c.readLine()
+				if err != nil {
+					return err
+				}
+				switch line {
+				case hit:
+					n++
+				case "NOT_FOUND", "EN":
+				default:
+					return fmt.Errorf("unexpected reply %q", line)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// DeletePrefix is not supported, as memcached can't list its keys.
+func (m *MemcachedBackend) DeletePrefix(context.Context, string) (int64, error) {
+	return 0, fmt.Errorf("memcached cannot delete keys by prefix: %w", errors.ErrUnsupported)
+}
+
+// Ping checks that every server answers.
+func (m *MemcachedBackend) Ping(ctx context.Context) error {
+	var errs []error
+	for _, addr := range m.Servers {
+		errs = append(errs, m.with(ctx, addr, func(c *memcachedConn) error {
+			line, err := c.command("version")
+			if err == nil && !strings.HasPrefix(line, "VERSION") {
+				err = fmt.Errorf("unexpected reply %q", line)
+			}
+			return err
+		}))
+	}
+	return errors.Join(errs...)
+}
+
+var (
+	_ caddy.Provisioner  = (*MemcachedBackend)(nil)
+	_ caddy.Validator    = (*MemcachedBackend)(nil)
+	_ caddy.CleanerUpper = (*MemcachedBackend)(nil)
+	_ CacheBackend       = (*MemcachedBackend)(nil)
+)
@@ -0,0 +1,151 @@
+package miniohandler
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memStore is an in-memory key/value store with per-key expiry, evicting
+// the least recently used entries once their values take up more than
+// maxSize bytes.
+type memStore struct {
+	maxSize int64
+
+	mu    sync.Mutex
+	index map[string]*list.Element // values are *memEntry
+	lru   *list.List               // most recently used first
+	size  int64
+}
+
+// memEntry is a value held by a memStore.
+type memEntry struct {
+	key     string
+	value   []byte
+	expires time.Time // zero if the entry never expires
+}
+
+// newMemStore returns an empty store holding up to maxSize bytes.
+func newMemStore(maxSize int64) *memStore {
+	return &memStore{
+		maxSize: maxSize,
+		index:   make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// lookup returns the live entry for key, marking it as recently used, or
+// nil. Expired entries are removed. s.mu must be held.
+func (s *memStore) lookup(key string, now time.Time) *memEntry {
+	el, ok := s.index[key]
+	if !ok {
+		return nil
+	}
+	entry := el.Value.(*memEntry)
+	if !entry.expires.IsZero() && now.After(entry.expires) {
+		s.remove(el)
+		return nil
+	}
+	s.lru.MoveToFront(el)
+	return entry
+}
+
+// remove drops an entry. s.mu must be held.
+func (s *memStore) remove(el *list.Element) {
+	entry := s.lru.Remove(el).(*memEntry)
+	delete(s.index, entry.key)
+	s.size -= int64(len(entry.value))
+}
+
+// get returns the values of keys, nil for those missing.
+func (s *memStore) get(keys []string) [][]byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	values := make([][]byte, len(keys))
+	now := time.Now()
+	for i, key := range keys {
+		if entry := s.lookup(key, now); entry != nil {
+			values[i] = entry.value
+		}
+	}
+	return values
+}
+
+// set stores items, expiring after ttl, or never if ttl is zero.
+func (s *memStore) set(ttl time.Duration, items []CacheItem) {
+	var expires time.Time
+	if ttl > 0 {
+		expires = time.Now().Add(ttl)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, item := range items {
+		entry := &memEntry{key: item.Key, value: item.Value, expires: expires}
+		if el, ok := s.index[item.Key]; ok {
+			s.size -= int64(len(el.Value.(*memEntry).value))
+			el.Value = entry
+			s.lru.MoveToFront(el)
+		} else {
+			s.index[item.Key] = s.lru.PushFront(entry)
+		}
+		s.size += int64(len(item.Value))
+	}
+	for s.size > s.maxSize && s.lru.Len() > 0 {
+		s.remove(s.lru.Back())
+	}
+}
+
+// expire sets the expiry of the keys that exist to ttl from now.
+func (s *memStore) expire(ttl time.Duration, keys []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for _, key := range keys {
+		if entry := s.lookup(key, now); entry != nil {
+			entry.expires = now.Add(ttl)
+		}
+	}
+}
+
+// exists counts the live keys.
+func (s *memStore) exists(keys []string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	now := time.Now()
+	for _, key := range keys {
+		if s.lookup(key, now) != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// delete removes keys, returning how many existed.
+func (s *memStore) delete(keys []string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for _, key := range keys {
+		if el, ok := s.index[key]; ok {
+			s.remove(el)
+			n++
+		}
+	}
+	return n
+}
+
+// deletePrefix removes every key starting with prefix.
+func (s *memStore) deletePrefix(prefix string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for key, el := range s.index {
+		if strings.HasPrefix(key, prefix) {
+			s.remove(el)
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,119 @@
+package miniohandler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/minio/minio-go/v7"
+	"go.uber.org/zap"
+)
+
+// userMetadataPrefix is the header prefix S3 uses for user metadata.
+const userMetadataPrefix = "X-Amz-Meta-"
+
+// setMetadataHeaders copies the user metadata keys listed in
+// metadata_headers from an object's metadata to the response, named with
+// metadata_header_prefix.
+func (h *MinioStaticHTML) setMetadataHeaders(w http.ResponseWriter, userMetadata map[string]string) {
+	if len(h.MetadataHeaders) == 0 || len(userMetadata) == 0 {
+		return
+	}
+	for _, name := range h.MetadataHeaders {
+		key := http.CanonicalHeaderKey(name)
+		key = strings.TrimPrefix(key, userMetadataPrefix)
+		if value, ok := userMetadata[key]; ok {
+			w.Header().Set(h.MetadataHeaderPrefix+key, value)
+		}
+	}
+}
+
+// objectMetadata is the metadata_api response: an object's metadata and
+// the state of its cached copy.
+type objectMetadata struct {
+	Bucket       string            `json:"bucket"`
+	Key          string            `json:"key"`
+	VersionID    string            `json:"version_id,omitempty"`
+	Size         int64             `json:"size"`
+	ETag         string            `json:"etag"`
+	ContentType  string            `json:"content_type"`
+	LastModified time.Time         `json:"last_modified"`
+	UserMetadata map[string]string `json:"user_metadata,omitempty"`
+	Cache        *cacheMetadata    `json:"cache,omitempty"`
+}
+
+// cacheMetadata describes an object's cache entry.
+type cacheMetadata struct {
+	Key         string    `json:"key"`
+	ETag        string    `json:"etag"`
+	CachedAt    time.Time `json:"cached_at,omitzero"`
+	ExpiresAt   time.Time `json:"expires_at,omitzero"`
+	StaleUntil  time.Time `json:"stale_until,omitzero"`
+	Invalidated bool      `json:"invalidated,omitempty"`
+	Missing     bool      `json:"missing,omitempty"`
+}
+
+// metadataRequested reports whether r asks for an object's metadata with
+// ?meta=1 and metadata_api is enabled.
+func (h *MinioStaticHTML) metadataRequested(r *http.Request) bool {
+	return h.MetadataAPI && h.HtmlFile == "" && r.URL.Query().Get("meta") == "1" &&
+		(r.Method == http.MethodGet || r.Method == http.MethodHead)
+}
+
+// serveMetadata answers with the metadata MinIO holds for an object,
+// along with its cache entry if there is one, without the body.
+func (h *MinioStaticHTML) serveMetadata(w http.ResponseWriter, r *http.Request, bucket, objectKey, versionID string) error {
+	info, err := h.client.StatObject(r.Context(), bucket, objectKey, minio.StatObjectOptions{
+		VersionID:            versionID,
+		ServerSideEncryption: h.sse,
+	})
+	if err != nil {
+		code := minio.ToErrorResponse(err).Code
+		return caddyhttp.Error(h.statusForMinioError(code), fmt.Errorf("stat object: %w", err))
+	}
+	meta := objectMetadata{
+		Bucket:       bucket,
+		Key:          objectKey,
+		VersionID:    info.VersionID,
+		Size:         info.Size,
+		ETag:         strings.Trim(info.ETag, `"`),
+		ContentType:  info.ContentType,
+		LastModified: info.LastModified,
+		UserMetadata: info.UserMetadata,
+	}
+
+	if h.cacheEnabled() {
+		cacheKey := h.GlobalConfig.cacheKeyFor(r.Context(), bucket, objectKey)
+		if versionID != "" {
+			cacheKey = versionCacheKey(cacheKey, versionID)
+		}
+		raw, err := getOne(r.Context(), h.cache, cacheKey)
+		if err == nil {
+			var obj CachedObject
+			if json.Unmarshal(raw, &obj) == nil {
+				meta.Cache = &cacheMetadata{
+					Key:         cacheKey,
+					ETag:        strings.Trim(obj.ETag, `"`),
+					CachedAt:    obj.CachedAt,
+					ExpiresAt:   obj.ExpiresAt,
+					StaleUntil:  obj.StaleUntil,
+					Invalidated: obj.Invalidated,
+					Missing:     obj.Missing,
+				}
+			}
+		} else if !errors.Is(err, errCacheMiss) {
+			h.logger.Debug("failed to read cache entry for metadata", zap.String("key", cacheKey), zap.Error(err))
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if r.Method == http.MethodHead {
+		return nil
+	}
+	return json.NewEncoder(w).Encode(meta)
+}
@@ -0,0 +1,136 @@
+package miniohandler
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Values of the "result" label on the cache request counter.
+const (
+	cacheHit    = "hit"
+	cacheMiss   = "miss"
+	cacheBypass = "bypass"
+)
+
+// minioMetrics holds the collectors shared by every handler instance. They
+// are created once and registered with each new config's registry.
+var minioMetrics = struct {
+	once          sync.Once
+	cacheRequests *prometheus.CounterVec
+	originLatency *prometheus.HistogramVec
+	bytesServed   *prometheus.CounterVec
+	redisErrors   *prometheus.CounterVec
+	redisUp       prometheus.Gauge
+
+	cacheWritesDropped prometheus.Counter
+}{}
+
+func initMetrics(registry *prometheus.Registry) {
+	const ns, sub = "caddy", "minio"
+
+	minioMetrics.once.Do(func() {
+		minioMetrics.cacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: ns,
+			Subsystem: sub,
+			Name:      "cache_requests_total",
+			Help:      "Requests handled, partitioned by cache result (hit, miss or bypass).",
+		}, []string{"bucket", "result"})
+		minioMetrics.originLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: ns,
+			Subsystem: sub,
+			Name:      "origin_fetch_duration_seconds",
+			Help:      "Time taken to fetch an object from MinIO.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"bucket"})
+		minioMetrics.bytesServed = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: ns,
+			Subsystem: sub,
+			Name:      "bytes_served_total",
+			Help:      "Response body bytes written, partitioned by source (cache or origin).",
+		}, []string{"bucket", "source"})
+		minioMetrics.redisErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: ns,
+			Subsystem: sub,
+			Name:      "redis_errors_total",
+			Help:      "Errors returned by DragonflyDB/Redis, partitioned by operation.",
+		}, []string{"bucket", "op"})
+		minioMetrics.redisUp = prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: ns,
+			Subsystem: sub,
+			Name:      "redis_up",
+			Help:      "Whether the DragonflyDB/Redis cache is reachable (1) or not (0).",
+		})
+		minioMetrics.cacheWritesDropped = prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: ns,
+			Subsystem: sub,
+			Name:      "cache_writes_dropped_total",
+			Help:      "Cache writes dropped because the async write queue was full.",
+		})
+	})
+
+	// Every config reload gets a fresh registry, and several handlers may
+	// register against the same one, so duplicate registration is expected.
+	for _, c := range []prometheus.Collector{
+		minioMetrics.cacheRequests,
+		minioMetrics.originLatency,
+		minioMetrics.bytesServed,
+		minioMetrics.redisErrors,
+		minioMetrics.redisUp,
+		minioMetrics.cacheWritesDropped,
+	} {
+		if err := registry.Register(c); err != nil &&
+			!errors.Is(err, prometheus.AlreadyRegisteredError{ExistingCollector: c, NewCollector: c}) {
+			panic(err)
+		}
+	}
+}
+
+// observeCache counts a request against the given cache result. Metrics are
+// labelled with the configured bucket rather than the per-request one, so
+// placeholders don't create a series per tenant.
+func (h *MinioStaticHTML) observeCache(result string) {
+	minioMetrics.cacheRequests.WithLabelValues(h.Bucket, result).Inc()
+	counters := countersFor(h.Bucket)
+	switch result {
+	case cacheHit:
+		counters.hits.Add(1)
+	case cacheMiss:
+		counters.misses.Add(1)
+	case cacheBypass:
+		counters.bypasses.Add(1)
+	}
+}
+
+// observeRedisError counts a failed DragonflyDB/Redis operation.
+func (h *MinioStaticHTML) observeRedisError(op string) {
+	minioMetrics.redisErrors.WithLabelValues(h.Bucket, op).Inc()
+}
+
+// setRedisUp records the cache connection state.
+func setRedisUp(up bool) {
+	if up {
+		minioMetrics.redisUp.Set(1)
+	} else {
+		minioMetrics.redisUp.Set(0)
+	}
+}
+
+// countingWriter tallies the body bytes written through it.
+type countingWriter struct {
+	*caddyhttp.ResponseWriterWrapper
+	n int64
+}
+
+func newCountingWriter(w http.ResponseWriter) *countingWriter {
+	return &countingWriter{ResponseWriterWrapper: &caddyhttp.ResponseWriterWrapper{ResponseWriter: w}}
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.ResponseWriterWrapper.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
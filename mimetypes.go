@@ -0,0 +1,52 @@
+package miniohandler
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// genericContentTypes are stored types that say nothing about the content,
+// as set by upload tools that don't know better.
+var genericContentTypes = map[string]bool{
+	"":                         true,
+	"binary/octet-stream":      true,
+	"application/octet-stream": true,
+}
+
+// validateMimeTypes checks mime_types keys are extensions and values parse.
+func (h *MinioStaticHTML) validateMimeTypes() error {
+	for ext, contentType := range h.MimeTypes {
+		if !strings.HasPrefix(ext, ".") {
+			return fmt.Errorf("mime_types: extension %q must start with a dot", ext)
+		}
+		if _, _, err := mime.ParseMediaType(contentType); err != nil {
+			return fmt.Errorf("mime_types: invalid type for %s: %w", ext, err)
+		}
+	}
+	return nil
+}
+
+// fixContentType corrects objInfo.ContentType for objectKey before it is
+// cached or served: mime_types overrides it by extension, and with
+// sniff_content_type a missing or generic type is replaced by the one for
+// the key's extension or, failing that, one detected from content.
+func (h *MinioStaticHTML) fixContentType(objectKey string, objInfo *minio.ObjectInfo, content []byte) {
+	ext := strings.ToLower(path.Ext(objectKey))
+	if contentType, ok := h.MimeTypes[ext]; ok {
+		objInfo.ContentType = contentType
+		return
+	}
+	if !h.SniffContentType || !genericContentTypes[strings.ToLower(objInfo.ContentType)] {
+		return
+	}
+	if contentType := mime.TypeByExtension(ext); ext != "" && contentType != "" {
+		objInfo.ContentType = contentType
+		return
+	}
+	objInfo.ContentType = http.DetectContentType(content[:min(len(content), 512)])
+}
@@ -8,32 +8,98 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/netip"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/caddyserver/caddy/v2"
 	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
 	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
 	"github.com/minio/minio-go/v7"
-	"github.com/minio/minio-go/v7/pkg/credentials"
-	"github.com/redis/go-redis/v9"
+	"github.com/minio/minio-go/v7/pkg/encrypt"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 )
 
 // Register the modules with Caddy.
 func init() {
-	caddy.RegisterModule(MinioStaticHTML{})
+	caddy.RegisterModule(new(MinioStaticHTML))
 	caddy.RegisterModule(MinioConfigModule{})
 }
 
 // MinioStaticHTML is a Caddy HTTP handler that serves files from a MinIO bucket.
 type MinioStaticHTML struct {
 	// The MinIO bucket to serve files from. (Required)
+	//
+	// Bucket, PathPrefix and HtmlFile may contain placeholders such as
+	// {http.request.host}, which are expanded on every request.
 	Bucket string `json:"bucket,omitempty"`
 
+	// Maps request hostnames to buckets so one handler can serve many
+	// sites. Keys are exact hostnames or patterns where "*" matches a
+	// single label, e.g. "*.example.com". Hosts without an entry fall back
+	// to Bucket, which becomes optional when a map is configured.
+	BucketMap map[string]string `json:"bucket_map,omitempty"`
+
+	// Buckets tried in order for objects missing from the request's
+	// bucket, such as a shared base bucket under per-tenant overrides.
+	// Objects found missing are recorded in the cache so later requests
+	// skip straight to the bucket that has them. May contain
+	// placeholders.
+	FallbackBuckets []string `json:"fallback_buckets,omitempty"`
+
+	// A cache key holding the current release, such as
+	// "releases/2024-06-01", which prefixes every object key. Flipping
+	// it switches the whole site at once, and flipping it back rolls it
+	// back. It is read at most once per ReleaseRefresh (default 1s) and
+	// may contain placeholders.
+	ReleaseKey     string `json:"release_key,omitempty"`
+	ReleaseRefresh string `json:"release_refresh,omitempty"`
+
+	// Splits visitors between two variants of the content, see
+	// Experiment.
+	Experiment *Experiment `json:"experiment,omitempty"`
+
+	// Serves HTML pages in the language of Languages the client prefers
+	// most, according to Accept-Language, if a translation exists:
+	// index.fr.html for index.html with the "suffix" LanguageLayout (the
+	// default), or fr/index.html with "directory".
+	Languages      []string `json:"languages,omitempty"`
+	LanguageLayout string   `json:"language_layout,omitempty"`
+
+	// Puts the site in maintenance while a flag is set in the cache, see
+	// Maintenance.
+	Maintenance *Maintenance `json:"maintenance,omitempty"`
+
+	// Renders HTML objects as templates before serving them, see
+	// Templates.
+	Templates *Templates `json:"templates,omitempty"`
+
+	// Renders Markdown objects to HTML pages, see Markdown.
+	Markdown *Markdown `json:"markdown,omitempty"`
+
+	// HTML fragments inserted into every HTML document fetched, before it
+	// is cached, see Snippet.
+	Snippets []Snippet `json:"snippets,omitempty"`
+
+	// Replaces %%TOKEN%% in HTML and JavaScript objects at serve time,
+	// see Substitute.
+	Substitute *Substitute `json:"substitute,omitempty"`
+
+	// Resizes and converts images as query parameters such as ?w=400
+	// ask, see Images.
+	Images *Images `json:"images,omitempty"`
+
+	// Serves HLS and DASH playlists and segments with their own TTLs,
+	// streaming segments, see Streaming.
+	Streaming *Streaming `json:"streaming,omitempty"`
+
 	// An optional path prefix to strip from the request URI before looking
-	// up the object in the bucket.
+	// up the object in the bucket. Only used in path mode, i.e. when
+	// HtmlFile is empty.
 	PathPrefix string `json:"path_prefix,omitempty"`
 
 	// The duration for which to cache objects in DragonflyDB/Redis.
@@ -41,27 +107,444 @@ type MinioStaticHTML struct {
 	// Examples: "1h", "30m", "5m30s". If empty, the global default is used.
 	CacheTTL string `json:"cache_ttl,omitempty"`
 
+	// The maximum time to spend fetching an object from MinIO, e.g. "5s".
+	// Requests that exceed it get a 504 instead of waiting on a hung
+	// object store. If empty, MinIO requests are only bounded by the
+	// client connection.
+	RequestTimeout string `json:"request_timeout,omitempty"`
+
+	// How many times to retry a MinIO fetch that failed with a transient
+	// error, waiting RetryDelay (default 100ms) before the first retry and
+	// doubling the wait each time. RetryCodes lists the S3 error codes and
+	// HTTP statuses that count as transient; by default 500, 502, 503,
+	// 504, InternalError, ServiceUnavailable, SlowDown and RequestTimeout.
+	// Network errors are always retried. All attempts share the
+	// request_timeout.
+	Retries    int      `json:"retries,omitempty"`
+	RetryDelay string   `json:"retry_delay,omitempty"`
+	RetryCodes []string `json:"retry_codes,omitempty"`
+
+	// If the endpoint has replicas, send the same fetch to the next replica
+	// whenever this long (e.g. "50ms") passes without a response, and use
+	// whichever answers first. This trades extra load on the object store
+	// for lower tail latency. Disabled if empty.
+	HedgeDelay string `json:"hedge_delay,omitempty"`
+
+	// Respond with a 302 to a presigned GET URL, valid for PresignExpiry
+	// (default 15m), instead of proxying the object. Large downloads then
+	// bypass Caddy and the cache entirely; the MinIO endpoint must be
+	// reachable by clients.
+	PresignRedirect bool   `json:"presign_redirect,omitempty"`
+	PresignExpiry   string `json:"presign_expiry,omitempty"`
+
+	// Serve a specific version of objects in a versioned bucket. VersionID
+	// may contain placeholders. If VersionQuery names a query parameter
+	// (e.g. "versionId"), its value takes precedence, letting clients
+	// request historical revisions such as for rollback previews.
+	VersionID    string `json:"version_id,omitempty"`
+	VersionQuery string `json:"version_query,omitempty"`
+
+	// The object holding Netlify-style redirect rules, e.g. "_redirects".
+	// It is loaded from each bucket at startup (or on first use for
+	// buckets chosen per request) and reloaded every RedirectsRefresh
+	// (default 1m). Rules are applied before the object lookup; status
+	// 200 rules rewrite to another object. The file itself is not served.
+	RedirectsFile    string `json:"redirects_file,omitempty"`
+	RedirectsRefresh string `json:"redirects_refresh,omitempty"`
+
+	// The object holding Netlify-style per-path response headers, e.g.
+	// "_headers". It is loaded and refreshed like RedirectsFile, every
+	// HeadersRefresh (default 1m). Matching headers replace those the
+	// handler would otherwise send. The file itself is not served.
+	HeadersFile    string `json:"headers_file,omitempty"`
+	HeadersRefresh string `json:"headers_refresh,omitempty"`
+
+	// The object holding a JSON manifest of the critical assets of each
+	// page, e.g. "preload.json", see parsePreload. GET requests for HTML
+	// pages get a 103 Early Hints response with Link preload headers for
+	// them, which the final response repeats. It is loaded and refreshed
+	// like RedirectsFile, every PreloadRefresh (default 1m), and not
+	// served itself.
+	PreloadFile    string `json:"preload_file,omitempty"`
+	PreloadRefresh string `json:"preload_refresh,omitempty"`
+
+	// Response headers added to everything this route serves, replacing
+	// any the handler would set itself (such as Cache-Control). Values may
+	// contain placeholders. Headers from HeadersFile take precedence.
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// User metadata keys to send as response headers, e.g.
+	// "content-language" for x-amz-meta-content-language. Each header is
+	// named MetadataHeaderPrefix followed by the key, so with a prefix of
+	// "X-Meta-" it becomes X-Meta-Content-Language.
+	MetadataHeaders      []string `json:"metadata_headers,omitempty"`
+	MetadataHeaderPrefix string   `json:"metadata_header_prefix,omitempty"`
+
+	// Content-Disposition rules by request path, to force downloads
+	// (attachment) or display (inline) and set the download file name.
+	// The first matching rule wins; otherwise the object's own
+	// Content-Disposition metadata is sent, if it has any.
+	ContentDisposition []DispositionRule `json:"content_disposition,omitempty"`
+
+	// Surrogate keys (cache tags) to index the cache entries of matching
+	// request paths under, in addition to any in an object's
+	// X-Amz-Meta-Surrogate-Key metadata, for purging by tag.
+	SurrogateKeys []SurrogateKeyRule `json:"surrogate_keys,omitempty"`
+
+	// Request headers that responses vary by, for instance because a
+	// placeholder selects the object from one. Their values become part of
+	// the cache key and they are listed in the Vary response header, along
+	// with Accept-Encoding when precompressed or encode is set.
+	Vary []string `json:"vary,omitempty"`
+
+	// Adds the query string and/or request headers to the cache key, for
+	// pages that vary by them.
+	CacheKey *CacheKeyConfig `json:"cache_key,omitempty"`
+
+	// Lets clients skip the cache read, e.g. with ?nocache=1 and a secret
+	// token. The object is still fetched into the cache.
+	CacheBypass *CacheBypass `json:"cache_bypass,omitempty"`
+
+	// Encodings to look for precompressed sidecar objects in, in order of
+	// preference: "br" (<key>.br), "zstd" (<key>.zst) and "gzip"
+	// (<key>.gz). If the client accepts one and the sidecar exists, it is
+	// served with that Content-Encoding instead of the plain object.
+	Precompressed []string `json:"precompressed,omitempty"`
+
+	// Image formats to look for sidecar objects in, in order of
+	// preference: "avif" (<key>.avif) and "webp" (<key>.webp). A JPEG, PNG
+	// or GIF requested by a client whose Accept header names one is served
+	// from the sidecar if it exists, and Accept is added to Vary.
+	ImageFormats []string `json:"image_formats,omitempty"`
+
+	// Encodings to compress responses with on the fly, in order of
+	// preference: "zstd" and/or "gzip". Only types matching the global
+	// compress_types and at least compress_min_size are compressed. Each
+	// compressed variant is cached beside the object, so an object is
+	// compressed once per encoding per TTL rather than on every request.
+	Encode []string `json:"encode,omitempty"`
+
+	// Content types by file extension (e.g. ".wasm": "application/wasm"),
+	// replacing whatever type objects were stored with.
+	MimeTypes map[string]string `json:"mime_types,omitempty"`
+
+	// Replace a missing or generic stored content type, such as
+	// binary/octet-stream, with the standard type for the object's
+	// extension or else one sniffed from its first 512 bytes.
+	SniffContentType bool `json:"sniff_content_type,omitempty"`
+
+	// Controls the Cache-Control header sent to browsers. If unset, every
+	// response gets "public, max-age=<cache_ttl>" while caching is enabled.
+	BrowserCacheControl *BrowserCacheControl `json:"browser_cache_control,omitempty"`
+
+	// Per-object TTLs by content type or request path, e.g. a day for
+	// images, a minute for HTML and nothing for /api/*. The first matching
+	// rule wins; objects matching none use cache_ttl.
+	TTLRules []TTLRule `json:"ttl_rules,omitempty"`
+
+	// Keep cache entries this long after their TTL runs out. An expired
+	// entry is revalidated with MinIO by ETag, so an unchanged object isn't
+	// downloaded again, and is served stale if MinIO can't be reached.
+	StaleTTL string `json:"stale_ttl,omitempty"`
+
+	// Randomize each cache entry's TTL by up to this many percent either
+	// way, so pages cached together during a deploy don't all expire in the
+	// same second and stampede MinIO. Default 0 (off).
+	TTLJitter int `json:"ttl_jitter,omitempty"`
+
+	// Derive each object's DragonflyDB TTL from its own Cache-Control
+	// (s-maxage or max-age) or Expires metadata, so content owners control
+	// cache lifetime at upload time. no-store, no-cache and private keep an
+	// object out of the cache. Derived TTLs are clamped to MinCacheTTL and
+	// MaxCacheTTL when set; objects without such metadata use TTLRules or
+	// cache_ttl.
+	RespectObjectCacheControl bool   `json:"respect_object_cache_control,omitempty"`
+	MinCacheTTL               string `json:"min_cache_ttl,omitempty"`
+	MaxCacheTTL               string `json:"max_cache_ttl,omitempty"`
+
+	// A base64-encoded 256-bit customer key (SSE-C) sent with every MinIO
+	// request, for serving objects encrypted with it. Placeholders such as
+	// {env.SSE_KEY} are expanded once at startup. SSE-C requires a secure
+	// endpoint and cannot be combined with presign_redirect.
+	SSECustomerKey string `json:"sse_customer_key,omitempty"`
+
+	// The base name of a single page to serve for every request, e.g.
+	// "index" for index.html. If empty, the handler runs in path mode and
+	// the request path selects the object; directory paths get their
+	// index.html.
 	HtmlFile string `json:"html_file,omitempty"`
 
-	client       *minio.Client
-	logger       *zap.Logger
-	redisClient  *redis.Client
-	cacheTTL     time.Duration
+	// Hands requests for objects that don't exist to the next handler
+	// instead of responding 404, so bucket content can overlay another
+	// site, as file_server's pass_thru does.
+	PassThru bool `json:"pass_thru,omitempty"`
+
+	// Keeps URLs canonical, as file_server does: with CanonicalURIs, a
+	// request for "/dir" that has no object of its own but whose
+	// directory has an index.html is redirected to "/dir/". With
+	// RedirectIndex, requests for "/page/index.html" are redirected to
+	// "/page/". Both redirects are 308s. Neither applies with html_file.
+	CanonicalURIs bool `json:"canonical_uris,omitempty"`
+	RedirectIndex bool `json:"redirect_index,omitempty"`
+
+	// Lists the contents of directories that have no index.html, as HTML
+	// or JSON. Listings are built from MinIO on every request.
+	Browse *Browse `json:"browse,omitempty"`
+
+	// Serves JSON listings of the bucket's objects at a path of its own,
+	// see ListAPI.
+	ListAPI *ListAPI `json:"list_api,omitempty"`
+
+	// Lets directories be downloaded as zip or tar.gz archives, see
+	// Archive.
+	Archive *Archive `json:"archive,omitempty"`
+
+	// Exposes the bucket as a read-only WebDAV share: OPTIONS and
+	// PROPFIND are answered, and GET and HEAD served as usual, through the
+	// cache.
+	WebDAV bool `json:"webdav,omitempty"`
+
+	// Accepts PUT and multipart POST uploads into the bucket, see Upload.
+	// Guard the route with authentication.
+	Upload *Upload `json:"upload,omitempty"`
+
+	// Lets DELETE requests remove the object they name and purge its
+	// cached copy. Guard the route with authentication.
+	AllowDelete bool `json:"allow_delete,omitempty"`
+
+	// Answers GET and HEAD requests with ?meta=1 with the object's
+	// metadata and the state of its cache entry as JSON, instead of the
+	// object.
+	MetadataAPI bool `json:"metadata_api,omitempty"`
+
+	// An object served with a 404 status for objects that don't exist,
+	// in place of the global not_found_file, so the page ships with the
+	// site. It is looked up in the request's bucket, or NotFoundBucket if
+	// set, and cached like other objects. Both accept placeholders.
+	NotFoundObject string `json:"not_found_object,omitempty"`
+	NotFoundBucket string `json:"not_found_bucket,omitempty"`
+
+	// Objects served as the body of error responses, keyed by status code
+	// ("403") or class ("4xx", "5xx"), such as "errors/500.html". Like
+	// not_found_object, which takes precedence for 404s, they are looked
+	// up in the request's bucket, or ErrorBucket if set, and cached.
+	ErrorPages  map[string]string `json:"error_pages,omitempty"`
+	ErrorBucket string            `json:"error_bucket,omitempty"`
+
+	// MinIO errors are answered with the closest HTTP status, such as 403
+	// for AccessDenied and 503 for SlowDown. NoSuchBucketStatus chooses 404
+	// (the default) or 502 for a missing bucket, which may be a
+	// misconfiguration rather than a missing page. ExposeErrorCode sends
+	// the S3 error code in an X-Minio-Error-Code header, for debugging.
+	NoSuchBucketStatus int  `json:"no_such_bucket_status,omitempty"`
+	ExposeErrorCode    bool `json:"expose_error_code,omitempty"`
+
+	// Glob patterns of object keys answered with 404 without asking
+	// MinIO, so control files and secrets uploaded by mistake are never
+	// served. A pattern without a slash matches any path segment. Unset,
+	// it hides .git/*, *.env, _headers and _redirects; an empty list
+	// hides nothing.
+	Hide []string `json:"hide"`
+
+	// Restricts the route to object keys matching one of these patterns:
+	// extensions such as ".css", or globs matched against the file name
+	// ("*.html") or, if they contain a slash, the whole key. Other keys are
+	// answered with 403 without asking MinIO.
+	Allow []string `json:"allow,omitempty"`
+
+	// Enables the PURGE method, which evicts the cached copy of the object
+	// the request would otherwise be served. A PURGE is accepted if it
+	// carries PurgeToken in the X-Purge-Token header or comes from an
+	// address in PurgeAllowlist (IPs or CIDR ranges). If neither is set,
+	// PURGE requests are rejected.
+	PurgeToken     string   `json:"purge_token,omitempty"`
+	PurgeAllowlist []string `json:"purge_allowlist,omitempty"`
+
+	// Checks that Bucket exists while provisioning. "fail" rejects the
+	// config, "warn" only logs, and "off" (the default) skips the check.
+	ValidateBucket string `json:"validate_bucket,omitempty"`
+
+	// Selects one of the global config's named endpoints. If empty, the
+	// default endpoint is used.
+	EndpointName string `json:"endpoint_name,omitempty"`
+
+	// Connection settings that override the global (or named) endpoint for
+	// this route only, e.g. to serve a bucket from another S3 account.
+	// Setting Endpoint also replaces Secure; credentials are replaced only
+	// when AccessKey is set, and the region only when Region is set.
+	Endpoint  string `json:"endpoint,omitempty"`
+	AccessKey string `json:"access_key,omitempty"`
+	SecretKey string `json:"secret_key,omitempty"`
+	Secure    bool   `json:"secure,omitempty"`
+	Region    string `json:"region,omitempty"`
+
+	// An object in the bucket listing keys to fetch into the cache when
+	// the app starts, so a freshly deployed node doesn't serve its first
+	// requests from a cold cache: a JSON array, or one key per line with
+	// # comments. Up to WarmupConcurrency objects (default 4) are fetched
+	// at a time. Objects already cached are skipped.
+	WarmupManifest    string `json:"warmup_manifest,omitempty"`
+	WarmupConcurrency int    `json:"warmup_concurrency,omitempty"`
+
+	// Keeps objects perpetually cached by re-fetching them every
+	// RefreshInterval if their entry is missing or would expire before
+	// the next run. The objects are RefreshKeys plus those listed in
+	// WarmupManifest.
+	RefreshInterval string   `json:"refresh_interval,omitempty"`
+	RefreshKeys     []string `json:"refresh_keys,omitempty"`
+
+	// Objects cached with no expiry, for pages that must never wait on
+	// MinIO: those whose keys match PinnedKeys (globs such as
+	// "index.html" or "landing/*") or are members of the cache set named
+	// PinnedSet, which can be maintained outside Caddy, e.g. with Redis
+	// SADD. Pinned entries are only replaced once purged, by the admin API,
+	// a PURGE request or a bucket notification.
+	PinnedKeys []string `json:"pinned_keys,omitempty"`
+	PinnedSet  string   `json:"pinned_set,omitempty"`
+
+	// Answers requests for HealthPath, such as "/healthz/minio", with 200
+	// while MinIO and the cache are reachable and 503 otherwise, so load
+	// balancers can drain a node that lost its object store. Both are
+	// probed in the background every HealthInterval (default 5s).
+	HealthPath     string `json:"health_path,omitempty"`
+	HealthInterval string `json:"health_interval,omitempty"`
+
+	purgeRanges   []netip.Prefix
+	exactHosts    map[string]string
+	wildcardHosts []hostRoute
+	client        *minio.Client
+	logger        *zap.Logger
+	cache         CacheBackend
+	cacheTTL      time.Duration
+
+	requestTimeout  time.Duration
+	retryDelay      time.Duration
+	hedgeDelay      time.Duration
+	minCacheTTL     time.Duration
+	maxCacheTTL     time.Duration
+	staleTTL        time.Duration
+	presignExpiry   time.Duration
+	refreshInterval time.Duration
+	pinnedSet       string
+
+	sse       encrypt.ServerSide
+	redirects *siteFile[[]redirectRule]
+	headers   *siteFile[[]headerRule]
+	preload   *siteFile[[]preloadRule]
+
+	// The endpoint's primary address followed by its replicas, in
+	// failover order. client is the primary's.
+	origins []*origin
+
+	// Emits cache and origin events, see events.go.
+	events *eventEmitter
+
+	// The last health_path probe result, see health.go.
+	health     *atomic.Pointer[healthStatus]
+	stopHealth func()
+
+	// The release_key pointers last read, see release.go.
+	releases       sync.Map // pointer -> cachedRelease
+	releaseRefresh time.Duration
+
+	// Stops the background renewal of assume_role credentials.
+	stopRefresh  func()
 	GlobalConfig *MinioConfig
 }
 
 // MinioConfig stores global settings shared by all handlers.
 type MinioConfig struct {
-	Endpoint        string `json:"endpoint,omitempty"`
-	AccessKey       string `json:"access_key,omitempty"`
-	SecretKey       string `json:"secret_key,omitempty"`
-	Secure          bool   `json:"secure,omitempty"`
-	ReddisAddress   string `json:"reddis_address,omitempty"`
+	// The default MinIO endpoint. Its fields appear at the top level of the
+	// JSON config.
+	MinioEndpoint
+
+	// Settings for the DragonflyDB/Redis cache, used unless Cache names
+	// another backend.
+	RedisOptions
+
 	NotFoundFile    string `json:"not_found_file,omitempty"`
 	DefaultCacheTTL string `json:"default_cache_ttl,omitempty"`
 	MaxCacheSize    int64  `json:"max_cache_size,omitempty"` // NEW: in bytes
 
-	redisClient *redis.Client `json:"-"`
+	// CacheRaw configures the cache backend as a module in the
+	// minio_static_html.cache namespace, chosen by its "backend" field, in
+	// place of the top-level redis options.
+	CacheRaw json.RawMessage `json:"cache,omitempty" caddy:"namespace=minio_static_html.cache inline_key=backend"`
+
+	// Additional MinIO deployments, selected by handlers through
+	// endpoint_name. The top-level endpoint settings above remain the
+	// default for handlers that don't name one.
+	Endpoints map[string]*MinioEndpoint `json:"endpoints,omitempty"`
+
+	// Objects larger than ChunkThreshold bytes are cached as a series of
+	// ChunkSize-byte keys instead of one blob, so Range requests only need
+	// to fetch the chunks they overlap. Zero disables chunking. Chunked
+	// objects are limited by MaxChunkedSize instead of MaxCacheSize.
+	ChunkThreshold int64 `json:"chunk_threshold,omitempty"`
+	ChunkSize      int64 `json:"chunk_size,omitempty"`       // default 1 MB
+	MaxChunkedSize int64 `json:"max_chunked_size,omitempty"` // default 512 MB
+
+	// CacheCompression compresses cached payloads with "zstd" or "snappy"
+	// before they are written to DragonflyDB. Only objects of at least
+	// CompressMinSize bytes whose Content-Type starts with one of
+	// CompressTypes are compressed.
+	CacheCompression string   `json:"cache_compression,omitempty"`
+	CompressMinSize  int64    `json:"compress_min_size,omitempty"` // default 1 KB
+	CompressTypes    []string `json:"compress_types,omitempty"`
+
+	// WatchBuckets lists buckets whose MinIO event notifications are
+	// consumed to purge cache entries as soon as objects are uploaded or
+	// deleted, instead of waiting for their TTL to expire.
+	WatchBuckets []string `json:"watch_buckets,omitempty"`
+
+	// CacheFailureMode controls what happens when DragonflyDB is
+	// unreachable. "strict" (the default) connects during Provision and
+	// refuses to start if that fails. "degrade" connects lazily once the app
+	// starts, serves every request from MinIO while the cache is down and
+	// reconnects with exponential backoff capped at CacheRetryInterval
+	// (default 10s), which is also how often a healthy cache is re-checked.
+	CacheFailureMode   string `json:"cache_failure_mode,omitempty"`
+	CacheRetryInterval string `json:"cache_retry_interval,omitempty"`
+
+	// BreakerThreshold enables a circuit breaker per MinIO endpoint that
+	// opens after this many consecutive origin failures (transport errors,
+	// timeouts and 5xx responses). While open, cache misses are answered
+	// with the not_found_file or a 503 instead of reaching MinIO; after
+	// BreakerCooldown (default 30s) a single probe request is let through
+	// and its outcome closes or re-opens the breaker. Cache hits are
+	// served as usual.
+	BreakerThreshold int    `json:"breaker_threshold,omitempty"`
+	BreakerCooldown  string `json:"breaker_cooldown,omitempty"`
+
+	// CacheWriteWorkers moves cache writes off the request path onto this
+	// many background goroutines, fed by a queue of CacheWriteQueue writes
+	// (default 1000). When the queue is full, CacheWriteOverflow decides
+	// whether a write is dropped ("drop", the default) or made by the
+	// request itself ("sync"). Zero keeps writes synchronous.
+	CacheWriteWorkers  int    `json:"cache_write_workers,omitempty"`
+	CacheWriteQueue    int    `json:"cache_write_queue,omitempty"`
+	CacheWriteOverflow string `json:"cache_write_overflow,omitempty"`
+
+	// CacheKeyPrefix replaces the "minio-cache" prefix of every cache key,
+	// and CacheNamespace adds a segment after it, such as "staging", so
+	// that several deployments can share one DragonflyDB. The namespace
+	// may be a placeholder like {env.DEPLOY_ENV}, expanded at startup.
+	CacheKeyPrefix string `json:"cache_key_prefix,omitempty"`
+	CacheNamespace string `json:"cache_namespace,omitempty"`
+
+	// CacheGenerations adds a generation to every cache key, stored per
+	// bucket in the cache. Starting a new generation through the admin API
+	// invalidates a whole bucket at once after a deploy, without deleting
+	// its keys first. Other nodes follow within a second.
+	CacheGenerations bool `json:"cache_generations,omitempty"`
+
+	cache       CacheBackend
+	keyPrefix   string
+	generations sync.Map // bucket -> cachedGeneration
+	cacheUp     atomic.Bool
+	cacheWriter atomic.Pointer[cacheWriter]
+	breakersMu  sync.Mutex
+	breakers    map[string]*breaker
 }
 
 // CachedObject defines the structure for storing objects in the cache.
@@ -71,10 +554,52 @@ type CachedObject struct {
 	LastModified time.Time
 	Size         int64
 	Content      []byte
+
+	// Set when the content is stored in separate chunk keys rather than
+	// inline in Content.
+	ChunkSize int64
+	Chunks    int
+
+	// Compression applied to Content (or to each chunk); empty if none.
+	Encoding string
+
+	// The object's website redirect target, if it has one.
+	RedirectLocation string
+
+	// The object's own Content-Disposition metadata, if any.
+	ContentDisposition string
+
+	// The object's user metadata, without the X-Amz-Meta- prefix.
+	UserMetadata map[string]string
+
+	// The Content-Encoding the content is served with, such as "br" for a
+	// precompressed sidecar. Unrelated to Encoding, which is internal.
+	ContentEncoding string
+
+	// Set for a marker recording that the object does not exist.
+	Missing bool
+
+	// When the entry was written and when its TTL ran out. Expired entries
+	// are kept until StaleUntil, stale_ttl later, so they can be
+	// revalidated or served stale.
+	CachedAt   time.Time
+	ExpiresAt  time.Time
+	StaleUntil time.Time
+
+	// Set by a soft purge: the entry is treated as expired, whatever its
+	// TTL, until it is revalidated or replaced.
+	Invalidated bool
+
+	// The surrogate keys the entry is indexed under.
+	SurrogateKeys []string
+
+	// Response headers set while rendering the content, such as by a
+	// template, replayed when it is served from the cache.
+	Header http.Header `json:",omitempty"`
 }
 
 // CaddyModule returns the Caddy module information for the handler.
-func (MinioStaticHTML) CaddyModule() caddy.ModuleInfo {
+func (*MinioStaticHTML) CaddyModule() caddy.ModuleInfo {
 	return caddy.ModuleInfo{
 		ID:  "http.handlers.minio_static_html",
 		New: func() caddy.Module { return new(MinioStaticHTML) },
@@ -84,6 +609,12 @@ func (MinioStaticHTML) CaddyModule() caddy.ModuleInfo {
 // Provision sets up the MinioStaticHTML module.
 func (h *MinioStaticHTML) Provision(ctx caddy.Context) error {
 	h.logger = ctx.Logger()
+	initMetrics(ctx.GetMetricsRegistry())
+	events, err := newEventEmitter(ctx)
+	if err != nil {
+		return err
+	}
+	h.events = events
 
 	// Load the shared global MinIO & DragonflyDB configuration
 	val, err := ctx.App("minio.config")
@@ -93,23 +624,170 @@ func (h *MinioStaticHTML) Provision(ctx caddy.Context) error {
 	cfg := val.(*MinioConfigModule)
 	h.GlobalConfig = cfg.MinioConfig // Store a reference to the global config
 
-	if h.Bucket == "" {
-		return fmt.Errorf("bucket must be specified")
+	if h.Bucket == "" && len(h.BucketMap) == 0 {
+		return fmt.Errorf("bucket or bucket_map must be specified")
 	}
+	h.provisionBucketMap()
 
-	// Initialize the MinIO client using the global configuration.
-	client, err := minio.New(cfg.Endpoint, &minio.Options{
-		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
-		Secure: cfg.Secure,
-	})
+	for _, expr := range h.PurgeAllowlist {
+		prefix, err := caddyhttp.CIDRExpressionToPrefix(expr)
+		if err != nil {
+			return fmt.Errorf("invalid purge_allowlist entry: %w", err)
+		}
+		h.purgeRanges = append(h.purgeRanges, prefix)
+	}
+
+	// Initialize the MinIO client using the global configuration, with any
+	// route-level overrides applied.
+	ep, err := h.resolveEndpoint(cfg.MinioConfig)
+	if err != nil {
+		return err
+	}
+	creds, err := ep.credentials()
 	if err != nil {
-		return fmt.Errorf("failed to initialize MinIO client: %w", err)
+		return fmt.Errorf("failed to initialize MinIO credentials: %w", err)
+	}
+	for _, addr := range ep.addresses() {
+		client, err := ep.newClient(addr, creds)
+		if err != nil {
+			return fmt.Errorf("failed to initialize MinIO client for %s: %w", addr, err)
+		}
+		h.origins = append(h.origins, &origin{
+			endpoint: addr,
+			client:   client,
+			breaker:  cfg.breakerFor(addr, ctx.Logger()),
+		})
+	}
+	h.client = h.origins[0].client
+	if ep.AssumeRole != nil {
+		h.stopRefresh = refreshCredentials(creds, h.logger)
+	}
+	if ep.anonymous() {
+		h.logger.Info("no MinIO credentials configured; using anonymous access",
+			zap.String("endpoint", ep.Endpoint))
+	}
+
+	if err := h.checkBucket(ctx); err != nil {
+		return err
+	}
+	if h.RedirectsFile != "" {
+		h.redirects, err = newSiteFile(h, h.RedirectsFile, h.RedirectsRefresh, parseRedirects)
+		if err != nil {
+			return fmt.Errorf("invalid redirects_refresh: %w", err)
+		}
+	}
+	if h.HeadersFile != "" {
+		h.headers, err = newSiteFile(h, h.HeadersFile, h.HeadersRefresh, parseHeaders)
+		if err != nil {
+			return fmt.Errorf("invalid headers_refresh: %w", err)
+		}
+	}
+	if h.PreloadFile != "" {
+		h.preload, err = newSiteFile(h, h.PreloadFile, h.PreloadRefresh, parsePreload)
+		if err != nil {
+			return fmt.Errorf("invalid preload_refresh: %w", err)
+		}
+	}
+
+	if h.RequestTimeout != "" {
+		dur, err := time.ParseDuration(h.RequestTimeout)
+		if err != nil {
+			return fmt.Errorf("invalid request_timeout: %w", err)
+		}
+		h.requestTimeout = dur
+	}
+
+	if err := h.provisionSSEC(); err != nil {
+		return err
+	}
+	for _, opt := range []struct {
+		name, value string
+		dst         *time.Duration
+	}{
+		{"min_cache_ttl", h.MinCacheTTL, &h.minCacheTTL},
+		{"max_cache_ttl", h.MaxCacheTTL, &h.maxCacheTTL},
+		{"stale_ttl", h.StaleTTL, &h.staleTTL},
+		{"refresh_interval", h.RefreshInterval, &h.refreshInterval},
+	} {
+		if opt.value == "" {
+			continue
+		}
+		dur, err := time.ParseDuration(opt.value)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", opt.name, err)
+		}
+		*opt.dst = dur
+	}
+	if err := h.provisionTTLRules(ctx); err != nil {
+		return err
+	}
+	if err := h.provisionDispositionRules(ctx); err != nil {
+		return err
+	}
+	if err := h.provisionSurrogateKeys(ctx); err != nil {
+		return err
+	}
+	if h.CacheBypass != nil {
+		h.CacheBypass.provision()
+	}
+	if h.BrowserCacheControl != nil {
+		if err := h.BrowserCacheControl.provision(); err != nil {
+			return fmt.Errorf("browser_cache_control: %w", err)
+		}
+	}
+	if h.Browse != nil {
+		if err := h.Browse.provision(); err != nil {
+			return fmt.Errorf("browse: %w", err)
+		}
+	}
+	if h.Experiment != nil {
+		if err := h.Experiment.provision(); err != nil {
+			return fmt.Errorf("experiment: %w", err)
+		}
+	}
+	if h.Maintenance != nil {
+		if err := h.Maintenance.provision(); err != nil {
+			return fmt.Errorf("maintenance: %w", err)
+		}
+	}
+	if h.Streaming != nil {
+		if err := h.provisionStreaming(); err != nil {
+			return fmt.Errorf("streaming: %w", err)
+		}
+	}
+	if err := h.provisionSnippets(); err != nil {
+		return err
+	}
+
+	h.retryDelay = defaultRetryDelay
+	if h.RetryDelay != "" {
+		dur, err := time.ParseDuration(h.RetryDelay)
+		if err != nil {
+			return fmt.Errorf("invalid retry_delay: %w", err)
+		}
+		h.retryDelay = dur
 	}
-	h.client = client
 
-	// Set up DragonflyDB client and parse TTL if configured
-	if cfg.redisClient != nil {
-		h.redisClient = cfg.redisClient
+	if h.HedgeDelay != "" {
+		dur, err := time.ParseDuration(h.HedgeDelay)
+		if err != nil {
+			return fmt.Errorf("invalid hedge_delay: %w", err)
+		}
+		h.hedgeDelay = dur
+	}
+
+	h.presignExpiry = defaultPresignExpiry
+	if h.PresignExpiry != "" {
+		dur, err := time.ParseDuration(h.PresignExpiry)
+		if err != nil {
+			return fmt.Errorf("invalid presign_expiry: %w", err)
+		}
+		h.presignExpiry = dur
+	}
+
+	// Set up the cache backend and parse TTL if configured
+	if cfg.cache != nil {
+		h.cache = cfg.cache
 
 		// Use per-route TTL if set, otherwise fall back to global default
 		ttlToParse := h.CacheTTL
@@ -130,6 +808,19 @@ func (h *MinioStaticHTML) Provision(ctx caddy.Context) error {
 		}
 	}
 
+	if err := h.provisionPinning(); err != nil {
+		return err
+	}
+	if err := h.provisionRelease(); err != nil {
+		return err
+	}
+	if (h.WarmupManifest != "" || h.refreshInterval > 0) && h.cache != nil {
+		cfg.addWarmup(h)
+	}
+	if h.HealthPath != "" {
+		h.startHealthProbes()
+	}
+
 	h.logger.Info("provisioned minio file server",
 		zap.String("bucket", h.Bucket),
 		zap.String("path_prefix", h.PathPrefix),
@@ -140,151 +831,928 @@ func (h *MinioStaticHTML) Provision(ctx caddy.Context) error {
 	return nil
 }
 
+// Validate rejects handler configurations that can never work.
+func (h *MinioStaticHTML) Validate() error {
+	if (h.AccessKey == "") != (h.SecretKey == "") {
+		return fmt.Errorf("access_key and secret_key must be set together")
+	}
+	if h.HtmlFile != "" && h.PathPrefix != "" {
+		return fmt.Errorf("html_file and path_prefix are mutually exclusive; path_prefix only applies in path mode")
+	}
+	if h.CacheTTL != "" {
+		if dur, err := time.ParseDuration(h.CacheTTL); err != nil {
+			return fmt.Errorf("invalid cache_ttl: %w", err)
+		} else if dur < 0 {
+			return fmt.Errorf("cache_ttl must not be negative")
+		}
+	}
+	if h.RequestTimeout != "" {
+		if dur, err := time.ParseDuration(h.RequestTimeout); err != nil {
+			return fmt.Errorf("invalid request_timeout: %w", err)
+		} else if dur <= 0 {
+			return fmt.Errorf("request_timeout must be positive")
+		}
+	}
+	var minTTL, maxTTL time.Duration
+	for _, opt := range []struct {
+		name, value string
+		dst         *time.Duration
+	}{
+		{"min_cache_ttl", h.MinCacheTTL, &minTTL},
+		{"max_cache_ttl", h.MaxCacheTTL, &maxTTL},
+		{"stale_ttl", h.StaleTTL, new(time.Duration)},
+	} {
+		if opt.value == "" {
+			continue
+		}
+		dur, err := time.ParseDuration(opt.value)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", opt.name, err)
+		} else if dur < 0 {
+			return fmt.Errorf("%s must not be negative", opt.name)
+		}
+		*opt.dst = dur
+	}
+	if maxTTL > 0 && minTTL > maxTTL {
+		return fmt.Errorf("min_cache_ttl must not exceed max_cache_ttl")
+	}
+	if h.TTLJitter < 0 || h.TTLJitter > 100 {
+		return fmt.Errorf("ttl_jitter must be between 0 and 100")
+	}
+	if err := h.validateTTLRules(); err != nil {
+		return err
+	}
+	if err := h.validateDispositionRules(); err != nil {
+		return err
+	}
+	if err := h.validateSurrogateKeys(); err != nil {
+		return err
+	}
+	if err := h.validateWarmup(); err != nil {
+		return err
+	}
+	if err := h.validateRefresh(); err != nil {
+		return err
+	}
+	if err := h.validatePinning(); err != nil {
+		return err
+	}
+	if err := h.validateHealth(); err != nil {
+		return err
+	}
+	if err := h.validateErrorPages(); err != nil {
+		return err
+	}
+	if err := h.validateErrorCodes(); err != nil {
+		return err
+	}
+	if err := h.validateHide(); err != nil {
+		return err
+	}
+	if err := h.validateAllow(); err != nil {
+		return err
+	}
+	if err := h.validateLanguages(); err != nil {
+		return err
+	}
+	if err := h.validateSnippets(); err != nil {
+		return err
+	}
+	if h.Browse != nil {
+		if err := h.Browse.validate(); err != nil {
+			return fmt.Errorf("browse: %w", err)
+		}
+	}
+	if h.Experiment != nil {
+		if err := h.Experiment.validate(); err != nil {
+			return fmt.Errorf("experiment: %w", err)
+		}
+	}
+	if h.Maintenance != nil {
+		if err := h.Maintenance.validate(); err != nil {
+			return fmt.Errorf("maintenance: %w", err)
+		}
+	}
+	if h.Templates != nil {
+		if err := h.Templates.validate(); err != nil {
+			return fmt.Errorf("templates: %w", err)
+		}
+	}
+	if h.Markdown != nil {
+		if err := h.Markdown.validate(); err != nil {
+			return fmt.Errorf("markdown: %w", err)
+		}
+	}
+	if h.Substitute != nil {
+		if err := h.Substitute.validate(); err != nil {
+			return fmt.Errorf("substitute: %w", err)
+		}
+	}
+	if h.Images != nil {
+		if err := h.Images.validate(); err != nil {
+			return fmt.Errorf("images: %w", err)
+		}
+	}
+	if h.Streaming != nil {
+		if err := h.Streaming.validate(); err != nil {
+			return fmt.Errorf("streaming: %w", err)
+		}
+	}
+	if h.ListAPI != nil {
+		if err := h.ListAPI.validate(); err != nil {
+			return fmt.Errorf("list_api: %w", err)
+		}
+	}
+	if h.Archive != nil {
+		if err := h.Archive.validate(); err != nil {
+			return fmt.Errorf("archive: %w", err)
+		}
+	}
+	if h.Upload != nil {
+		if err := h.Upload.validate(); err != nil {
+			return fmt.Errorf("upload: %w", err)
+		}
+	}
+	if err := h.validateMimeTypes(); err != nil {
+		return err
+	}
+	if err := h.validatePrecompressed(); err != nil {
+		return err
+	}
+	if err := h.validateImageFormats(); err != nil {
+		return err
+	}
+	if err := h.validateEncode(); err != nil {
+		return err
+	}
+	if err := h.validateVary(); err != nil {
+		return err
+	}
+	if h.CacheKey != nil {
+		if err := h.CacheKey.validate(); err != nil {
+			return fmt.Errorf("cache_key: %w", err)
+		}
+	}
+	if h.SSECustomerKey != "" && h.PresignRedirect {
+		return fmt.Errorf("sse_customer_key cannot be used with presign_redirect")
+	}
+	if h.Retries < 0 {
+		return fmt.Errorf("retries must not be negative")
+	}
+	if h.RetryDelay != "" {
+		if dur, err := time.ParseDuration(h.RetryDelay); err != nil {
+			return fmt.Errorf("invalid retry_delay: %w", err)
+		} else if dur <= 0 {
+			return fmt.Errorf("retry_delay must be positive")
+		}
+	}
+	if h.HedgeDelay != "" {
+		if dur, err := time.ParseDuration(h.HedgeDelay); err != nil {
+			return fmt.Errorf("invalid hedge_delay: %w", err)
+		} else if dur <= 0 {
+			return fmt.Errorf("hedge_delay must be positive")
+		}
+	}
+	if h.PresignExpiry != "" {
+		// minio-go rejects expiries outside this range.
+		if dur, err := time.ParseDuration(h.PresignExpiry); err != nil {
+			return fmt.Errorf("invalid presign_expiry: %w", err)
+		} else if dur < time.Second || dur > 7*24*time.Hour {
+			return fmt.Errorf("presign_expiry must be between 1s and 7 days")
+		}
+	}
+	return nil
+}
+
+// Cleanup stops background work started in Provision.
+func (h *MinioStaticHTML) Cleanup() error {
+	if h.stopRefresh != nil {
+		h.stopRefresh()
+	}
+	if h.stopHealth != nil {
+		h.stopHealth()
+	}
+	if h.redirects != nil {
+		h.redirects.close()
+	}
+	if h.headers != nil {
+		h.headers.close()
+	}
+	if h.preload != nil {
+		h.preload.close()
+	}
+	return nil
+}
+
+// objectKey maps a request to the key of the object it should be served.
+// With html_file set every request gets that page; otherwise the request
+// path, minus path_prefix, names the object. Placeholders in html_file and
+// path_prefix are expanded with repl.
+func (h *MinioStaticHTML) objectKey(r *http.Request, repl *caddy.Replacer) string {
+	if h.HtmlFile != "" {
+		return fmt.Sprintf("%s.html", repl.ReplaceAll(h.HtmlFile, ""))
+	}
+	return h.keyForPath(r.URL.Path, repl)
+}
+
+// keyForPath maps a URL path to an object key in path mode.
+func (h *MinioStaticHTML) keyForPath(path string, repl *caddy.Replacer) string {
+	return objectKeyForPath(path, repl.ReplaceAll(h.PathPrefix, ""))
+}
+
+// objectKeyForPath strips prefix from a URL path to make an object key.
+// Directory paths get their index.html.
+func objectKeyForPath(path, prefix string) string {
+	key := strings.TrimPrefix(path, prefix)
+	key = strings.TrimPrefix(key, "/")
+	if key == "" || strings.HasSuffix(key, "/") {
+		key += "index.html"
+	}
+	return key
+}
+
+// checkBucket verifies that the configured buckets exist, according to
+// ValidateBucket.
+func (h *MinioStaticHTML) checkBucket(ctx context.Context) error {
+	switch h.ValidateBucket {
+	case "", "off":
+		return nil
+	case "warn", "fail":
+	default:
+		return fmt.Errorf("invalid validate_bucket %q; must be fail, warn or off", h.ValidateBucket)
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	for _, bucket := range h.staticBuckets() {
+		exists, err := h.client.BucketExists(ctx, bucket)
+		if err == nil && !exists {
+			err = fmt.Errorf("bucket %q does not exist", bucket)
+		}
+		if err == nil {
+			continue
+		}
+		if h.ValidateBucket == "fail" {
+			return fmt.Errorf("validating bucket: %w", err)
+		}
+		h.logger.Warn("bucket validation failed", zap.String("bucket", bucket), zap.Error(err))
+	}
+	return nil
+}
+
 // ServeHTTP handles the HTTP request by fetching from cache or MinIO.
 func (h *MinioStaticHTML) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
+	if h.HealthPath != "" && r.URL.Path == h.HealthPath &&
+		(r.Method == http.MethodGet || r.Method == http.MethodHead) {
+		return h.serveHealth(w, r)
+	}
 	if strings.Contains(r.URL.Path, "..") {
 		return caddyhttp.Error(http.StatusBadRequest, errors.New("invalid URL path"))
 	}
 
-	objectKey := fmt.Sprintf("%s.html", h.HtmlFile)
+	repl := r.Context().Value(caddy.ReplacerCtxKey).(*caddy.Replacer)
+	bucket := h.resolveBucket(r, repl)
+	if bucket == "" {
+		return caddyhttp.Error(http.StatusNotFound, errors.New("no bucket for this request"))
+	}
+	if h.serveMaintenance(w, r, repl, bucket) {
+		return nil
+	}
+	if h.ListAPI != nil && r.URL.Path == h.ListAPI.Path {
+		return h.serveListAPI(w, r, bucket)
+	}
+	objectKey := h.objectKey(r, repl)
+	if strings.Contains(objectKey, "..") {
+		return caddyhttp.Error(http.StatusBadRequest, errors.New("invalid object key"))
+	}
+
+	if r.Method == "PURGE" {
+		key, err := h.releaseKey(r.Context(), repl, objectKey)
+		if err != nil {
+			return caddyhttp.Error(http.StatusServiceUnavailable, err)
+		}
+		return h.servePurge(w, r, bucket, key)
+	}
+
+	if (h.redirects != nil && objectKey == h.RedirectsFile) ||
+		(h.headers != nil && objectKey == h.HeadersFile) ||
+		(h.preload != nil && objectKey == h.PreloadFile) {
+		return caddyhttp.Error(http.StatusNotFound, errors.New("site configuration files are not served"))
+	}
+	if h.hidden(objectKey) {
+		return caddyhttp.Error(http.StatusNotFound, errors.New("object is hidden"))
+	}
+	if !h.allowed(objectKey) {
+		return caddyhttp.Error(http.StatusForbidden, errors.New("object is not allowed"))
+	}
+	objectKey = h.selectVariant(w, r, objectKey)
+	objectKey, err := h.releaseKey(r.Context(), repl, objectKey)
+	if err != nil {
+		h.logger.Error("failed to resolve release", zap.Error(err))
+		return caddyhttp.Error(http.StatusServiceUnavailable, err)
+	}
+	objectKey = h.localize(w, r, bucket, objectKey)
+	if handled, err := h.serveUpload(w, r, bucket, objectKey); handled {
+		return err
+	}
+	if handled, err := h.serveDelete(w, r, bucket, objectKey); handled {
+		return err
+	}
+	if h.metadataRequested(r) {
+		return h.serveMetadata(w, r, bucket, objectKey, h.versionID(r, repl))
+	}
+	if h.WebDAV {
+		if handled, err := h.serveWebDAV(w, r, bucket, objectKey); handled {
+			return err
+		}
+	}
+
+	h.sendEarlyHints(w, r, bucket, objectKey)
+
+	// Responses passed through to the next handler get none of this
+	// handler's header rules.
+	passThruWriter := w
+	if header := h.responseHeaders(r, repl, bucket); len(header) > 0 {
+		w = newHeaderWriter(w, header)
+	}
+
+	if h.redirects != nil {
+		handled, rewritten := h.applyRedirects(w, r, repl, bucket)
+		if handled {
+			return nil
+		}
+		if rewritten != "" {
+			if strings.Contains(rewritten, "..") {
+				return caddyhttp.Error(http.StatusBadRequest, errors.New("invalid object key"))
+			}
+			if h.hidden(rewritten) {
+				return caddyhttp.Error(http.StatusNotFound, errors.New("object is hidden"))
+			}
+			if !h.allowed(rewritten) {
+				return caddyhttp.Error(http.StatusForbidden, errors.New("object is not allowed"))
+			}
+			if objectKey, err = h.releaseKey(r.Context(), repl, rewritten); err != nil {
+				return caddyhttp.Error(http.StatusServiceUnavailable, err)
+			}
+		}
+	}
+
+	if h.serveIndexRedirect(w, r) {
+		return nil
+	}
+	if format := h.archiveRequested(r); format != "" {
+		return h.serveArchive(w, r, bucket, strings.TrimSuffix(objectKey, "index.html"), format)
+	}
+	if h.markdownRequested(r, objectKey) {
+		return h.serveMarkdown(w, r, bucket, objectKey)
+	}
+	if h.templateRequested(r, objectKey) {
+		return h.serveTemplate(w, r, repl, bucket, objectKey)
+	}
+	if h.substituteRequested(r, objectKey) {
+		return h.serveSubstituted(w, r, repl, bucket, objectKey)
+	}
+	if h.imageRequested(r, objectKey) {
+		return h.serveImage(w, r, bucket, objectKey)
+	}
+	if h.segmentRequested(r, objectKey) {
+		err := h.serveSegment(w, r, bucket, objectKey)
+		if err == nil {
+			return nil
+		}
+		if handled, err := h.serveFallback(passThruWriter, r, next, bucket, objectKey, ""); handled {
+			return err
+		}
+		if h.PassThru {
+			return next.ServeHTTP(passThruWriter, r)
+		}
+		h.handleMinioError(w, r, err)
+		return nil
+	}
+
+	opts := minio.GetObjectOptions{ServerSideEncryption: h.sse}
+	cacheKey := h.GlobalConfig.cacheKeyFor(r.Context(), bucket, objectKey)
+	if versionID := h.versionID(r, repl); versionID != "" {
+		opts.VersionID = versionID
+		cacheKey = versionCacheKey(cacheKey, versionID)
+	}
+
+	if h.PresignRedirect {
+		h.servePresignRedirect(w, r, bucket, objectKey, opts)
+		return nil
+	}
+
+	cacheKey = h.variantCacheKey(cacheKey, r)
+	h.setVary(w)
+	h.markBypass(r)
+	h.setSurrogateKeys(r)
+
+	if h.negotiatesImage(objectKey) && opts.VersionID == "" {
+		if h.serveImageFormat(w, r, bucket, objectKey, cacheKey, opts) {
+			return nil
+		}
+	}
+	if len(h.Precompressed) > 0 && opts.VersionID == "" {
+		if h.servePrecompressed(w, r, bucket, objectKey, cacheKey, opts) {
+			return nil
+		}
+	}
+	encodings := h.encodings(r)
+
+	// 1. Try to serve from cache. An expired entry still kept for
+	// stale_ttl is revalidated with MinIO, and served if MinIO fails.
+	var stale *CachedObject
+	var staleContent io.ReadSeeker
+	if !h.readCache(r) {
+		h.observeCache(cacheBypass)
+	} else {
+		// Compressed variants the client accepts are looked up along with
+		// the object itself.
+		keys := make([]string, 0, len(encodings)+1)
+		for _, enc := range encodings {
+			keys = append(keys, compressedCacheKey(cacheKey, enc))
+		}
+		keys = append(keys, cacheKey)
+		entries := h.lookupCacheKeys(r.Context(), bucket, objectKey, r.Header.Get("Range") == "", keys...)
+		now := time.Now()
+		if entry := entries[len(encodings)]; entry != nil && entry.obj.Missing {
+			// Recorded missing when the request fell back to the next
+			// bucket.
+			if !entry.obj.expired(now) {
+				if handled, err := h.serveFallback(passThruWriter, r, next, bucket, objectKey, ""); handled {
+					return err
+				}
+			}
+			entries[len(encodings)] = nil
+		}
+		if variant := freshEntry(entries[:len(encodings)], now); variant != nil {
+			h.observeCache(cacheHit)
+			h.events.emit(eventCacheHit, map[string]any{"bucket": bucket, "key": objectKey})
+			h.serveFromCache(w, r, variant.obj, variant.content)
+			return nil
+		}
+		if entry := entries[len(encodings)]; entry != nil && !entry.obj.expired(now) {
+			h.observeCache(cacheHit)
+			h.events.emit(eventCacheHit, map[string]any{"bucket": bucket, "key": objectKey})
+			if !h.serveCachedEncoded(w, r, bucket, objectKey, cacheKey, entry.obj, entry.content, encodings) {
+				h.serveFromCache(w, r, entry.obj, entry.content)
+			}
+			return nil // Request handled
+		} else if entry != nil {
+			stale, staleContent = entry.obj, entry.content
+			setCacheStatus(r, cacheStatusExpired)
+		}
+		h.observeCache(cacheMiss)
+		h.events.emit(eventCacheMiss, map[string]any{"bucket": bucket, "key": objectKey})
+	}
+
+	// 2. Cache MISS: Fetch from MinIO
+	h.logger.Debug("cache miss, fetching from minio",
+		zap.String("bucket", bucket),
+		zap.String("object_key", objectKey),
+	)
+
+	ctx := r.Context()
+	if h.requestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.requestTimeout)
+		defer cancel()
+	}
+
+	if stale != nil {
+		// Revalidate the cache entry rather than the client's copy; the
+		// client's conditions are then checked against the entry.
+		opts.SetMatchETagExcept(stale.ETag)
+	} else if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		// Only GET/HEAD revalidations can be answered with 304.
+		setConditions(r, &opts)
+	}
+
+	start := time.Now()
+	objInfo, content, err := h.fetchWithFailover(ctx, bucket, objectKey, opts)
+	if err != nil {
+		if isNotModified(err) && stale != nil {
+			if err := h.refreshEntry(r.Context(), cacheKey, stale); err != nil {
+				h.logger.Error("failed to refresh revalidated cache entry", zap.String("key", cacheKey), zap.Error(err))
+				h.observeRedisError("set")
+			}
+			setCacheStatus(r, cacheStatusRevalidated)
+			h.serveFromCache(w, r, stale, staleContent)
+			return nil
+		}
+		if isNotModified(err) {
+			// The object wasn't transferred, so there is nothing to cache.
+			h.writeNotModified(w, r, objectKey)
+			return nil
+		}
+		code := minio.ToErrorResponse(err).Code
+		if code != "NoSuchKey" && r.Context().Err() == nil {
+			h.events.emit(eventOriginError, map[string]any{
+				"bucket": bucket,
+				"key":    objectKey,
+				"code":   code,
+				"error":  err.Error(),
+			})
+		}
+		if stale != nil && code != "NoSuchKey" {
+			h.serveStale(w, r, cacheKey, stale, staleContent, err)
+			return nil
+		}
+		if errors.Is(err, errBreakerOpen) {
+			h.logger.Debug("minio circuit breaker open; not fetching",
+				zap.String("bucket", bucket),
+				zap.String("object_key", objectKey))
+			h.serveBreakerOpen(w, r)
+			return nil
+		}
+		if ctx.Err() == context.DeadlineExceeded && r.Context().Err() == nil {
+			h.logger.Warn("minio request timed out",
+				zap.String("bucket", bucket),
+				zap.String("object_key", objectKey),
+				zap.Duration("timeout", h.requestTimeout))
+			if !h.serveErrorPage(w, r, http.StatusGatewayTimeout) {
+				http.Error(w, "Gateway Timeout", http.StatusGatewayTimeout)
+			}
+			return nil
+		}
+		if code == "NoSuchKey" && opts.VersionID == "" {
+			if handled, err := h.serveFallback(passThruWriter, r, next, bucket, objectKey, cacheKey); handled {
+				return err
+			}
+		}
+		if code == "NoSuchKey" && h.serveDirRedirect(w, r, bucket, objectKey) {
+			return nil
+		}
+		if code == "NoSuchKey" && h.serveBrowse(w, r, bucket, objectKey) {
+			return nil
+		}
+		if h.PassThru && code == "NoSuchKey" {
+			h.logger.Debug("object not found in bucket; passing through",
+				zap.String("bucket", bucket),
+				zap.String("object_key", objectKey))
+			return next.ServeHTTP(passThruWriter, r)
+		}
+		h.handleMinioError(w, r, err)
+		return nil
+	}
+	minioMetrics.originLatency.WithLabelValues(h.Bucket).Observe(time.Since(start).Seconds())
+	content = h.prepareObject(objectKey, &objInfo, content)
+
+	// 3. Store in cache
+	if h.cacheEnabled() {
+		h.storeInCache(r.Context(), cacheKey, bucket, objectKey, &objInfo, content, h.cacheTTLFor(r, &objInfo))
+	}
+
+	// 4. Serve the object to the client, compressed if it's worth it
+	if !h.serveEncoded(w, r, bucket, objectKey, cacheKey, &objInfo, content, encodings) {
+		h.serveFromOrigin(w, r, &objInfo, content)
+	}
+	return nil
+}
+
+// cacheEntry is an entry read from the cache, with a reader for its
+// content.
+type cacheEntry struct {
+	obj     *CachedObject
+	content io.ReadSeeker
+}
+
+// lookupCacheKeys reads the entries under keys from the cache in a single
+// Get, so trying several candidates, such as encoded variants, costs no
+// more than one round trip. Entries that are missing or unusable, which is
+// logged, are nil. With prefetch the first chunk of a chunked entry is read
+// together with the check that its chunks are present.
+func (h *MinioStaticHTML) lookupCacheKeys(ctx context.Context, bucket, objectKey string, prefetch bool, keys ...string) []*cacheEntry {
+	entries := make([]*cacheEntry, len(keys))
+	spanCtx, span := h.startSpan(ctx, "cache.get", bucket, objectKey)
+	defer span.End()
+	span.SetAttributes(attribute.Int("cache.keys", len(keys)))
 
-	// 1. Try to serve from cache
-	if h.redisClient != nil && h.cacheTTL > 0 {
-		cacheKey := fmt.Sprintf("minio-cache:%s:%s", h.Bucket, objectKey)
-		cachedResult, err := h.redisClient.Get(r.Context(), cacheKey).Result()
-		if err == nil {
-			var cachedObj CachedObject
-			if err := json.Unmarshal([]byte(cachedResult), &cachedObj); err == nil {
-				h.logger.Debug("cache hit", zap.String("key", cacheKey))
-				h.serveFromCache(w, r, &cachedObj)
-				return nil // Request handled
-			}
-			h.logger.Warn("failed to unmarshal cached object", zap.String("key", cacheKey), zap.Error(err))
-		} else if err != redis.Nil {
-			h.logger.Error("dragonflyDB GET error", zap.String("key", cacheKey), zap.Error(err))
+	start := time.Now()
+	values, err := h.cache.Get(spanCtx, keys...)
+	handlerStats.get.observe(time.Since(start))
+	if err != nil {
+		spanError(span, err)
+		h.logger.Error("dragonflyDB GET error", zap.Strings("keys", keys), zap.Error(err))
+		h.observeRedisError("get")
+		return entries
+	}
+	hit := false
+	for i, raw := range values {
+		if raw != nil {
+			entries[i] = h.decodeEntry(ctx, keys[i], raw, prefetch)
+			hit = hit || entries[i] != nil
 		}
 	}
+	span.SetAttributes(attribute.Bool("cache.hit", hit))
+	return entries
+}
 
-	// 2. Cache MISS: Fetch from MinIO
-	h.logger.Debug("cache miss, fetching from minio",
-		zap.String("bucket", h.Bucket),
-		zap.String("object_key", objectKey),
-	)
-
-	objInfo, err := h.client.StatObject(r.Context(), h.Bucket, objectKey, minio.StatObjectOptions{})
-	if err != nil {
-		h.handleMinioError(w, r, err)
+// decodeEntry parses a cache entry read from cacheKey, or returns nil if it
+// is unusable.
+func (h *MinioStaticHTML) decodeEntry(ctx context.Context, cacheKey string, raw []byte, prefetch bool) *cacheEntry {
+	var cachedObj CachedObject
+	if err := json.Unmarshal(raw, &cachedObj); err != nil {
+		h.logger.Warn("failed to unmarshal cached object", zap.String("key", cacheKey), zap.Error(err))
 		return nil
 	}
-
-	obj, err := h.client.GetObject(r.Context(), h.Bucket, objectKey, minio.GetObjectOptions{})
+	if cachedObj.Chunks > 0 {
+		first, ok := h.chunksPresent(ctx, cacheKey, &cachedObj, prefetch)
+		if !ok {
+			h.logger.Debug("cached object is missing chunks, refetching", zap.String("key", cacheKey))
+			return nil
+		}
+		reader := h.newChunkReader(ctx, cacheKey, &cachedObj)
+		if first != nil {
+			if err := reader.prime(first); err != nil {
+				h.logger.Warn("failed to decompress cached chunk", zap.String("key", cacheKey), zap.Error(err))
+				return nil
+			}
+		}
+		h.logger.Debug("cache hit (chunked)", zap.String("key", cacheKey), zap.Int("chunks", cachedObj.Chunks))
+		return &cacheEntry{&cachedObj, reader}
+	}
+	content, err := decompressPayload(cachedObj.Encoding, cachedObj.Content)
 	if err != nil {
-		h.handleMinioError(w, r, err)
+		h.logger.Warn("failed to decompress cached object", zap.String("key", cacheKey), zap.Error(err))
 		return nil
 	}
-	defer obj.Close()
+	h.logger.Debug("cache hit", zap.String("key", cacheKey))
+	return &cacheEntry{&cachedObj, bytes.NewReader(content)}
+}
 
-	content, err := io.ReadAll(obj)
-	if err != nil {
-		h.logger.Error("failed to read object content from minio", zap.Error(err))
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		return nil
+// freshEntry returns the first of entries holding an unexpired object, or
+// nil if there is none.
+func freshEntry(entries []*cacheEntry, now time.Time) *cacheEntry {
+	for _, entry := range entries {
+		if entry != nil && !entry.obj.Missing && !entry.obj.expired(now) {
+			return entry
+		}
 	}
+	return nil
+}
 
-	// 3. Store in cache
+// cacheEnabled reports whether this request should use the cache.
+func (h *MinioStaticHTML) cacheEnabled() bool {
+	return h.cache != nil && h.cacheTTL > 0 && h.GlobalConfig.cacheAvailable()
+}
+
+// storeInCache writes an object fetched from MinIO to the cache, either
+// under cacheKey, either as a single entry or, above the chunk threshold, as
+// a series of chunks, for ttl. With cache_write_workers set this happens in
+// the background. Failures are logged and otherwise ignored; the response
+// is unaffected.
+func (h *MinioStaticHTML) storeInCache(ctx context.Context, cacheKey, bucket, objectKey string, objInfo *minio.ObjectInfo, content []byte, ttl time.Duration) {
+	info := *objInfo
+	h.writeCache(ctx, func(ctx context.Context) {
+		h.writeEntry(ctx, cacheKey, bucket, objectKey, &info, content, ttl)
+	})
+}
+
+// writeEntry is the body of storeInCache, run in the background when async
+// cache writes are enabled.
+func (h *MinioStaticHTML) writeEntry(ctx context.Context, cacheKey, bucket, objectKey string, objInfo *minio.ObjectInfo, content []byte, ttl time.Duration) {
+	ctx, span := h.startSpan(ctx, "cache.set", bucket, objectKey)
+	defer span.End()
+	span.SetAttributes(attribute.Int64("minio.size", objInfo.Size))
+
+	// Objects stored in chunks have their own limit, as they are what
+	// chunking is for.
+	chunked := h.GlobalConfig.ChunkThreshold > 0 && objInfo.Size > h.GlobalConfig.ChunkThreshold
 	maxCacheSize := int64(5 * 1024 * 1024) // default 5 MB
 	if h.GlobalConfig.MaxCacheSize > 0 {
 		maxCacheSize = h.GlobalConfig.MaxCacheSize
 	}
+	if chunked {
+		maxCacheSize = defaultMaxChunkedSize
+		if h.GlobalConfig.MaxChunkedSize > 0 {
+			maxCacheSize = h.GlobalConfig.MaxChunkedSize
+		}
+	}
+	if objInfo.Size > maxCacheSize {
+		span.SetAttributes(attribute.Bool("cache.skipped", true))
+		h.logger.Warn("object too large for cache, skipping",
+			zap.String("bucket", bucket),
+			zap.String("key", objectKey),
+			zap.Int64("size_bytes", objInfo.Size),
+		)
+		return
+	}
 
-	if h.redisClient != nil && h.cacheTTL > 0 {
-		if objInfo.Size > maxCacheSize {
-			h.logger.Warn("object too large for cache, skipping",
-				zap.String("bucket", h.Bucket),
-				zap.String("key", objectKey),
-				zap.Int64("size_bytes", objInfo.Size),
-			)
-		} else {
-			cacheKey := fmt.Sprintf("minio-cache:%s:%s", h.Bucket, objectKey)
-			cachedObj := CachedObject{
-				ContentType:  objInfo.ContentType,
-				ETag:         objInfo.ETag,
-				LastModified: objInfo.LastModified,
-				Size:         objInfo.Size,
-				Content:      content,
-			}
-			if jsonData, err := json.Marshal(cachedObj); err != nil {
-				h.logger.Error("failed to marshal object for caching", zap.Error(err))
-			} else {
-				if err := h.redisClient.Set(r.Context(), cacheKey, jsonData, h.cacheTTL).Err(); err != nil {
-					h.logger.Error("failed to SET object in cache", zap.String("key", cacheKey), zap.Error(err))
-				} else {
-					h.logger.Debug("stored object in cache", zap.String("key", cacheKey))
-				}
-			}
+	// Pinned objects are kept whatever the TTL policy says.
+	pinned := h.pinned(ctx, objectKey)
+	if ttl <= 0 && !pinned {
+		span.SetAttributes(attribute.Bool("cache.skipped", true))
+		h.logger.Debug("object not cacheable under TTL policy, skipping", zap.String("key", cacheKey))
+		return
+	}
+	now := time.Now()
+	var expiresAt, staleUntil time.Time
+	var expiry time.Duration
+	if pinned {
+		span.SetAttributes(attribute.Bool("cache.pinned", true))
+	} else {
+		ttl = h.jitterTTL(ttl)
+		span.SetAttributes(attribute.Int64("cache.ttl_seconds", int64(ttl.Seconds())))
+		expiry = ttl + h.staleTTL
+		expiresAt, staleUntil = now.Add(ttl), now.Add(expiry)
+	}
+
+	cachedObj := CachedObject{
+		ContentType:  objInfo.ContentType,
+		ETag:         objInfo.ETag,
+		LastModified: objInfo.LastModified,
+		Size:         objInfo.Size,
+		Content:      content,
+		Encoding:     h.cacheEncoding(objInfo.ContentType, objInfo.Size),
+
+		RedirectLocation: objInfo.Metadata.Get(websiteRedirectHeader),
+		UserMetadata:     objInfo.UserMetadata,
+
+		ContentDisposition: objInfo.Metadata.Get("Content-Disposition"),
+		ContentEncoding:    objInfo.Metadata.Get("Content-Encoding"),
+
+		CachedAt:   now,
+		ExpiresAt:  expiresAt,
+		StaleUntil: staleUntil,
+
+		SurrogateKeys: surrogateKeys(ctx, objInfo.UserMetadata),
+	}
+
+	if chunked {
+		if err := h.storeChunked(ctx, cacheKey, cachedObj, expiry); err != nil {
+			h.logger.Error("failed to SET chunked object in cache", zap.String("key", cacheKey), zap.Error(err))
+			h.observeRedisError("set")
+			spanError(span, err)
+			return
 		}
+		h.tagEntry(ctx, cacheKey, cachedObj.SurrogateKeys, expiry)
+		h.observeEntryWritten()
+		h.logger.Debug("stored chunked object in cache", zap.String("key", cacheKey))
+		return
 	}
 
-	// 4. Serve the object to the client
-	h.serveFromOrigin(w, r, &objInfo, content)
-	return nil
+	compressed, err := compressPayload(cachedObj.Encoding, content)
+	if err != nil {
+		h.logger.Error("failed to compress object for caching", zap.String("key", cacheKey), zap.Error(err))
+		return
+	}
+	cachedObj.Content = compressed
+
+	jsonData, err := json.Marshal(cachedObj)
+	if err != nil {
+		h.logger.Error("failed to marshal object for caching", zap.Error(err))
+		return
+	}
+	start := time.Now()
+	err = h.cache.Set(ctx, expiry, CacheItem{cacheKey, jsonData})
+	handlerStats.set.observe(time.Since(start))
+	if err != nil {
+		h.logger.Error("failed to SET object in cache", zap.String("key", cacheKey), zap.Error(err))
+		h.observeRedisError("set")
+		spanError(span, err)
+		return
+	}
+	h.tagEntry(ctx, cacheKey, cachedObj.SurrogateKeys, expiry)
+	h.observeEntryWritten()
+	h.logger.Debug("stored object in cache",
+		zap.String("key", cacheKey),
+		zap.String("encoding", cachedObj.Encoding),
+		zap.Int("stored_bytes", len(compressed)),
+	)
 }
 
-// serveFromCache writes a cached object to the HTTP response.
-func (h *MinioStaticHTML) serveFromCache(w http.ResponseWriter, r *http.Request, obj *CachedObject) {
-	if h.cacheTTL > 0 {
-		w.Header().Set("Cache-Control",
-			fmt.Sprintf("public, max-age=%d", int(h.cacheTTL.Seconds())))
+// serveFromCache writes a cached object to the HTTP response. The body is
+// read from content, which is either the inline bytes or a chunk reader.
+func (h *MinioStaticHTML) serveFromCache(w http.ResponseWriter, r *http.Request, obj *CachedObject, content io.ReadSeeker) {
+	if obj.RedirectLocation != "" {
+		writeCacheStatus(w, r, cacheStatusHit)
+		h.serveWebsiteRedirect(w, r, obj.RedirectLocation)
+		return
+	}
+	h.setMetadataHeaders(w, obj.UserMetadata)
+	h.setContentDisposition(w, r, obj.ContentDisposition)
+	if cc := h.cacheControl(r, obj.ContentType); cc != "" {
+		w.Header().Set("Cache-Control", cc)
 	}
 	w.Header().Set("Content-Type", obj.ContentType)
+	if obj.ContentEncoding != "" {
+		w.Header().Set("Content-Encoding", obj.ContentEncoding)
+	}
 	w.Header().Set("Content-Length", fmt.Sprintf("%d", obj.Size))
 	w.Header().Set("ETag", obj.ETag)
 	w.Header().Set("Last-Modified", obj.LastModified.Format(http.TimeFormat))
-	w.Header().Set("X-Cache-Status", "HIT")
-	http.ServeContent(w, r, "", obj.LastModified, bytes.NewReader(obj.Content))
+	writeCacheStatus(w, r, cacheStatusHit)
+	setAge(w, obj)
+	cw := newCountingWriter(w)
+	http.ServeContent(cw, r, "", obj.LastModified, content)
+	h.observeBytes("cache", cw.n)
 }
 
 // serveFromOrigin writes an object just fetched from MinIO to the response.
 func (h *MinioStaticHTML) serveFromOrigin(w http.ResponseWriter, r *http.Request, objInfo *minio.ObjectInfo, content []byte) {
-	if h.cacheTTL > 0 {
-		w.Header().Set("Cache-Control",
-			fmt.Sprintf("public, max-age=%d", int(h.cacheTTL.Seconds())))
+	if location := objInfo.Metadata.Get(websiteRedirectHeader); location != "" {
+		writeCacheStatus(w, r, cacheStatusMiss)
+		h.serveWebsiteRedirect(w, r, location)
+		return
+	}
+	h.setMetadataHeaders(w, objInfo.UserMetadata)
+	h.setContentDisposition(w, r, objInfo.Metadata.Get("Content-Disposition"))
+	if cc := h.cacheControl(r, objInfo.ContentType); cc != "" {
+		w.Header().Set("Cache-Control", cc)
 	}
 	w.Header().Set("Content-Type", objInfo.ContentType)
+	if enc := objInfo.Metadata.Get("Content-Encoding"); enc != "" {
+		w.Header().Set("Content-Encoding", enc)
+	}
 	w.Header().Set("Content-Length", fmt.Sprintf("%d", objInfo.Size))
 	w.Header().Set("ETag", objInfo.ETag)
 	w.Header().Set("Last-Modified", objInfo.LastModified.Format(http.TimeFormat))
-	w.Header().Set("X-Cache-Status", "MISS")
-	http.ServeContent(w, r, "", objInfo.LastModified, bytes.NewReader(content))
+	writeCacheStatus(w, r, cacheStatusMiss)
+	cw := newCountingWriter(w)
+	http.ServeContent(cw, r, "", objInfo.LastModified, bytes.NewReader(content))
+	h.observeBytes("origin", cw.n)
+}
+
+// writeNotModified answers a conditional request MinIO found unchanged.
+// MinIO's 304 carries no headers through the client, so the validators
+// are the ones the client sent, which matched: its entity tag if it sent
+// exactly one, otherwise its modification date, which MinIO only compares
+// without If-None-Match.
+func (h *MinioStaticHTML) writeNotModified(w http.ResponseWriter, r *http.Request, objectKey string) {
+	if cc := h.cacheControl(r, h.contentTypeByExtension(objectKey)); cc != "" {
+		w.Header().Set("Cache-Control", cc)
+	}
+	if etag := strings.TrimSpace(r.Header.Get("If-None-Match")); etag != "" {
+		if etag != "*" && !strings.Contains(etag, ",") {
+			w.Header().Set("ETag", etag)
+		}
+	} else if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil {
+		w.Header().Set("Last-Modified", since.UTC().Format(http.TimeFormat))
+	}
+	writeCacheStatus(w, r, cacheStatusMiss)
+	w.WriteHeader(http.StatusNotModified)
 }
 
 func (h *MinioStaticHTML) handleMinioError(w http.ResponseWriter, r *http.Request, err error) {
 	minioErr, ok := err.(minio.ErrorResponse)
 	if !ok {
 		h.logger.Error("unhandled error from minio client", zap.Error(err))
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		if !h.serveErrorPage(w, r, http.StatusInternalServerError) {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
 		return
 	}
+	if h.ExposeErrorCode {
+		w.Header().Set(minioErrorHeader, minioErr.Code)
+	}
+	status := h.statusForMinioError(minioErr.Code)
 	if minioErr.Code == "NoSuchKey" {
 		h.logger.Debug("object not found in bucket", zap.Error(err))
-		if h.GlobalConfig.NotFoundFile != "" {
-			http.ServeFile(w, r, h.GlobalConfig.NotFoundFile)
-		} else {
-			http.NotFound(w, r)
-		}
+	} else {
+		h.logger.Error("minio returned an error",
+			zap.String("error_code", minioErr.Code),
+			zap.String("bucket", minioErr.BucketName),
+			zap.String("key", minioErr.Key),
+			zap.Int("status", status),
+		)
+	}
+	if status == http.StatusServiceUnavailable {
+		w.Header().Set("Retry-After", slowDownRetryAfter)
+	}
+	if h.serveErrorPage(w, r, status) {
 		return
 	}
-	h.logger.Error("minio returned an error",
-		zap.String("error_code", minioErr.Code),
-		zap.String("bucket", minioErr.BucketName),
-		zap.String("key", minioErr.Key),
-	)
-	http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	if status == http.StatusNotFound && h.GlobalConfig.NotFoundFile != "" {
+		http.ServeFile(w, r, h.GlobalConfig.NotFoundFile)
+		return
+	}
+	http.Error(w, http.StatusText(status), status)
 }
 
 // MinioConfigModule is the global app configuration for MinIO.
 type MinioConfigModule struct {
 	*MinioConfig
+
+	logger      *zap.Logger
+	minioClient *minio.Client
+	events      *eventEmitter
+
+	// Bucket notification listeners, see notify.go.
+	cancelWatch context.CancelFunc
+	watchers    *sync.WaitGroup
+
+	// Stops the DragonflyDB health monitor, see cachehealth.go.
+	stopMonitor func()
+
+	// The cache backend made from the top-level redis options, if any,
+	// which Cleanup closes. Backends loaded from CacheRaw are cleaned up by
+	// Caddy.
+	redisBackend *RedisBackend
+
+	// Handlers with a warm-up manifest, and a function cancelling their
+	// warm-ups, see warmup.go.
+	warmups    []*MinioStaticHTML
+	stopWarmup func()
 }
 
 func (MinioConfigModule) CaddyModule() caddy.ModuleInfo {
@@ -296,30 +1764,156 @@ func (MinioConfigModule) CaddyModule() caddy.ModuleInfo {
 
 // Provision initializes the DragonflyDB/Redis client.
 func (m *MinioConfigModule) Provision(ctx caddy.Context) error {
-	if m.ReddisAddress != "" {
-		opt, err := redis.ParseURL(m.ReddisAddress)
+	m.logger = ctx.Logger()
+	initMetrics(ctx.GetMetricsRegistry())
+	events, err := newEventEmitter(ctx)
+	if err != nil {
+		return err
+	}
+	m.events = events
+	m.provisionKeyPrefix()
+	if err := m.provisionCache(ctx); err != nil {
+		return err
+	}
+
+	// In degrade mode the connection is made lazily by the health monitor
+	// once the app starts, so a cache that isn't up yet doesn't block
+	// config loading.
+	if m.cache != nil && m.CacheFailureMode != cacheFailDegrade {
+		if err := m.cache.Ping(context.Background()); err != nil {
+			name := m.cacheName()
+			m.Cleanup()
+			m.cache = nil
+			return fmt.Errorf("failed to connect to cache %s: %w", name, err)
+		}
+		m.cacheUp.Store(true)
+		setRedisUp(true)
+		m.logger.Info("connected to cache", zap.String("cache", m.cacheName()))
+	}
+
+	if len(m.WatchBuckets) > 0 {
+		client, err := m.newMinioClient()
 		if err != nil {
-			return fmt.Errorf("invalid reddis_address URL: %w", err)
+			return fmt.Errorf("failed to initialize MinIO client: %w", err)
 		}
-		client := redis.NewClient(opt)
-		if err := client.Ping(context.Background()).Err(); err != nil {
-			return fmt.Errorf("failed to connect to dragonflyDB at %s: %w", m.ReddisAddress, err)
+		m.minioClient = client
+	}
+	return nil
+}
+
+// provisionCache sets up the cache backend, either the module in CacheRaw
+// or one made from the top-level redis options. No cache is configured if
+// neither is set.
+func (m *MinioConfigModule) provisionCache(ctx caddy.Context) error {
+	switch {
+	case m.CacheRaw != nil && m.RedisOptions.configured():
+		return fmt.Errorf("cache cannot be combined with the top-level redis options")
+	case m.CacheRaw != nil:
+		mod, err := ctx.LoadModule(m.MinioConfig, "CacheRaw")
+		if err != nil {
+			return fmt.Errorf("loading cache backend: %w", err)
 		}
-		m.redisClient = client
-		ctx.Logger().Info("connected to dragonflyDB", zap.String("address", m.ReddisAddress))
+		m.cache = mod.(CacheBackend)
+	case m.RedisOptions.configured():
+		backend := &RedisBackend{RedisOptions: m.RedisOptions}
+		if err := backend.Provision(ctx); err != nil {
+			return err
+		}
+		m.redisBackend = backend
+		m.cache = backend
 	}
 	return nil
 }
 
-func (m *MinioConfigModule) Start() error { return nil }
+// Validate rejects global configurations that can never work.
+func (m *MinioConfigModule) Validate() error {
+	if err := m.MinioEndpoint.validate(); err != nil {
+		return err
+	}
+	for name, ep := range m.Endpoints {
+		if ep == nil || ep.Endpoint == "" {
+			return fmt.Errorf("endpoint %q: endpoint must be specified", name)
+		}
+		if err := ep.validate(); err != nil {
+			return fmt.Errorf("endpoint %q: %w", name, err)
+		}
+	}
+	if len(m.WatchBuckets) > 0 && m.Endpoint == "" {
+		return fmt.Errorf("watch_buckets requires the default endpoint to be set")
+	}
+	if m.DefaultCacheTTL != "" {
+		if dur, err := time.ParseDuration(m.DefaultCacheTTL); err != nil {
+			return fmt.Errorf("invalid default_cache_ttl: %w", err)
+		} else if dur < 0 {
+			return fmt.Errorf("default_cache_ttl must not be negative")
+		}
+	}
+	if m.MaxCacheSize < 0 || m.ChunkThreshold < 0 || m.ChunkSize < 0 || m.MaxChunkedSize < 0 || m.CompressMinSize < 0 {
+		return fmt.Errorf("size limits must not be negative")
+	}
+	if !validCompression(m.CacheCompression) {
+		return fmt.Errorf("invalid cache_compression %q; must be zstd or snappy", m.CacheCompression)
+	}
+	switch m.CacheFailureMode {
+	case "", cacheFailStrict, cacheFailDegrade:
+	default:
+		return fmt.Errorf("invalid cache_failure_mode %q; must be strict or degrade", m.CacheFailureMode)
+	}
+	if m.CacheRetryInterval != "" {
+		if dur, err := time.ParseDuration(m.CacheRetryInterval); err != nil {
+			return fmt.Errorf("invalid cache_retry_interval: %w", err)
+		} else if dur <= 0 {
+			return fmt.Errorf("cache_retry_interval must be positive")
+		}
+	}
+	if m.BreakerThreshold < 0 {
+		return fmt.Errorf("breaker_threshold must not be negative")
+	}
+	if m.BreakerCooldown != "" {
+		if dur, err := time.ParseDuration(m.BreakerCooldown); err != nil {
+			return fmt.Errorf("invalid breaker_cooldown: %w", err)
+		} else if dur <= 0 {
+			return fmt.Errorf("breaker_cooldown must be positive")
+		}
+	}
+	if m.CacheGenerations && m.cache == nil {
+		return fmt.Errorf("cache_generations requires a cache to be configured")
+	}
+	if len(m.WatchBuckets) > 0 && m.cache == nil {
+		return fmt.Errorf("watch_buckets requires a cache to be configured")
+	}
+	if err := m.validateRedis(); err != nil {
+		return err
+	}
+	return m.validateCacheWriter()
+}
+
+// Start begins listening for bucket notifications, monitoring the
+// DragonflyDB connection and warming the cache, if configured.
+func (m *MinioConfigModule) Start() error {
+	m.startWatchers()
+	m.startCacheMonitor()
+	m.startCacheWriter()
+	m.startWarmups()
+	return nil
+}
 
-// Stop satisfies the caddy.App interface. It currently does nothing.
-func (m *MinioConfigModule) Stop() error { return nil }
+// Stop shuts down the background goroutines started by Start.
+func (m *MinioConfigModule) Stop() error {
+	m.stopWarmups()
+	m.stopWatchers()
+	m.stopCacheWriter()
+	if m.stopMonitor != nil {
+		m.stopMonitor()
+		m.stopMonitor = nil
+	}
+	return nil
+}
 
-// Cleanup closes the DragonflyDB/Redis client connection.
+// Cleanup closes the cache backend made from the top-level redis options.
 func (m *MinioConfigModule) Cleanup() error {
-	if m.redisClient != nil {
-		return m.redisClient.Close()
+	if m.redisBackend != nil {
+		return m.redisBackend.Cleanup()
 	}
 	return nil
 }
@@ -332,53 +1926,250 @@ func (m *MinioConfigModule) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
 		val := d.Val()
 		for d.NextBlock(0) {
 			switch d.Val() {
-			case "endpoint":
+			case "reddis_address":
 				if !d.NextArg() {
 					return d.ArgErr()
 				}
-				m.Endpoint = d.Val()
-			case "access_key":
+				m.ReddisAddress = d.Val()
+			case "not_found_file":
 				if !d.NextArg() {
 					return d.ArgErr()
 				}
-				m.AccessKey = d.Val()
-			case "secret_key":
+				m.NotFoundFile = d.Val()
+			case "default_cache_ttl":
 				if !d.NextArg() {
 					return d.ArgErr()
 				}
-				m.SecretKey = d.Val()
-			case "secure":
+				m.DefaultCacheTTL = d.Val()
+			case "max_cache_size":
 				if !d.NextArg() {
 					return d.ArgErr()
 				}
-				m.Secure = (d.Val() == "true")
-			case "reddis_address":
+				sizeStr := d.Val()
+				sizeBytes, err := parseSize(sizeStr)
+				if err != nil {
+					return d.Errf("invalid max_cache_size: %v", err)
+				}
+				m.MaxCacheSize = sizeBytes
+			case "chunk_threshold":
 				if !d.NextArg() {
 					return d.ArgErr()
 				}
-				m.ReddisAddress = d.Val()
-			case "not_found_file":
+				sizeBytes, err := parseSize(d.Val())
+				if err != nil {
+					return d.Errf("invalid chunk_threshold: %v", err)
+				}
+				m.ChunkThreshold = sizeBytes
+			case "max_chunked_size":
 				if !d.NextArg() {
 					return d.ArgErr()
 				}
-				m.NotFoundFile = d.Val()
-			case "default_cache_ttl":
+				sizeBytes, err := parseSize(d.Val())
+				if err != nil {
+					return d.Errf("invalid max_chunked_size: %v", err)
+				}
+				m.MaxChunkedSize = sizeBytes
+			case "chunk_size":
 				if !d.NextArg() {
 					return d.ArgErr()
 				}
-				m.DefaultCacheTTL = d.Val()
-			case "max_cache_size":
+				sizeBytes, err := parseSize(d.Val())
+				if err != nil {
+					return d.Errf("invalid chunk_size: %v", err)
+				}
+				m.ChunkSize = sizeBytes
+			case "cache_compression":
 				if !d.NextArg() {
 					return d.ArgErr()
 				}
-				sizeStr := d.Val()
-				sizeBytes, err := parseSize(sizeStr)
+				m.CacheCompression = d.Val()
+			case "compress_min_size":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				sizeBytes, err := parseSize(d.Val())
 				if err != nil {
-					return d.Errf("invalid max_cache_size: %v", err)
+					return d.Errf("invalid compress_min_size: %v", err)
+				}
+				m.CompressMinSize = sizeBytes
+			case "named_endpoint":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				name := d.Val()
+				ep, err := unmarshalEndpoint(d)
+				if err != nil {
+					return err
+				}
+				if m.Endpoints == nil {
+					m.Endpoints = make(map[string]*MinioEndpoint)
+				}
+				m.Endpoints[name] = ep
+			case "watch_buckets":
+				m.WatchBuckets = d.RemainingArgs()
+				if len(m.WatchBuckets) == 0 {
+					return d.ArgErr()
+				}
+			case "cache_failure_mode":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				m.CacheFailureMode = d.Val()
+			case "breaker_threshold":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				n, err := strconv.Atoi(d.Val())
+				if err != nil {
+					return d.Errf("invalid breaker_threshold: %v", err)
+				}
+				m.BreakerThreshold = n
+			case "breaker_cooldown":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				m.BreakerCooldown = d.Val()
+			case "cache_write_workers", "cache_write_queue":
+				option := d.Val()
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				n, err := strconv.Atoi(d.Val())
+				if err != nil {
+					return d.Errf("invalid %s: %v", option, err)
+				}
+				if option == "cache_write_workers" {
+					m.CacheWriteWorkers = n
+				} else {
+					m.CacheWriteQueue = n
+				}
+			case "cache_write_overflow":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				m.CacheWriteOverflow = d.Val()
+			case "redis_cluster":
+				m.RedisCluster = d.RemainingArgs()
+				if len(m.RedisCluster) == 0 {
+					return d.ArgErr()
+				}
+			case "redis_username":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				m.RedisUsername = d.Val()
+			case "redis_password":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				m.RedisPassword = d.Val()
+			case "redis_tls_ca_file":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				m.RedisTLSCAFile = d.Val()
+			case "redis_tls_client_cert":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				m.RedisTLSClientCert = d.Val()
+			case "redis_tls_client_key":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				m.RedisTLSClientKey = d.Val()
+			case "cache_key_prefix":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				m.CacheKeyPrefix = d.Val()
+			case "cache_namespace":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				m.CacheNamespace = d.Val()
+			case "cache_generations":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				m.CacheGenerations = (d.Val() == "true")
+			case "redis_pool_size", "redis_min_idle_conns":
+				option := d.Val()
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				n, err := strconv.Atoi(d.Val())
+				if err != nil {
+					return d.Errf("invalid %s: %v", option, err)
+				}
+				if option == "redis_pool_size" {
+					m.RedisPoolSize = n
+				} else {
+					m.RedisMinIdleConns = n
+				}
+			case "redis_dial_timeout":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				m.RedisDialTimeout = d.Val()
+			case "redis_read_timeout":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				m.RedisReadTimeout = d.Val()
+			case "redis_write_timeout":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				m.RedisWriteTimeout = d.Val()
+			case "redis_db":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				n, err := strconv.Atoi(d.Val())
+				if err != nil {
+					return d.Errf("invalid redis_db: %v", err)
+				}
+				m.RedisDB = n
+			case "redis_tls":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				m.RedisTLS = (d.Val() == "true")
+			case "redis_tls_insecure_skip_verify":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				m.RedisTLSInsecureSkipVerify = (d.Val() == "true")
+			case "redis_sentinel_master":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				m.RedisSentinelMaster = d.Val()
+			case "redis_sentinels":
+				m.RedisSentinels = d.RemainingArgs()
+				if len(m.RedisSentinels) == 0 {
+					return d.ArgErr()
+				}
+			case "cache_retry_interval":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				m.CacheRetryInterval = d.Val()
+			case "compress_types":
+				m.CompressTypes = d.RemainingArgs()
+				if len(m.CompressTypes) == 0 {
+					return d.ArgErr()
 				}
-				m.MaxCacheSize = sizeBytes
 			default:
-				return d.Errf("unrecognized subdirective '%s'", d.Val())
+				option := d.Val()
+				ok, err := m.MinioEndpoint.unmarshalOption(d, option)
+				if err != nil {
+					return err
+				}
+				if !ok {
+					return d.Errf("unrecognized subdirective '%s'", option)
+				}
 			}
 		}
 		if m.Endpoint == "" {
@@ -410,7 +2201,10 @@ func parseSize(s string) (int64, error) {
 
 var (
 	_ caddy.Provisioner           = (*MinioConfigModule)(nil)
+	_ caddy.Validator             = (*MinioConfigModule)(nil)
 	_ caddy.App                   = (*MinioConfigModule)(nil)
+	_ caddy.Validator             = (*MinioStaticHTML)(nil)
+	_ caddy.CleanerUpper          = (*MinioStaticHTML)(nil)
 	_ caddyhttp.MiddlewareHandler = (*MinioStaticHTML)(nil)
 	_ caddyfile.Unmarshaler       = (*MinioConfigModule)(nil)
 	_ caddy.CleanerUpper          = (*MinioConfigModule)(nil)
@@ -0,0 +1,104 @@
+package miniohandler
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// notificationEvents are the bucket events that invalidate a cache entry.
+var notificationEvents = []string{
+	"s3:ObjectCreated:*",
+	"s3:ObjectRemoved:*",
+}
+
+// startWatchers launches a notification listener for every bucket in
+// WatchBuckets. The listeners run until stopWatchers is called.
+func (m *MinioConfigModule) startWatchers() {
+	if len(m.WatchBuckets) == 0 {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancelWatch = cancel
+	m.watchers = new(sync.WaitGroup)
+	for _, bucket := range m.WatchBuckets {
+		m.watchers.Add(1)
+		go func(bucket string) {
+			defer m.watchers.Done()
+			m.watchBucket(ctx, bucket)
+		}(bucket)
+	}
+}
+
+// stopWatchers cancels all notification listeners and waits for them to exit.
+func (m *MinioConfigModule) stopWatchers() {
+	if m.cancelWatch == nil {
+		return
+	}
+	m.cancelWatch()
+	m.watchers.Wait()
+	m.cancelWatch = nil
+}
+
+// watchBucket subscribes to object events on bucket and purges the cache
+// entry of every object that is written or deleted. MinIO ends the stream
+// on any error, so the subscription is re-established with exponential
+// backoff until ctx is cancelled.
+func (m *MinioConfigModule) watchBucket(ctx context.Context, bucket string) {
+	const maxBackoff = 30 * time.Second
+	backoff := time.Second
+
+	for {
+		m.logger.Info("listening for bucket notifications", zap.String("bucket", bucket))
+		for info := range m.minioClient.ListenBucketNotification(ctx, bucket, "", "", notificationEvents) {
+			if info.Err != nil {
+				m.logger.Error("bucket notification error", zap.String("bucket", bucket), zap.Error(info.Err))
+				continue
+			}
+			backoff = time.Second
+			for _, record := range info.Records {
+				m.purgeForEvent(ctx, record.S3.Bucket.Name, record.S3.Object.Key, record.EventName)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// purgeForEvent evicts the cache entry of an object named in a notification.
+// Object keys arrive URL-encoded.
+func (m *MinioConfigModule) purgeForEvent(ctx context.Context, bucket, rawKey, event string) {
+	key, err := url.QueryUnescape(rawKey)
+	if err != nil {
+		key = rawKey
+	}
+	deleted, err := m.purgeObject(ctx, bucket, key)
+	if err != nil {
+		m.logger.Error("failed to purge cache entry for bucket event",
+			zap.String("bucket", bucket),
+			zap.String("key", key),
+			zap.String("event", event),
+			zap.Error(err),
+		)
+		return
+	}
+	m.logger.Debug("purged cache entry for bucket event",
+		zap.String("bucket", bucket),
+		zap.String("key", key),
+		zap.String("event", event),
+		zap.Int64("deleted", deleted),
+	)
+	m.events.emitPurged("notification", deleted, map[string]any{
+		"bucket": bucket,
+		"key":    key,
+		"event":  event,
+	})
+}
@@ -0,0 +1,142 @@
+package miniohandler
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/minio/minio-go/v7"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+)
+
+// errBreakerOpen is returned by fetchWithFailover when every origin's
+// circuit breaker is open.
+var errBreakerOpen = errors.New("minio circuit breaker open")
+
+// origin is one address objects can be fetched from.
+type origin struct {
+	endpoint string
+	client   *minio.Client
+	breaker  *breaker // nil if circuit breaking is disabled
+}
+
+// fetchWithFailover fetches an object from the primary origin, failing over
+// to each replica in turn when an origin is unhealthy: its breaker is open
+// or the fetch fails with a transport error, timeout or 5xx. Other errors,
+// such as NoSuchKey, are returned straight away.
+func (h *MinioStaticHTML) fetchWithFailover(ctx context.Context, bucket, objectKey string, opts minio.GetObjectOptions) (minio.ObjectInfo, []byte, error) {
+	if h.hedgeDelay > 0 && len(h.origins) > 1 {
+		return h.fetchHedged(ctx, bucket, objectKey, opts)
+	}
+
+	var (
+		objInfo minio.ObjectInfo
+		content []byte
+		err     = errBreakerOpen
+	)
+	for i, o := range h.origins {
+		if o.breaker != nil && !o.breaker.allow() {
+			continue
+		}
+		objInfo, content, err = h.fetchOrigin(ctx, o.client, bucket, objectKey, opts)
+		if o.breaker != nil {
+			o.breaker.done(err)
+		}
+		if err == nil || !originFailure(err) || ctx.Err() != nil {
+			return objInfo, content, err
+		}
+		if i < len(h.origins)-1 {
+			h.logger.Warn("minio origin failed; trying next replica",
+				zap.String("endpoint", o.endpoint),
+				zap.String("bucket", bucket),
+				zap.String("object_key", objectKey),
+				zap.Error(err))
+		}
+	}
+	return objInfo, content, err
+}
+
+// openWithFailover opens an object to stream it rather than read it whole,
+// failing over, breaking circuits and retrying as fetchWithFailover does.
+// The object is statted first, so errors such as NoSuchKey are returned
+// here rather than on the first read. The caller must close it.
+func (h *MinioStaticHTML) openWithFailover(ctx context.Context, bucket, objectKey string, opts minio.GetObjectOptions) (*minio.Object, minio.ObjectInfo, error) {
+	var (
+		obj     *minio.Object
+		objInfo minio.ObjectInfo
+		err     = errBreakerOpen
+	)
+	for i, o := range h.origins {
+		if o.breaker != nil && !o.breaker.allow() {
+			continue
+		}
+		obj, objInfo, err = h.openOrigin(ctx, o.client, bucket, objectKey, opts)
+		if o.breaker != nil {
+			o.breaker.done(err)
+		}
+		if err == nil || !originFailure(err) || ctx.Err() != nil {
+			return obj, objInfo, err
+		}
+		if i < len(h.origins)-1 {
+			h.logger.Warn("minio origin failed; trying next replica",
+				zap.String("endpoint", o.endpoint),
+				zap.String("bucket", bucket),
+				zap.String("object_key", objectKey),
+				zap.Error(err))
+		}
+	}
+	return obj, objInfo, err
+}
+
+// openObject opens an object in MinIO and stats it, passing opts to both.
+func (h *MinioStaticHTML) openObject(ctx context.Context, client *minio.Client, bucket, objectKey string, opts minio.GetObjectOptions) (*minio.Object, minio.ObjectInfo, error) {
+	// The object is read after the span ends, so it is opened with ctx.
+	_, span := h.startSpan(ctx, "minio.stat", bucket, objectKey)
+	defer span.End()
+	obj, err := client.GetObject(ctx, bucket, objectKey, opts)
+	if err != nil {
+		spanError(span, err)
+		return nil, minio.ObjectInfo{}, err
+	}
+	objInfo, err := obj.Stat()
+	if err != nil {
+		spanError(span, err)
+		obj.Close()
+		return nil, objInfo, err
+	}
+	span.SetAttributes(attribute.Int64("minio.size", objInfo.Size))
+	return obj, objInfo, nil
+}
+
+// fetchObject stats and downloads an object from MinIO, passing opts to both
+// calls. Errors are those returned by the MinIO client and are meant for
+// handleMinioError.
+func (h *MinioStaticHTML) fetchObject(ctx context.Context, client *minio.Client, bucket, objectKey string, opts minio.GetObjectOptions) (minio.ObjectInfo, []byte, error) {
+	spanCtx, span := h.startSpan(ctx, "minio.stat", bucket, objectKey)
+	objInfo, err := client.StatObject(spanCtx, bucket, objectKey, opts)
+	if err != nil {
+		spanError(span, err)
+		span.End()
+		return objInfo, nil, err
+	}
+	span.SetAttributes(attribute.Int64("minio.size", objInfo.Size))
+	span.End()
+
+	spanCtx, span = h.startSpan(ctx, "minio.get", bucket, objectKey)
+	defer span.End()
+	obj, err := client.GetObject(spanCtx, bucket, objectKey, opts)
+	if err != nil {
+		spanError(span, err)
+		return objInfo, nil, err
+	}
+	defer obj.Close()
+
+	content, err := io.ReadAll(obj)
+	if err != nil {
+		spanError(span, err)
+		return objInfo, nil, err
+	}
+	span.SetAttributes(attribute.Int("minio.bytes_read", len(content)))
+	return objInfo, content, nil
+}
@@ -0,0 +1,473 @@
+package miniohandler
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+)
+
+func init() {
+	caddy.RegisterModule(new(PeersBackend))
+}
+
+const (
+	// defaultPeerCacheSize is the memory limit used when max_size is not
+	// configured.
+	defaultPeerCacheSize = 256 << 20 // 256 MB
+
+	// peerCachePath is where peers serve each other's requests.
+	peerCachePath = "/_minio_cache"
+
+	// peerTokenHeader carries the shared token between peers.
+	peerTokenHeader = "X-Cache-Peer-Token"
+
+	// defaultPeerTimeout bounds each request to a peer.
+	defaultPeerTimeout = 2 * time.Second
+
+	// defaultDiscoveryInterval is how often discovery_dns is re-resolved.
+	defaultDiscoveryInterval = 30 * time.Second
+)
+
+// PeersBackend is an embedded cache distributed over a group of Caddy
+// instances, in the manner of groupcache: each key belongs to one peer,
+// chosen by consistent hashing, which keeps it in memory, and the others
+// reach it over HTTP. No separate cache server is needed, and adding or
+// removing a peer only moves the keys that hash to it.
+type PeersBackend struct {
+	// The base URL other peers reach this instance at, such as
+	// "http://10.0.0.1:7946". Required; may contain placeholders such as
+	// {env.POD_IP}.
+	Self string `json:"self,omitempty"`
+
+	// Base URLs of every peer, this instance included. Placeholders are
+	// expanded, and a placeholder expanding to a comma-separated list
+	// adds each entry.
+	Peers []string `json:"peers,omitempty"`
+
+	// DiscoveryDNS finds peers by resolving a host name, such as a
+	// Kubernetes headless service, to the addresses of the instances,
+	// instead of or as well as Peers. Every address is reached with the
+	// scheme and port of Self. It is re-resolved every DiscoveryInterval
+	// (default 30s).
+	DiscoveryDNS      string `json:"discovery_dns,omitempty"`
+	DiscoveryInterval string `json:"discovery_interval,omitempty"`
+
+	// Address to serve peer requests on. Default: the host and port of
+	// Self.
+	Listen string `json:"listen,omitempty"`
+
+	// Token that peers must present to each other. Required, as peers can
+	// write to the cache; may be a placeholder.
+	Token string `json:"token,omitempty"`
+
+	// Memory this instance gives its share of the cache, in bytes.
+	// Default: 256 MB.
+	MaxSize int64 `json:"max_size,omitempty"`
+
+	// Timeout of each request to a peer. Default: 2s.
+	Timeout string `json:"timeout,omitempty"`
+
+	logger *zap.Logger
+	store  *memStore
+	client *http.Client
+	server *http.Server
+	ln     net.Listener
+
+	ring hashRing
+
+	stopDiscovery context.CancelFunc
+}
+
+// peerRequest is the body of a request from one peer to another.
+type peerRequest struct {
+	Op     string        `json:"op"`
+	Keys   []string      `json:"keys,omitempty"`
+	Items  []CacheItem   `json:"items,omitempty"`
+	TTL    time.Duration `json:"ttl,omitempty"`
+	Prefix string        `json:"prefix,omitempty"`
+}
+
+// peerResponse is a peer's answer.
+type peerResponse struct {
+	Values [][]byte `json:"values,omitempty"`
+	N      int64    `json:"n,omitempty"`
+}
+
+// CaddyModule returns the Caddy module information for the backend.
+func (*PeersBackend) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "minio_static_html.cache.peers",
+		New: func() caddy.Module { return new(PeersBackend) },
+	}
+}
+
+// Provision builds the hash ring and starts serving peer requests.
+func (p *PeersBackend) Provision(ctx caddy.Context) error {
+	p.logger = ctx.Logger()
+	repl := caddy.NewReplacer()
+	p.Self = strings.TrimSuffix(repl.ReplaceAll(p.Self, ""), "/")
+	self, err := parsePeerURL(p.Self)
+	if err != nil {
+		return fmt.Errorf("invalid self: %w", err)
+	}
+	p.Token = repl.ReplaceAll(p.Token, "")
+	// Checked here as well as in Validate, which runs only once the peer
+	// server is already listening.
+	if p.Token == "" {
+		return fmt.Errorf("token is required")
+	}
+	var peers []string
+	for _, peer := range p.Peers {
+		for _, peer := range strings.Split(repl.ReplaceAll(peer, ""), ",") {
+			if peer = strings.TrimSuffix(strings.TrimSpace(peer), "/"); peer != "" {
+				peers = append(peers, peer)
+			}
+		}
+	}
+	p.Peers = peers
+
+	if p.MaxSize == 0 {
+		p.MaxSize = defaultPeerCacheSize
+	}
+	timeout := defaultPeerTimeout
+	if p.Timeout != "" {
+		dur, err := time.ParseDuration(p.Timeout)
+		if err != nil {
+			return fmt.Errorf("invalid timeout: %w", err)
+		}
+		timeout = dur
+	}
+	p.store = newMemStore(p.MaxSize)
+	p.client = &http.Client{Timeout: timeout}
+	p.setPeers(p.Peers)
+
+	listen := p.Listen
+	if listen == "" {
+		listen = self.Host
+	}
+	addr, err := caddy.ParseNetworkAddress(listen)
+	if err != nil {
+		return fmt.Errorf("invalid listen address: %w", err)
+	}
+	ln, err := addr.Listen(ctx, 0, net.ListenConfig{})
+	if err != nil {
+		return fmt.Errorf("listening for cache peers: %w", err)
+	}
+	p.ln = ln.(net.Listener)
+	mux := http.NewServeMux()
+	mux.HandleFunc(peerCachePath, p.servePeer)
+	p.server = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := p.server.Serve(p.ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			p.logger.Error("cache peer server stopped", zap.Error(err))
+		}
+	}()
+
+	if p.DiscoveryDNS != "" {
+		p.startDiscovery()
+	}
+	return nil
+}
+
+// Validate checks the peer settings.
+func (p *PeersBackend) Validate() error {
+	if len(p.Peers) == 0 && p.DiscoveryDNS == "" {
+		return fmt.Errorf("peers or discovery_dns must be specified")
+	}
+	if p.Token == "" {
+		return fmt.Errorf("token is required")
+	}
+	if p.MaxSize < 0 {
+		return fmt.Errorf("max_size must not be negative")
+	}
+	if p.DiscoveryInterval != "" {
+		if dur, err := time.ParseDuration(p.DiscoveryInterval); err != nil {
+			return fmt.Errorf("invalid discovery_interval: %w", err)
+		} else if dur <= 0 {
+			return fmt.Errorf("discovery_interval must be positive")
+		}
+	}
+	return nil
+}
+
+// Cleanup stops serving peers and discovering them.
+func (p *PeersBackend) Cleanup() error {
+	if p.stopDiscovery != nil {
+		p.stopDiscovery()
+	}
+	if p.server != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return p.server.Shutdown(ctx)
+	}
+	return nil
+}
+
+// String describes the backend for log messages.
+func (p *PeersBackend) String() string {
+	return "peers via " + p.Self
+}
+
+// setPeers rebuilds the hash ring from peers, always including this
+// instance.
+func (p *PeersBackend) setPeers(peers []string) {
+	p.ring.set(append(slices.Clone(peers), p.Self))
+}
+
+// parsePeerURL parses the base URL of a peer.
+func parsePeerURL(s string) (*url.URL, error) {
+	if s == "" {
+		return nil, fmt.Errorf("must be specified")
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("%q must be an http:// or https:// URL", s)
+	}
+	return u, nil
+}
+
+// startDiscovery re-resolves discovery_dns in the background.
+func (p *PeersBackend) startDiscovery() {
+	interval := defaultDiscoveryInterval
+	if p.DiscoveryInterval != "" {
+		// Already validated.
+		interval, _ = time.ParseDuration(p.DiscoveryInterval)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	p.stopDiscovery = cancel
+	go func() {
+		for {
+			p.discover(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(interval):
+			}
+		}
+	}()
+}
+
+// discover resolves discovery_dns and updates the ring with the addresses
+// found, keeping the current peers if the lookup fails.
+func (p *PeersBackend) discover(ctx context.Context) {
+	addrs, err := net.DefaultResolver.LookupHost(ctx, p.DiscoveryDNS)
+	if err != nil {
+		p.logger.Warn("cache peer discovery failed", zap.String("name", p.DiscoveryDNS), zap.Error(err))
+		return
+	}
+	self, err := parsePeerURL(p.Self)
+	if err != nil {
+		return
+	}
+	peers := slices.Clone(p.Peers)
+	for _, addr := range addrs {
+		peer := self.Scheme + "://" + net.JoinHostPort(addr, self.Port())
+		if !slices.Contains(peers, peer) {
+			peers = append(peers, peer)
+		}
+	}
+	old := p.ring.all()
+	p.setPeers(peers)
+	if current := p.ring.all(); !slices.Equal(old, current) {
+		p.logger.Info("cache peers changed", zap.Strings("peers", current))
+	}
+}
+
+// do runs req on peer, locally if it is this instance.
+func (p *PeersBackend) do(ctx context.Context, peer string, req peerRequest) (peerResponse, error) {
+	if peer == p.Self {
+		return p.apply(req)
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return peerResponse{}, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, peer+peerCachePath, bytes.NewReader(body))
+	if err != nil {
+		return peerResponse{}, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set(peerTokenHeader, p.Token)
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return peerResponse{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return peerResponse{}, fmt.Errorf("cache peer %s: %s", peer, resp.Status)
+	}
+	var out peerResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return peerResponse{}, fmt.Errorf("cache peer %s: decoding response: %w", peer, err)
+	}
+	return out, nil
+}
+
+// apply runs req against this instance's share of the cache.
+func (p *PeersBackend) apply(req peerRequest) (peerResponse, error) {
+	switch req.Op {
+	case "get":
+		return peerResponse{Values: p.store.get(req.Keys)}, nil
+	case "set":
+		p.store.set(req.TTL, req.Items)
+	case "expire":
+		p.store.expire(req.TTL, req.Keys)
+	case "exists":
+		return peerResponse{N: p.store.exists(req.Keys)}, nil
+	case "delete":
+		return peerResponse{N: p.store.delete(req.Keys)}, nil
+	case "delete_prefix":
+		return peerResponse{N: p.store.deletePrefix(req.Prefix)}, nil
+	case "ping":
+	default:
+		return peerResponse{}, fmt.Errorf("unknown operation %q", req.Op)
+	}
+	return peerResponse{}, nil
+}
+
+// servePeer answers another peer's request.
+func (p *PeersBackend) servePeer(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get(peerTokenHeader)), []byte(p.Token)) != 1 {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	var req peerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	resp, err := p.apply(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// Get reads each key from the peer it belongs to, asking every peer once.
+// Keys on peers that can't be reached are treated as missing.
+func (p *PeersBackend) Get(ctx context.Context, keys ...string) ([][]byte, error) {
+	values := make([][]byte, len(keys))
+	for peer, idx := range p.ring.group(keys) {
+		req := peerRequest{Op: "get", Keys: make([]string, len(idx))}
+		for j, i := range idx {
+			req.Keys[j] = keys[i]
+		}
+		resp, err := p.do(ctx, peer, req)
+		if err != nil {
+			p.logger.Debug("cache peer unavailable", zap.String("peer", peer), zap.Error(err))
+			continue
+		}
+		for j, i := range idx {
+			if j < len(resp.Values) {
+				values[i] = resp.Values[j]
+			}
+		}
+	}
+	return values, nil
+}
+
+// Set writes each item to the peer it belongs to.
+func (p *PeersBackend) Set(ctx context.Context, ttl time.Duration, items ...CacheItem) error {
+	keys := make([]string, len(items))
+	for i, item := range items {
+		keys[i] = item.Key
+	}
+	var errs []error
+	for peer, idx := range p.ring.group(keys) {
+		req := peerRequest{Op: "set", TTL: ttl, Items: make([]CacheItem, len(idx))}
+		for j, i := range idx {
+			req.Items[j] = items[i]
+		}
+		if _, err := p.do(ctx, peer, req); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Expire renews each key on the peer it belongs to.
+func (p *PeersBackend) Expire(ctx context.Context, ttl time.Duration, keys ...string) error {
+	_, err := p.byKeys(ctx, peerRequest{Op: "expire", TTL: ttl}, keys)
+	return err
+}
+
+// Exists counts the keys present on the peers they belong to.
+func (p *PeersBackend) Exists(ctx context.Context, keys ...string) (int64, error) {
+	return p.byKeys(ctx, peerRequest{Op: "exists"}, keys)
+}
+
+// Delete removes each key from the peer it belongs to.
+func (p *PeersBackend) Delete(ctx context.Context, keys ...string) (int64, error) {
+	return p.byKeys(ctx, peerRequest{Op: "delete"}, keys)
+}
+
+// byKeys sends req with the keys belonging to each peer, summing the
+// counts returned.
+func (p *PeersBackend) byKeys(ctx context.Context, req peerRequest, keys []string) (int64, error) {
+	var n int64
+	var errs []error
+	for peer, idx := range p.ring.group(keys) {
+		req.Keys = make([]string, len(idx))
+		for j, i := range idx {
+			req.Keys[j] = keys[i]
+		}
+		resp, err := p.do(ctx, peer, req)
+		n += resp.N
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return n, errors.Join(errs...)
+}
+
+// DeletePrefix removes the keys starting with prefix from every peer, as
+// they may belong to any of them.
+func (p *PeersBackend) DeletePrefix(ctx context.Context, prefix string) (int64, error) {
+	var n int64
+	var errs []error
+	for _, peer := range p.ring.all() {
+		resp, err := p.do(ctx, peer, peerRequest{Op: "delete_prefix", Prefix: prefix})
+		n += resp.N
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return n, errors.Join(errs...)
+}
+
+// Ping checks this instance is serving peers. Unreachable peers only cost
+// their share of the cache, so they don't count.
+func (p *PeersBackend) Ping(context.Context) error {
+	if p.server == nil {
+		return fmt.Errorf("cache peer server not running")
+	}
+	return nil
+}
+
+var (
+	_ caddy.Provisioner  = (*PeersBackend)(nil)
+	_ caddy.Validator    = (*PeersBackend)(nil)
+	_ caddy.CleanerUpper = (*PeersBackend)(nil)
+	_ CacheBackend       = (*PeersBackend)(nil)
+)
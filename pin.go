@@ -0,0 +1,55 @@
+package miniohandler
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+)
+
+// provisionPinning expands placeholders in pinned_set and checks the cache
+// can hold it.
+func (h *MinioStaticHTML) provisionPinning() error {
+	if h.PinnedSet == "" {
+		return nil
+	}
+	if _, ok := h.cache.(CacheSets); !ok {
+		return fmt.Errorf("pinned_set requires a cache backend that supports sets")
+	}
+	h.pinnedSet = caddy.NewReplacer().ReplaceAll(h.PinnedSet, "")
+	return nil
+}
+
+// validatePinning checks the pinned_keys globs.
+func (h *MinioStaticHTML) validatePinning() error {
+	for i, pattern := range h.PinnedKeys {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("pinned_keys[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// pinned reports whether objectKey is cached without an expiry: if it
+// matches pinned_keys or is a member of pinned_set. If the set can't be
+// read, which is logged, the object is not pinned.
+func (h *MinioStaticHTML) pinned(ctx context.Context, objectKey string) bool {
+	if matchAny(h.PinnedKeys, objectKey) {
+		return true
+	}
+	if h.pinnedSet == "" {
+		return false
+	}
+	found, err := h.cache.(CacheSets).SetContains(ctx, h.pinnedSet, objectKey)
+	if err != nil {
+		h.logger.Error("failed to read pinned set",
+			zap.String("set", h.pinnedSet),
+			zap.String("object_key", objectKey),
+			zap.Error(err))
+		h.observeRedisError("sismember")
+		return false
+	}
+	return found
+}
@@ -0,0 +1,191 @@
+package miniohandler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"go.uber.org/zap"
+)
+
+// precompressedExts maps the encodings accepted by precompressed to the
+// suffix of their sidecar objects.
+var precompressedExts = map[string]string{
+	"br":   ".br",
+	"gzip": ".gz",
+	"zstd": ".zst",
+}
+
+// encodingCacheKey returns the key a precompressed sidecar of an object is
+// cached under, beside the object's own entry so purging it drops them too.
+func encodingCacheKey(cacheKey, encoding string) string {
+	return cacheKey + ":enc:" + encoding
+}
+
+// compressedCacheKey returns the key a variant of an object compressed on
+// the fly is cached under. It differs from encodingCacheKey, as a sidecar
+// and a compressed original are different bodies with different ETags.
+func compressedCacheKey(cacheKey, encoding string) string {
+	return cacheKey + ":cenc:" + encoding
+}
+
+// validatePrecompressed checks precompressed lists only known encodings.
+func (h *MinioStaticHTML) validatePrecompressed() error {
+	for _, enc := range h.Precompressed {
+		if _, ok := precompressedExts[enc]; !ok {
+			return fmt.Errorf("precompressed: unknown encoding %q; must be br, gzip or zstd", enc)
+		}
+	}
+	return nil
+}
+
+// acceptedEncodings returns the encodings in offered that the
+// Accept-Encoding header allows, most preferred by the client first and
+// otherwise in the order offered.
+func acceptedEncodings(header string, offered []string) []string {
+	if header == "" {
+		return nil
+	}
+	qualities := make(map[string]float64)
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		qualities[strings.ToLower(strings.TrimSpace(name))] = q
+	}
+	var accepted []string
+	for _, enc := range offered {
+		q, ok := qualities[enc]
+		if !ok {
+			q, ok = qualities["*"]
+		}
+		if ok && q > 0 {
+			accepted = append(accepted, enc)
+		}
+	}
+	slices.SortStableFunc(accepted, func(a, b string) int {
+		qa, qb := qualities[a], qualities[b]
+		switch {
+		case qa > qb:
+			return -1
+		case qa < qb:
+			return 1
+		}
+		return 0
+	})
+	return accepted
+}
+
+// servePrecompressed serves a precompressed sidecar of objectKey, such as
+// objectKey+".br", if the client accepts its encoding and one exists. It
+// reports false if the plain object should be served instead. Missing
+// sidecars are remembered in the cache so they aren't looked for on every
+// request.
+func (h *MinioStaticHTML) servePrecompressed(w http.ResponseWriter, r *http.Request, bucket, objectKey, cacheKey string, opts minio.GetObjectOptions) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	ctx := r.Context()
+	if h.requestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.requestTimeout)
+		defer cancel()
+	}
+	encodings := acceptedEncodings(r.Header.Get("Accept-Encoding"), h.Precompressed)
+	if len(encodings) == 0 {
+		return false
+	}
+	cacheKeys := make([]string, len(encodings))
+	for i, enc := range encodings {
+		cacheKeys[i] = encodingCacheKey(cacheKey, enc)
+	}
+	// Every candidate's cache entry is read in one round trip.
+	cached := make([]*cacheEntry, len(encodings))
+	if h.readCache(r) {
+		cached = h.lookupCacheKeys(r.Context(), bucket, objectKey, r.Header.Get("Range") == "", cacheKeys...)
+	}
+	for i, enc := range encodings {
+		sidecarKey := objectKey + precompressedExts[enc]
+		sidecarCacheKey := cacheKeys[i]
+
+		if entry := cached[i]; entry != nil && !entry.obj.expired(time.Now()) {
+			if entry.obj.Missing {
+				continue
+			}
+			h.observeCache(cacheHit)
+			h.events.emit(eventCacheHit, map[string]any{"bucket": bucket, "key": sidecarKey})
+			h.serveFromCache(w, r, entry.obj, entry.content)
+			return true
+		}
+
+		objInfo, content, err := h.fetchWithFailover(ctx, bucket, sidecarKey, opts)
+		if err != nil {
+			if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+				if h.cacheEnabled() {
+					h.storeMissing(r.Context(), sidecarCacheKey)
+				}
+				continue
+			}
+			// Let the plain object's fetch deal with the failure.
+			h.logger.Debug("fetching precompressed object failed",
+				zap.String("bucket", bucket),
+				zap.String("object_key", sidecarKey),
+				zap.Error(err))
+			return false
+		}
+
+		objInfo.ContentType = h.contentTypeByExtension(objectKey)
+		if objInfo.Metadata == nil {
+			objInfo.Metadata = make(http.Header)
+		}
+		objInfo.Metadata.Set("Content-Encoding", enc)
+		if h.cacheEnabled() {
+			h.observeCache(cacheMiss)
+			h.events.emit(eventCacheMiss, map[string]any{"bucket": bucket, "key": sidecarKey})
+			h.storeInCache(r.Context(), sidecarCacheKey, bucket, sidecarKey, &objInfo, content, h.cacheTTLFor(r, &objInfo))
+		}
+		h.serveFromOrigin(w, r, &objInfo, content)
+		return true
+	}
+	return false
+}
+
+// contentTypeByExtension returns the content type for objectKey's
+// extension, honouring mime_types.
+func (h *MinioStaticHTML) contentTypeByExtension(objectKey string) string {
+	ext := strings.ToLower(path.Ext(objectKey))
+	if contentType, ok := h.MimeTypes[ext]; ok {
+		return contentType
+	}
+	if contentType := mime.TypeByExtension(ext); ext != "" && contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+// storeMissing records in the cache that the object for cacheKey does not
+// exist, for as long as objects are cached.
+func (h *MinioStaticHTML) storeMissing(ctx context.Context, cacheKey string) {
+	data, err := json.Marshal(CachedObject{Missing: true})
+	if err != nil {
+		return
+	}
+	h.writeCache(ctx, func(ctx context.Context) {
+		if err := h.cache.Set(ctx, h.jitterTTL(h.cacheTTL), CacheItem{cacheKey, data}); err != nil {
+			h.logger.Error("failed to SET missing-object marker in cache", zap.String("key", cacheKey), zap.Error(err))
+			h.observeRedisError("set")
+		}
+	})
+}
@@ -0,0 +1,127 @@
+package miniohandler
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// preloadRule lists the Link headers preloading the critical assets of
+// the pages matching path.
+type preloadRule struct {
+	path  []string
+	links []string
+}
+
+// preloadAsset is an asset in the preload manifest, given either as its
+// URL or as an object spelling out how it is preloaded.
+type preloadAsset struct {
+	Href        string `json:"href"`
+	As          string `json:"as,omitempty"`
+	Type        string `json:"type,omitempty"`
+	Crossorigin bool   `json:"crossorigin,omitempty"`
+}
+
+func (a *preloadAsset) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		return json.Unmarshal(data, &a.Href)
+	}
+	type plain preloadAsset
+	return json.Unmarshal(data, (*plain)(a))
+}
+
+// preloadAs maps extensions to the destination their assets are preloaded
+// as, when the manifest doesn't say.
+var preloadAs = map[string]string{
+	".css":   "style",
+	".js":    "script",
+	".mjs":   "script",
+	".woff":  "font",
+	".woff2": "font",
+	".ttf":   "font",
+	".otf":   "font",
+	".png":   "image",
+	".jpg":   "image",
+	".jpeg":  "image",
+	".gif":   "image",
+	".svg":   "image",
+	".webp":  "image",
+	".avif":  "image",
+}
+
+// parsePreload parses a preload manifest, a JSON object mapping page path
+// patterns, as in _headers, to the assets those pages need first:
+//
+//	{
+//	  "/": ["/css/site.css", "/img/hero.avif"],
+//	  "/blog/*": [{"href": "/fonts/body.woff2", "as": "font", "type": "font/woff2"}]
+//	}
+func parsePreload(data []byte, logger *zap.Logger) []preloadRule {
+	var manifest map[string][]preloadAsset
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		logger.Warn("skipping invalid preload manifest", zap.Error(err))
+		return nil
+	}
+	patterns := make([]string, 0, len(manifest))
+	for pattern := range manifest {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns) // the order of the links sent should not change
+
+	var rules []preloadRule
+	for _, pattern := range patterns {
+		if !strings.HasPrefix(pattern, "/") {
+			logger.Warn("skipping invalid preload path", zap.String("path", pattern))
+			continue
+		}
+		rule := preloadRule{path: splitPattern(pattern)}
+		for _, asset := range manifest[pattern] {
+			as := asset.As
+			if as == "" {
+				as = preloadAs[strings.ToLower(path.Ext(asset.Href))]
+			}
+			if asset.Href == "" || as == "" {
+				logger.Warn("skipping preload asset without a destination",
+					zap.String("path", pattern), zap.String("href", asset.Href))
+				continue
+			}
+			link := "<" + asset.Href + ">; rel=preload; as=" + as
+			if asset.Type != "" {
+				link += `; type="` + asset.Type + `"`
+			}
+			// Fonts are always fetched in CORS mode.
+			if asset.Crossorigin || as == "font" {
+				link += "; crossorigin"
+			}
+			rule.links = append(rule.links, link)
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// sendEarlyHints sends a 103 Early Hints response with the preload links
+// for the page r requests, so the client can fetch them while the page
+// itself is looked up. The links are kept for the final response too.
+func (h *MinioStaticHTML) sendEarlyHints(w http.ResponseWriter, r *http.Request, bucket, objectKey string) {
+	if h.preload == nil || r.Method != http.MethodGet || path.Ext(objectKey) != ".html" {
+		return
+	}
+	var links []string
+	for _, rule := range h.preload.get(bucket) {
+		if _, ok := matchPath(rule.path, r.URL.Path); ok {
+			links = append(links, rule.links...)
+		}
+	}
+	if len(links) == 0 {
+		return
+	}
+	for _, link := range links {
+		w.Header().Add("Link", link)
+	}
+	w.WriteHeader(http.StatusEarlyHints)
+}
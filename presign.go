@@ -0,0 +1,37 @@
+package miniohandler
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"go.uber.org/zap"
+)
+
+// defaultPresignExpiry is how long presigned URLs stay valid when
+// presign_expiry is not set.
+const defaultPresignExpiry = 15 * time.Minute
+
+// servePresignRedirect redirects the client to a presigned GET URL for the
+// object instead of proxying it, so the bytes flow straight from MinIO.
+// Presigning is done locally; a missing object is reported by MinIO when
+// the client follows the redirect.
+func (h *MinioStaticHTML) servePresignRedirect(w http.ResponseWriter, r *http.Request, bucket, objectKey string, opts minio.GetObjectOptions) {
+	var params url.Values
+	if opts.VersionID != "" {
+		params = url.Values{"versionId": {opts.VersionID}}
+	}
+	u, err := h.client.PresignedGetObject(r.Context(), bucket, objectKey, h.presignExpiry, params)
+	if err != nil {
+		h.logger.Error("failed to presign object URL",
+			zap.String("bucket", bucket),
+			zap.String("object_key", objectKey),
+			zap.Error(err))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	// The target expires, so the redirect itself must not be reused.
+	w.Header().Set("Cache-Control", "private, no-store")
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
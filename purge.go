@@ -0,0 +1,230 @@
+package miniohandler
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"go.uber.org/zap"
+)
+
+// defaultCacheKeyPrefix starts every cache key unless cache_key_prefix is
+// set.
+const defaultCacheKeyPrefix = "minio-cache"
+
+// provisionKeyPrefix works out the prefix of every cache key from
+// cache_key_prefix and cache_namespace, expanding placeholders in the
+// namespace.
+func (m *MinioConfig) provisionKeyPrefix() {
+	prefix := m.CacheKeyPrefix
+	if prefix == "" {
+		prefix = defaultCacheKeyPrefix
+	}
+	if ns := caddy.NewReplacer().ReplaceAll(m.CacheNamespace, ""); ns != "" {
+		prefix += ":" + ns
+	}
+	m.keyPrefix = prefix
+}
+
+// cacheKeyFor returns the DragonflyDB key an object is cached under, in
+// its bucket's current generation.
+func (m *MinioConfig) cacheKeyFor(ctx context.Context, bucket, objectKey string) string {
+	return m.bucketKeyPrefix(bucket, m.generation(ctx, bucket)) + objectKey
+}
+
+// bucketKeyPrefix returns the start of the keys of bucket's objects cached
+// in generation gen. Bucket names can't contain the @ separating them.
+func (m *MinioConfig) bucketKeyPrefix(bucket, gen string) string {
+	prefix := m.keyPrefix
+	if prefix == "" {
+		prefix = defaultCacheKeyPrefix
+	}
+	if gen != "" {
+		bucket += "@" + gen
+	}
+	return prefix + ":" + bucket + ":"
+}
+
+// purgeObject deletes the cache entry for a single object along with any
+// chunks it was split into, any cached versions and any variants. It returns
+// the number of keys removed.
+func (m *MinioConfig) purgeObject(ctx context.Context, bucket, objectKey string) (int64, error) {
+	return m.purgeCacheKey(ctx, m.cacheKeyFor(ctx, bucket, objectKey))
+}
+
+// purgeCacheKey deletes the cache entry at cacheKey and the keys belonging
+// to it.
+func (m *MinioConfig) purgeCacheKey(ctx context.Context, cacheKey string) (int64, error) {
+	deleted, err := m.cache.Delete(ctx, cacheKey)
+	if err != nil {
+		return 0, err
+	}
+	for _, suffix := range []string{":chunk:", ":version:", ":enc:", ":cenc:", ":vary:"} {
+		n, err := m.cache.DeletePrefix(ctx, cacheKey+suffix)
+		deleted += n
+		if errors.Is(err, errors.ErrUnsupported) {
+			// The backend can't find these keys; they are left to expire.
+			continue
+		} else if err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
+
+// softPurgeObject marks the cache entry for a single object stale instead
+// of deleting it: the next request revalidates it with MinIO, and it can
+// still be served stale if MinIO is unavailable. Encoded and vary variants
+// are deleted, to be rebuilt once the object is revalidated. It returns
+// the number of entries marked, which is 0 if the object isn't cached.
+func (m *MinioConfig) softPurgeObject(ctx context.Context, bucket, objectKey string) (int64, error) {
+	cacheKey := m.cacheKeyFor(ctx, bucket, objectKey)
+	raw, err := getOne(ctx, m.cache, cacheKey)
+	if errors.Is(err, errCacheMiss) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	var obj CachedObject
+	if err := json.Unmarshal(raw, &obj); err != nil || obj.Missing {
+		// Nothing worth keeping.
+		_, err := m.purgeObject(ctx, bucket, objectKey)
+		return 0, err
+	}
+	keepUntil := obj.StaleUntil
+	if keepUntil.IsZero() {
+		keepUntil = obj.ExpiresAt
+	}
+	ttl := time.Until(keepUntil)
+	if ttl <= 0 {
+		_, err := m.purgeObject(ctx, bucket, objectKey)
+		return 0, err
+	}
+
+	obj.Invalidated = true
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return 0, fmt.Errorf("marshaling cache entry: %w", err)
+	}
+	if err := m.cache.Set(ctx, ttl, CacheItem{cacheKey, data}); err != nil {
+		return 0, err
+	}
+	for _, suffix := range []string{":enc:", ":cenc:", ":vary:"} {
+		if _, err := m.cache.DeletePrefix(ctx, cacheKey+suffix); errors.Is(err, errors.ErrUnsupported) {
+			continue
+		} else if err != nil {
+			return 1, err
+		}
+	}
+	return 1, nil
+}
+
+// purgePrefix deletes the cache entries of every object in bucket whose key
+// starts with prefix. An empty prefix purges the whole bucket.
+func (m *MinioConfig) purgePrefix(ctx context.Context, bucket, prefix string) (int64, error) {
+	return m.cache.DeletePrefix(ctx, m.cacheKeyFor(ctx, bucket, prefix))
+}
+
+// servePurge handles an in-band PURGE request by evicting the cache entry
+// for objectKey.
+func (h *MinioStaticHTML) servePurge(w http.ResponseWriter, r *http.Request, bucket, objectKey string) error {
+	if h.PurgeToken == "" && len(h.purgeRanges) == 0 {
+		return caddyhttp.Error(http.StatusMethodNotAllowed, errors.New("PURGE is not enabled"))
+	}
+	if !h.purgeAllowed(r) {
+		return caddyhttp.Error(http.StatusForbidden, errors.New("PURGE not permitted"))
+	}
+
+	soft := strings.EqualFold(r.Header.Get("X-Purge-Mode"), "soft")
+	var n int64
+	if h.cache != nil {
+		var err error
+		if soft {
+			n, err = h.GlobalConfig.softPurgeObject(r.Context(), bucket, objectKey)
+		} else {
+			n, err = h.GlobalConfig.purgeObject(r.Context(), bucket, objectKey)
+		}
+		if err != nil {
+			return caddyhttp.Error(http.StatusInternalServerError, fmt.Errorf("purging cache: %w", err))
+		}
+	}
+
+	h.logger.Info("purged cache entry",
+		zap.String("bucket", bucket),
+		zap.String("key", objectKey),
+		zap.Bool("soft", soft),
+		zap.Int64("count", n),
+	)
+	h.events.emitPurged("purge_request", n, map[string]any{
+		"bucket": bucket,
+		"key":    objectKey,
+		"soft":   soft,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(purgeResult(soft, n))
+}
+
+// purgeResult is the JSON response to a purge: the number of keys deleted,
+// or for a soft purge the number of entries marked stale.
+func purgeResult(soft bool, n int64) map[string]int64 {
+	if soft {
+		return map[string]int64{"marked_stale": n}
+	}
+	return map[string]int64{"deleted": n}
+}
+
+// purgeAllowed reports whether r presents the purge token or originates
+// from an allowlisted address.
+func (h *MinioStaticHTML) purgeAllowed(r *http.Request) bool {
+	if h.PurgeToken != "" {
+		token := r.Header.Get("X-Purge-Token")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(h.PurgeToken)) == 1 {
+			return true
+		}
+	}
+	if len(h.purgeRanges) == 0 {
+		return false
+	}
+	ip, err := clientAddr(r)
+	if err != nil {
+		h.logger.Debug("could not determine client address for PURGE", zap.Error(err))
+		return false
+	}
+	for _, prefix := range h.purgeRanges {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientAddr returns the client IP as determined by Caddy, which honours
+// the server's trusted_proxies setting, falling back to the remote address.
+func clientAddr(r *http.Request) (netip.Addr, error) {
+	address, _ := caddyhttp.GetVar(r.Context(), caddyhttp.ClientIPVarKey).(string)
+	if address == "" {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		address = host
+	}
+	if i := strings.IndexByte(address, '%'); i >= 0 {
+		address = address[:i] // drop IPv6 zone
+	}
+	ip, err := netip.ParseAddr(address)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	return ip.Unmap(), nil
+}
@@ -0,0 +1,184 @@
+package miniohandler
+
+import (
+	"bufio"
+	"bytes"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+)
+
+// websiteRedirectHeader is the object metadata S3 static website hosting
+// uses to turn an object into a redirect.
+const websiteRedirectHeader = "X-Amz-Website-Redirect-Location"
+
+// serveWebsiteRedirect answers a request for an object that carries
+// website redirect metadata the way S3 website hosting does: with a 301 to
+// the target, which may be a path within the site or an absolute URL.
+func (h *MinioStaticHTML) serveWebsiteRedirect(w http.ResponseWriter, r *http.Request, location string) {
+	http.Redirect(w, r, location, http.StatusMovedPermanently)
+}
+
+// splitPattern splits a site file path pattern such as "/blog/:slug/*"
+// into the segments matchPath expects.
+func splitPattern(pattern string) []string {
+	return strings.Split(strings.Trim(pattern, "/"), "/")
+}
+
+// matchPath matches a URL path against pattern segments, in which ":name"
+// matches any one segment and a final "*" matches the rest of the path.
+// It returns the bound values, with the rest of the path as "splat".
+func matchPath(pattern []string, path string) (map[string]string, bool) {
+	params := make(map[string]string)
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i, p := range pattern {
+		if p == "*" && i == len(pattern)-1 {
+			params["splat"] = strings.Join(segments[min(i, len(segments)):], "/")
+			return params, true
+		}
+		if i >= len(segments) {
+			return nil, false
+		}
+		if name, ok := strings.CutPrefix(p, ":"); ok {
+			params[name] = segments[i]
+		} else if p != segments[i] {
+			return nil, false
+		}
+	}
+	return params, len(segments) == len(pattern)
+}
+
+// redirectRule is one line of a Netlify-style _redirects file:
+//
+//	/from/:param/*  [key=value ...]  /to/:param/:splat  [status][!]
+type redirectRule struct {
+	from   []string          // path segments; ":name" binds, a final "*" is the splat
+	query  map[string]string // required query parameters; ":name" values bind
+	to     string
+	status int // 3xx redirects; 200 rewrites to another object
+}
+
+// parseRedirects parses a _redirects file. Lines that can't be understood
+// are skipped and reported through logger so one typo doesn't disable the
+// whole file. A trailing "!" on the status is accepted for compatibility;
+// rules always apply before the object lookup, so every rule is forced.
+func parseRedirects(data []byte, logger *zap.Logger) []redirectRule {
+	var rules []redirectRule
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		rule, ok := parseRedirectRule(fields)
+		if !ok {
+			logger.Warn("skipping invalid _redirects rule",
+				zap.Int("line", line),
+				zap.String("rule", scanner.Text()))
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+func parseRedirectRule(fields []string) (redirectRule, bool) {
+	if len(fields) < 2 || !strings.HasPrefix(fields[0], "/") {
+		return redirectRule{}, false
+	}
+	rule := redirectRule{
+		from:   splitPattern(fields[0]),
+		status: http.StatusMovedPermanently,
+	}
+	rest := fields[1:]
+	for len(rest) > 0 && strings.Contains(rest[0], "=") {
+		key, value, _ := strings.Cut(rest[0], "=")
+		if rule.query == nil {
+			rule.query = make(map[string]string)
+		}
+		rule.query[key] = value
+		rest = rest[1:]
+	}
+	if len(rest) == 0 || len(rest) > 2 {
+		return redirectRule{}, false
+	}
+	rule.to = rest[0]
+	if len(rest) == 2 {
+		status, err := strconv.Atoi(strings.TrimSuffix(rest[1], "!"))
+		if err != nil {
+			return redirectRule{}, false
+		}
+		rule.status = status
+	}
+	switch {
+	case rule.status == http.StatusOK:
+		if !strings.HasPrefix(rule.to, "/") {
+			return redirectRule{}, false // can only rewrite within the bucket
+		}
+	case rule.status < 300 || rule.status > 308:
+		return redirectRule{}, false
+	}
+	return rule, true
+}
+
+// match reports whether the rule applies to r and, if so, returns its
+// target with :splat and named parameters substituted.
+func (rule redirectRule) match(r *http.Request) (string, bool) {
+	params, ok := matchPath(rule.from, r.URL.Path)
+	if !ok {
+		return "", false
+	}
+
+	if len(rule.query) > 0 {
+		query := r.URL.Query()
+		for key, want := range rule.query {
+			got := query.Get(key)
+			if got == "" {
+				return "", false
+			}
+			if name, ok := strings.CutPrefix(want, ":"); ok {
+				params[name] = got
+			} else if want != got {
+				return "", false
+			}
+		}
+	}
+
+	// Substitute longer names first so ":id" doesn't clobber ":idx".
+	names := slices.SortedFunc(maps.Keys(params), func(a, b string) int {
+		return len(b) - len(a)
+	})
+	to := rule.to
+	for _, name := range names {
+		to = strings.ReplaceAll(to, ":"+name, params[name])
+	}
+	return to, true
+}
+
+// applyRedirects applies the first _redirects rule matching r. Redirects
+// are written to w and reported as handled; rewrites (status 200) return
+// the object key to serve instead.
+func (h *MinioStaticHTML) applyRedirects(w http.ResponseWriter, r *http.Request, repl *caddy.Replacer, bucket string) (handled bool, objectKey string) {
+	for _, rule := range h.redirects.get(bucket) {
+		to, ok := rule.match(r)
+		if !ok {
+			continue
+		}
+		if rule.status == http.StatusOK {
+			u, err := url.Parse(to)
+			if err != nil {
+				continue
+			}
+			return false, h.keyForPath(u.Path, repl)
+		}
+		http.Redirect(w, r, to, rule.status)
+		return true, ""
+	}
+	return false, ""
+}
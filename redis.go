@@ -0,0 +1,471 @@
+package miniohandler
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func init() {
+	caddy.RegisterModule(RedisBackend{})
+}
+
+// purgeBatchSize bounds how many keys are requested per SCAN and deleted
+// per DEL while purging, so large purges don't block DragonflyDB.
+const purgeBatchSize = 500
+
+// RedisOptions configures a connection to DragonflyDB or Redis. They
+// appear at the top level of the global config, and in the config of the
+// redis cache backend.
+type RedisOptions struct {
+	ReddisAddress string `json:"reddis_address,omitempty"`
+
+	// RedisCluster lists seed nodes of a Redis Cluster to cache in, and
+	// RedisSentinelMaster names a master found through the RedisSentinels,
+	// as alternatives to the single node at ReddisAddress.
+	RedisCluster        []string `json:"redis_cluster,omitempty"`
+	RedisSentinelMaster string   `json:"redis_sentinel_master,omitempty"`
+	RedisSentinels      []string `json:"redis_sentinels,omitempty"`
+
+	// Credentials, database and TLS settings for the cache, overriding any
+	// given in ReddisAddress. RedisPassword may be a placeholder such as
+	// {env.REDIS_PASSWORD}, expanded at startup. RedisTLS enables TLS
+	// without further settings; the other TLS options imply it.
+	RedisUsername              string `json:"redis_username,omitempty"`
+	RedisPassword              string `json:"redis_password,omitempty"`
+	RedisDB                    int    `json:"redis_db,omitempty"`
+	RedisTLS                   bool   `json:"redis_tls,omitempty"`
+	RedisTLSCAFile             string `json:"redis_tls_ca_file,omitempty"`
+	RedisTLSClientCert         string `json:"redis_tls_client_cert,omitempty"`
+	RedisTLSClientKey          string `json:"redis_tls_client_key,omitempty"`
+	RedisTLSInsecureSkipVerify bool   `json:"redis_tls_insecure_skip_verify,omitempty"`
+
+	// Connection pool and timeouts of the cache client. The go-redis
+	// defaults (a pool of 10 connections per CPU, 5s dial and 3s read and
+	// write timeouts) apply to anything unset.
+	RedisPoolSize     int    `json:"redis_pool_size,omitempty"`
+	RedisMinIdleConns int    `json:"redis_min_idle_conns,omitempty"`
+	RedisDialTimeout  string `json:"redis_dial_timeout,omitempty"`
+	RedisReadTimeout  string `json:"redis_read_timeout,omitempty"`
+	RedisWriteTimeout string `json:"redis_write_timeout,omitempty"`
+}
+
+// RedisBackend is the cache backend for DragonflyDB and Redis, in single
+// node, cluster or Sentinel mode. It is used implicitly when the redis
+// options are set at the top level of the global config.
+type RedisBackend struct {
+	RedisOptions
+
+	client redis.UniversalClient
+}
+
+// CaddyModule returns the Caddy module information for the backend.
+func (RedisBackend) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "minio_static_html.cache.redis",
+		New: func() caddy.Module { return new(RedisBackend) },
+	}
+}
+
+// Provision creates the client. It doesn't connect until first used.
+func (b *RedisBackend) Provision(caddy.Context) error {
+	client, err := b.newRedisClient()
+	if err != nil {
+		return err
+	}
+	b.client = client
+	return nil
+}
+
+// Validate checks the connection settings.
+func (b *RedisBackend) Validate() error {
+	if !b.configured() {
+		return fmt.Errorf("one of reddis_address, redis_cluster or redis_sentinel_master must be set")
+	}
+	return b.validateRedis()
+}
+
+// Cleanup closes the client.
+func (b *RedisBackend) Cleanup() error {
+	if b.client != nil {
+		return b.client.Close()
+	}
+	return nil
+}
+
+// String describes the deployment for log messages.
+func (b *RedisBackend) String() string {
+	return b.cacheAddress()
+}
+
+// Get reads keys in a single pipelined round trip. (A pipeline rather than
+// MGET, which a cluster refuses for keys in different slots.)
+func (b *RedisBackend) Get(ctx context.Context, keys ...string) ([][]byte, error) {
+	gets := make([]*redis.StringCmd, len(keys))
+	_, err := b.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			gets[i] = pipe.Get(ctx, key)
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	values := make([][]byte, len(keys))
+	for i, get := range gets {
+		if data, err := get.Bytes(); err == nil {
+			values[i] = data
+		}
+	}
+	return values, nil
+}
+
+// Set writes items in a single transaction.
+func (b *RedisBackend) Set(ctx context.Context, ttl time.Duration, items ...CacheItem) error {
+	if len(items) == 1 {
+		return b.client.Set(ctx, items[0].Key, items[0].Value, ttl).Err()
+	}
+	_, err := b.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, item := range items {
+			pipe.Set(ctx, item.Key, item.Value, ttl)
+		}
+		return nil
+	})
+	return err
+}
+
+// Expire renews keys in a single pipelined round trip.
+func (b *RedisBackend) Expire(ctx context.Context, ttl time.Duration, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	_, err := b.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range keys {
+			pipe.Expire(ctx, key, ttl)
+		}
+		return nil
+	})
+	return err
+}
+
+// Exists counts the keys that exist, one per command, pipelined, since a
+// multi-key EXISTS is refused when the keys hash to different cluster
+// slots.
+func (b *RedisBackend) Exists(ctx context.Context, keys ...string) (int64, error) {
+	if len(keys) == 0 {
+		return 0, nil
+	}
+	cmds, err := b.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range keys {
+			pipe.Exists(ctx, key)
+		}
+		return nil
+	})
+	var found int64
+	for _, cmd := range cmds {
+		if exists, ok := cmd.(*redis.IntCmd); ok {
+			found += exists.Val()
+		}
+	}
+	return found, err
+}
+
+// Delete removes keys, one per command, pipelined, since a multi-key DEL
+// is refused when the keys hash to different cluster slots.
+func (b *RedisBackend) Delete(ctx context.Context, keys ...string) (int64, error) {
+	return deleteKeys(ctx, b.client, keys)
+}
+
+// DeletePrefix removes the keys starting with prefix, walking the keyspace
+// with SCAN rather than KEYS. In a cluster every master is walked, as each
+// holds part of the keyspace.
+func (b *RedisBackend) DeletePrefix(ctx context.Context, prefix string) (int64, error) {
+	pattern := escapeGlob(prefix) + "*"
+	cluster, ok := b.client.(*redis.ClusterClient)
+	if !ok {
+		return scanAndDelete(ctx, b.client, pattern)
+	}
+	var mu sync.Mutex
+	var deleted int64
+	err := cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+		n, err := scanAndDelete(ctx, node, pattern)
+		mu.Lock()
+		deleted += n
+		mu.Unlock()
+		return err
+	})
+	return deleted, err
+}
+
+// SetAdd adds members to a Redis set and renews its expiry. A zero ttl
+// makes the set persistent, as EXPIRE would delete it instead.
+func (b *RedisBackend) SetAdd(ctx context.Context, ttl time.Duration, key string, members ...string) error {
+	_, err := b.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, member := range members {
+			pipe.SAdd(ctx, key, member)
+		}
+		if ttl > 0 {
+			pipe.Expire(ctx, key, ttl)
+		} else {
+			pipe.Persist(ctx, key)
+		}
+		return nil
+	})
+	return err
+}
+
+// SetMembers returns the members of a Redis set.
+func (b *RedisBackend) SetMembers(ctx context.Context, key string) ([]string, error) {
+	return b.client.SMembers(ctx, key).Result()
+}
+
+// SetContains checks membership of a Redis set.
+func (b *RedisBackend) SetContains(ctx context.Context, key, member string) (bool, error) {
+	return b.client.SIsMember(ctx, key, member).Result()
+}
+
+// Ping checks the connection.
+func (b *RedisBackend) Ping(ctx context.Context) error {
+	return b.client.Ping(ctx).Err()
+}
+
+// deleteKeys removes keys with pipelined single-key DELs.
+func deleteKeys(ctx context.Context, client redis.Cmdable, keys []string) (int64, error) {
+	if len(keys) == 0 {
+		return 0, nil
+	}
+	cmds, err := client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range keys {
+			pipe.Del(ctx, key)
+		}
+		return nil
+	})
+	var deleted int64
+	for _, cmd := range cmds {
+		if del, ok := cmd.(*redis.IntCmd); ok {
+			deleted += del.Val()
+		}
+	}
+	return deleted, err
+}
+
+// scanAndDelete removes the keys matching pattern on a single node.
+func scanAndDelete(ctx context.Context, client redis.Cmdable, pattern string) (int64, error) {
+	var deleted int64
+	batch := make([]string, 0, purgeBatchSize)
+	iter := client.Scan(ctx, 0, pattern, purgeBatchSize).Iterator()
+	for iter.Next(ctx) {
+		batch = append(batch, iter.Val())
+		if len(batch) >= purgeBatchSize {
+			n, err := deleteKeys(ctx, client, batch)
+			deleted += n
+			if err != nil {
+				return deleted, err
+			}
+			batch = batch[:0]
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return deleted, err
+	}
+	n, err := deleteKeys(ctx, client, batch)
+	return deleted + n, err
+}
+
+// escapeGlob escapes the characters that are special in Redis MATCH
+// patterns so that s is matched literally.
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// configured reports whether a DragonflyDB/Redis deployment is configured,
+// in any mode.
+func (m *RedisOptions) configured() bool {
+	return m.ReddisAddress != "" || len(m.RedisCluster) > 0 || m.RedisSentinelMaster != ""
+}
+
+// cacheAddress describes the configured deployment for log messages.
+func (m *RedisOptions) cacheAddress() string {
+	switch {
+	case len(m.RedisCluster) > 0:
+		return "cluster " + strings.Join(m.RedisCluster, ",")
+	case m.RedisSentinelMaster != "":
+		return "sentinel master " + m.RedisSentinelMaster + " via " + strings.Join(m.RedisSentinels, ",")
+	}
+	return m.ReddisAddress
+}
+
+// validateRedis checks that exactly one way of reaching the cache is used.
+func (m *RedisOptions) validateRedis() error {
+	modes := 0
+	for _, set := range []bool{m.ReddisAddress != "", len(m.RedisCluster) > 0, m.RedisSentinelMaster != ""} {
+		if set {
+			modes++
+		}
+	}
+	if modes > 1 {
+		return fmt.Errorf("reddis_address, redis_cluster and redis_sentinel_master are mutually exclusive")
+	}
+	if m.RedisSentinelMaster != "" && len(m.RedisSentinels) == 0 {
+		return fmt.Errorf("redis_sentinel_master requires redis_sentinels")
+	}
+	if len(m.RedisSentinels) > 0 && m.RedisSentinelMaster == "" {
+		return fmt.Errorf("redis_sentinels requires redis_sentinel_master")
+	}
+	if m.RedisDB < 0 {
+		return fmt.Errorf("redis_db must not be negative")
+	}
+	if m.RedisDB != 0 && len(m.RedisCluster) > 0 {
+		return fmt.Errorf("redis_db cannot be used with redis_cluster, which only has database 0")
+	}
+	if m.RedisPoolSize < 0 || m.RedisMinIdleConns < 0 {
+		return fmt.Errorf("redis_pool_size and redis_min_idle_conns must not be negative")
+	}
+	if _, err := m.redisTimeouts(); err != nil {
+		return err
+	}
+	if (m.RedisTLSClientCert == "") != (m.RedisTLSClientKey == "") {
+		return fmt.Errorf("redis_tls_client_cert and redis_tls_client_key must be set together")
+	}
+	return nil
+}
+
+// newRedisClient connects to the configured single node, cluster or
+// Sentinel-managed master. Explicit credentials, database and TLS settings
+// override those in reddis_address.
+func (m *RedisOptions) newRedisClient() (redis.UniversalClient, error) {
+	tlsConfig, err := m.redisTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	password := caddy.NewReplacer().ReplaceAll(m.RedisPassword, "")
+	timeouts, err := m.redisTimeouts()
+	if err != nil {
+		return nil, err
+	}
+
+	if m.ReddisAddress != "" {
+		opt, err := redis.ParseURL(m.ReddisAddress)
+		if err != nil {
+			return nil, fmt.Errorf("invalid reddis_address URL: %w", err)
+		}
+		if m.RedisUsername != "" {
+			opt.Username = m.RedisUsername
+		}
+		if password != "" {
+			opt.Password = password
+		}
+		if m.RedisDB != 0 {
+			opt.DB = m.RedisDB
+		}
+		if tlsConfig != nil {
+			opt.TLSConfig = tlsConfig
+		}
+		if m.RedisPoolSize > 0 {
+			opt.PoolSize = m.RedisPoolSize
+		}
+		if m.RedisMinIdleConns > 0 {
+			opt.MinIdleConns = m.RedisMinIdleConns
+		}
+		if timeouts.dial > 0 {
+			opt.DialTimeout = timeouts.dial
+		}
+		if timeouts.read > 0 {
+			opt.ReadTimeout = timeouts.read
+		}
+		if timeouts.write > 0 {
+			opt.WriteTimeout = timeouts.write
+		}
+		return redis.NewClient(opt), nil
+	}
+	opts := &redis.UniversalOptions{
+		Username:  m.RedisUsername,
+		Password:  password,
+		DB:        m.RedisDB,
+		TLSConfig: tlsConfig,
+
+		PoolSize:     m.RedisPoolSize,
+		MinIdleConns: m.RedisMinIdleConns,
+		DialTimeout:  timeouts.dial,
+		ReadTimeout:  timeouts.read,
+		WriteTimeout: timeouts.write,
+	}
+	if len(m.RedisCluster) > 0 {
+		opts.Addrs = m.RedisCluster
+		opts.IsClusterMode = true
+	} else {
+		opts.Addrs = m.RedisSentinels
+		opts.MasterName = m.RedisSentinelMaster
+	}
+	return redis.NewUniversalClient(opts), nil
+}
+
+// redisTimeouts holds the parsed cache timeouts; zero means the go-redis
+// default.
+type redisTimeouts struct {
+	dial, read, write time.Duration
+}
+
+// redisTimeouts parses redis_dial_timeout, redis_read_timeout and
+// redis_write_timeout.
+func (m *RedisOptions) redisTimeouts() (redisTimeouts, error) {
+	var t redisTimeouts
+	for _, opt := range []struct {
+		name, value string
+		dst         *time.Duration
+	}{
+		{"redis_dial_timeout", m.RedisDialTimeout, &t.dial},
+		{"redis_read_timeout", m.RedisReadTimeout, &t.read},
+		{"redis_write_timeout", m.RedisWriteTimeout, &t.write},
+	} {
+		if opt.value == "" {
+			continue
+		}
+		dur, err := time.ParseDuration(opt.value)
+		if err != nil {
+			return t, fmt.Errorf("invalid %s: %w", opt.name, err)
+		} else if dur <= 0 {
+			return t, fmt.Errorf("%s must be positive", opt.name)
+		}
+		*opt.dst = dur
+	}
+	return t, nil
+}
+
+// redisTLSConfig returns the TLS settings for connecting to the cache, or
+// nil if none are configured.
+func (m *RedisOptions) redisTLSConfig() (*tls.Config, error) {
+	if !m.RedisTLS && m.RedisTLSCAFile == "" && m.RedisTLSClientCert == "" && !m.RedisTLSInsecureSkipVerify {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: m.RedisTLSInsecureSkipVerify,
+	}
+	if err := loadTLSConfig(tlsConfig, m.RedisTLSCAFile, m.RedisTLSClientCert, m.RedisTLSClientKey); err != nil {
+		return nil, fmt.Errorf("redis TLS: %w", err)
+	}
+	return tlsConfig, nil
+}
+
+var (
+	_ caddy.Provisioner  = (*RedisBackend)(nil)
+	_ caddy.Validator    = (*RedisBackend)(nil)
+	_ caddy.CleanerUpper = (*RedisBackend)(nil)
+	_ CacheBackend       = (*RedisBackend)(nil)
+	_ CacheSets          = (*RedisBackend)(nil)
+)
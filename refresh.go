@@ -0,0 +1,136 @@
+package miniohandler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"go.uber.org/zap"
+)
+
+// validateRefresh checks the background refresh settings.
+func (h *MinioStaticHTML) validateRefresh() error {
+	if h.RefreshInterval == "" {
+		if len(h.RefreshKeys) > 0 {
+			return fmt.Errorf("refresh_keys requires refresh_interval")
+		}
+		return nil
+	}
+	if dur, err := time.ParseDuration(h.RefreshInterval); err != nil {
+		return fmt.Errorf("invalid refresh_interval: %w", err)
+	} else if dur <= 0 {
+		return fmt.Errorf("refresh_interval must be positive")
+	}
+	if len(h.RefreshKeys) == 0 && h.WarmupManifest == "" {
+		return fmt.Errorf("refresh_interval requires refresh_keys or warmup_manifest")
+	}
+	for i, key := range h.RefreshKeys {
+		if strings.TrimPrefix(key, "/") == "" || strings.Contains(key, "..") {
+			return fmt.Errorf("refresh_keys[%d]: invalid object key %q", i, key)
+		}
+	}
+	return nil
+}
+
+// keepWarm refreshes the handler's refreshed objects every refresh_interval
+// until ctx is cancelled.
+func (h *MinioStaticHTML) keepWarm(ctx context.Context) {
+	ticker := time.NewTicker(h.refreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if !h.cacheEnabled() {
+			continue
+		}
+		for _, bucket := range h.staticBuckets() {
+			keys := h.refreshedKeys(ctx, bucket)
+			refreshed := h.forEachKey(ctx, keys, func(key string) bool {
+				return h.refreshObject(ctx, bucket, key)
+			})
+			if ctx.Err() != nil {
+				return
+			}
+			h.logger.Debug("refreshed cache entries",
+				zap.String("bucket", bucket),
+				zap.Int("checked", len(keys)),
+				zap.Int64("refreshed", refreshed))
+		}
+	}
+}
+
+// refreshedKeys returns the keys kept warm in bucket: refresh_keys and the
+// keys in the warm-up manifest, which is reread so deploys can change it.
+func (h *MinioStaticHTML) refreshedKeys(ctx context.Context, bucket string) []string {
+	keys := make([]string, 0, len(h.RefreshKeys))
+	for _, key := range h.RefreshKeys {
+		keys = append(keys, strings.TrimPrefix(key, "/"))
+	}
+	if h.WarmupManifest != "" {
+		manifest, err := h.loadManifest(ctx, bucket)
+		if err != nil {
+			h.logger.Warn("failed to load warm-up manifest for refresh",
+				zap.String("bucket", bucket),
+				zap.String("manifest", h.WarmupManifest),
+				zap.Error(err))
+		}
+		keys = append(keys, manifest...)
+	}
+	slices.Sort(keys)
+	return slices.Compact(keys)
+}
+
+// refreshObject re-fetches an object whose cache entry is missing or would
+// expire before the next refresh, with a quarter of refresh_interval to
+// spare. An object MinIO reports unchanged has its entry renewed without
+// being transferred again. It reports whether the entry was refreshed.
+func (h *MinioStaticHTML) refreshObject(ctx context.Context, bucket, objectKey string) bool {
+	cacheKey := h.GlobalConfig.cacheKeyFor(ctx, bucket, objectKey)
+	raw, err := getOne(ctx, h.cache, cacheKey)
+	if err != nil && !errors.Is(err, errCacheMiss) {
+		h.logger.Error("failed to read cache entry for refresh", zap.String("key", cacheKey), zap.Error(err))
+		h.observeRedisError("get")
+		return false
+	}
+
+	opts := minio.GetObjectOptions{ServerSideEncryption: h.sse}
+	var cached *CachedObject
+	if raw != nil {
+		var obj CachedObject
+		if json.Unmarshal(raw, &obj) == nil && !obj.Missing {
+			horizon := h.refreshInterval + h.refreshInterval/4
+			if !obj.Invalidated && (obj.ExpiresAt.IsZero() || time.Until(obj.ExpiresAt) > horizon) {
+				return false
+			}
+			cached = &obj
+			opts.SetMatchETagExcept(obj.ETag)
+		}
+	}
+
+	stored, err := h.fetchIntoCache(ctx, bucket, objectKey, cacheKey, opts)
+	switch {
+	case err == nil:
+		return stored
+	case isNotModified(err) && cached != nil:
+		if err := h.refreshEntry(ctx, cacheKey, cached); err != nil {
+			h.logger.Error("failed to renew cache entry", zap.String("key", cacheKey), zap.Error(err))
+			h.observeRedisError("set")
+			return false
+		}
+		return true
+	case ctx.Err() == nil:
+		h.logger.Warn("failed to refresh cached object",
+			zap.String("bucket", bucket),
+			zap.String("object_key", objectKey),
+			zap.Error(err))
+	}
+	return false
+}
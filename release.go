@@ -0,0 +1,99 @@
+package miniohandler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+)
+
+// defaultReleaseRefresh is how long the current release is remembered
+// when release_refresh is not configured.
+const defaultReleaseRefresh = time.Second
+
+// cachedRelease is a release pointer as last read from the cache.
+type cachedRelease struct {
+	value   string
+	fetched time.Time
+}
+
+// errNoRelease is returned when the release pointer has never been read
+// and can't be now.
+var errNoRelease = errors.New("no current release")
+
+// provisionRelease parses release_refresh and checks the release pointer
+// can be read.
+func (h *MinioStaticHTML) provisionRelease() error {
+	if h.ReleaseKey == "" {
+		return nil
+	}
+	if h.cache == nil {
+		return fmt.Errorf("release_key requires a cache backend")
+	}
+	h.releaseRefresh = defaultReleaseRefresh
+	if h.ReleaseRefresh != "" {
+		dur, err := time.ParseDuration(h.ReleaseRefresh)
+		if err != nil {
+			return fmt.Errorf("invalid release_refresh: %w", err)
+		}
+		h.releaseRefresh = dur
+	}
+	return nil
+}
+
+// releaseKey prefixes objectKey with the current release, when
+// release_key is configured, so flipping the pointer switches every
+// object served at once.
+func (h *MinioStaticHTML) releaseKey(ctx context.Context, repl *caddy.Replacer, objectKey string) (string, error) {
+	if h.ReleaseKey == "" {
+		return objectKey, nil
+	}
+	release, err := h.currentRelease(ctx, repl.ReplaceAll(h.ReleaseKey, ""))
+	if err != nil {
+		return "", err
+	}
+	if release == "" {
+		return objectKey, nil
+	}
+	return strings.TrimSuffix(release, "/") + "/" + objectKey, nil
+}
+
+// currentRelease returns the release prefix stored under pointer, read
+// from the cache at most once per release_refresh. If the cache can't be
+// read, the last release seen is used.
+func (h *MinioStaticHTML) currentRelease(ctx context.Context, pointer string) (string, error) {
+	last, ok := h.releases.Load(pointer)
+	if ok && time.Since(last.(cachedRelease).fetched) < h.releaseRefresh {
+		return last.(cachedRelease).value, nil
+	}
+	raw, err := getOne(ctx, h.cache, pointer)
+	if errors.Is(err, errCacheMiss) {
+		err = fmt.Errorf("release key %q is not set", pointer)
+	}
+	if err != nil {
+		if ok {
+			h.logger.Warn("failed to read release key; keeping the last release",
+				zap.String("key", pointer),
+				zap.String("release", last.(cachedRelease).value),
+				zap.Error(err))
+			return last.(cachedRelease).value, nil
+		}
+		return "", fmt.Errorf("%w: %v", errNoRelease, err)
+	}
+	release := strings.Trim(strings.TrimSpace(string(raw)), "/")
+	if strings.Contains(release, "..") {
+		return "", fmt.Errorf("%w: invalid release %q", errNoRelease, release)
+	}
+	if ok && last.(cachedRelease).value != release {
+		h.logger.Info("switched release",
+			zap.String("key", pointer),
+			zap.String("from", last.(cachedRelease).value),
+			zap.String("to", release))
+	}
+	h.releases.Store(pointer, cachedRelease{release, time.Now()})
+	return release, nil
+}
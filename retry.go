@@ -0,0 +1,92 @@
+package miniohandler
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"go.uber.org/zap"
+)
+
+// defaultRetryCodes are the S3 error codes and HTTP statuses that are
+// retried when retry_codes is not set.
+var defaultRetryCodes = []string{
+	"500", "502", "503", "504",
+	"InternalError", "ServiceUnavailable", "SlowDown", "RequestTimeout",
+}
+
+// defaultRetryDelay is the backoff before the first retry.
+const defaultRetryDelay = 100 * time.Millisecond
+
+// fetchOrigin fetches an object from MinIO, retrying transient failures up
+// to Retries times. The delay starts at RetryDelay and doubles after each
+// attempt; retries stop early if ctx is done.
+func (h *MinioStaticHTML) fetchOrigin(ctx context.Context, client *minio.Client, bucket, objectKey string, opts minio.GetObjectOptions) (minio.ObjectInfo, []byte, error) {
+	delay := h.retryDelay
+	for attempt := 0; ; attempt++ {
+		objInfo, content, err := h.fetchObject(ctx, client, bucket, objectKey, opts)
+		if err == nil || attempt >= h.Retries || !h.retryable(ctx, err) {
+			return objInfo, content, err
+		}
+		h.logger.Debug("retrying minio request",
+			zap.String("bucket", bucket),
+			zap.String("object_key", objectKey),
+			zap.Int("attempt", attempt+1),
+			zap.Duration("delay", delay),
+			zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+			return objInfo, nil, err
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// openOrigin opens an object in MinIO as fetchOrigin fetches one, retrying
+// transient failures to open it. Failures once it is being read are not
+// retried.
+func (h *MinioStaticHTML) openOrigin(ctx context.Context, client *minio.Client, bucket, objectKey string, opts minio.GetObjectOptions) (*minio.Object, minio.ObjectInfo, error) {
+	delay := h.retryDelay
+	for attempt := 0; ; attempt++ {
+		obj, objInfo, err := h.openObject(ctx, client, bucket, objectKey, opts)
+		if err == nil || attempt >= h.Retries || !h.retryable(ctx, err) {
+			return obj, objInfo, err
+		}
+		h.logger.Debug("retrying minio request",
+			zap.String("bucket", bucket),
+			zap.String("object_key", objectKey),
+			zap.Int("attempt", attempt+1),
+			zap.Duration("delay", delay),
+			zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+			return nil, objInfo, err
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// retryable reports whether err is worth retrying: an S3 error whose code
+// or HTTP status is in the retry list, or a transport error that isn't due
+// to ctx ending.
+func (h *MinioStaticHTML) retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	resp := minio.ToErrorResponse(err)
+	if resp.Code == "" && resp.StatusCode == 0 {
+		return true
+	}
+	codes := h.RetryCodes
+	if len(codes) == 0 {
+		codes = defaultRetryCodes
+	}
+	return slices.Contains(codes, resp.Code) ||
+		slices.Contains(codes, strconv.Itoa(resp.StatusCode))
+}
@@ -0,0 +1,97 @@
+package miniohandler
+
+import (
+	"hash/fnv"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ringVirtualNodes is how many points each node gets on a hash ring, so
+// keys spread evenly however few nodes there are.
+const ringVirtualNodes = 100
+
+// hashRing assigns keys to nodes by consistent hashing, so adding or
+// removing a node only moves the keys that hash to it.
+type hashRing struct {
+	mu     sync.RWMutex
+	points []ringPoint
+	nodes  []string
+}
+
+// ringPoint is a node's position on the ring.
+type ringPoint struct {
+	hash uint64
+	node string
+}
+
+// set replaces the nodes on the ring.
+func (r *hashRing) set(nodes []string) {
+	nodes = slices.Compact(slices.Sorted(slices.Values(nodes)))
+	points := make([]ringPoint, 0, len(nodes)*ringVirtualNodes)
+	for _, node := range nodes {
+		for i := range ringVirtualNodes {
+			points = append(points, ringPoint{hashKey(strconv.Itoa(i) + node), node})
+		}
+	}
+	slices.SortFunc(points, func(a, b ringPoint) int {
+		switch {
+		case a.hash < b.hash:
+			return -1
+		case a.hash > b.hash:
+			return 1
+		}
+		return strings.Compare(a.node, b.node)
+	})
+	r.mu.Lock()
+	r.points, r.nodes = points, nodes
+	r.mu.Unlock()
+}
+
+// get returns the node key belongs to, or "" if the ring is empty.
+func (r *hashRing) get(key string) string {
+	h := hashKey(key)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if len(r.points) == 0 {
+		return ""
+	}
+	i, _ := slices.BinarySearchFunc(r.points, h, func(pt ringPoint, h uint64) int {
+		switch {
+		case pt.hash < h:
+			return -1
+		case pt.hash > h:
+			return 1
+		}
+		return 0
+	})
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.points[i].node
+}
+
+// all returns every node on the ring, sorted.
+func (r *hashRing) all() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return slices.Clone(r.nodes)
+}
+
+// group returns the indexes of keys grouped by the node they belong to.
+func (r *hashRing) group(keys []string) map[string][]int {
+	groups := make(map[string][]int)
+	for i, key := range keys {
+		node := r.get(key)
+		groups[node] = append(groups[node], i)
+	}
+	return groups
+}
+
+// hashKey places a key or node on the ring.
+func hashKey(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return h.Sum64()
+}
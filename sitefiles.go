@@ -0,0 +1,209 @@
+package miniohandler
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+)
+
+// defaultSiteFileRefresh is how often site files are reloaded when no
+// refresh interval is configured.
+const defaultSiteFileRefresh = time.Minute
+
+// maxSiteFileBuckets bounds how many per-request buckets' copies of a site
+// file are kept, so a placeholder bucket can't grow memory without limit.
+const maxSiteFileBuckets = 1024
+
+// siteFile is a configuration file deployed inside the served bucket, such
+// as _redirects or _headers. Copies from buckets known at provision time
+// are loaded up front and reloaded periodically so changes ship with the
+// next deploy. Buckets resolved per request are loaded on first use and
+// kept in a bounded LRU until the refresh interval passes, after which
+// the next request loads them again.
+type siteFile[T any] struct {
+	h        *MinioStaticHTML
+	key      string
+	parse    func(data []byte, logger *zap.Logger) T
+	interval time.Duration
+
+	mu       sync.RWMutex
+	resident map[string]T // static buckets
+
+	dynMu sync.Mutex
+	index map[string]*list.Element // values are *siteFileEntry[T]
+	lru   *list.List               // most recently used first
+	loads singleflight.Group
+
+	stop func()
+}
+
+// siteFileEntry is a per-request bucket's copy of a site file.
+type siteFileEntry[T any] struct {
+	bucket  string
+	parsed  T
+	expires time.Time
+}
+
+// newSiteFile loads key from the handler's static buckets and starts the
+// refresh loop. refresh is a duration string; empty means the default.
+func newSiteFile[T any](h *MinioStaticHTML, key, refresh string, parse func([]byte, *zap.Logger) T) (*siteFile[T], error) {
+	interval := defaultSiteFileRefresh
+	if refresh != "" {
+		dur, err := time.ParseDuration(refresh)
+		if err != nil {
+			return nil, err
+		}
+		if dur <= 0 {
+			return nil, fmt.Errorf("must be positive")
+		}
+		interval = dur
+	}
+
+	f := &siteFile[T]{
+		h:        h,
+		key:      key,
+		parse:    parse,
+		interval: interval,
+		resident: make(map[string]T),
+		index:    make(map[string]*list.Element),
+		lru:      list.New(),
+	}
+	for _, bucket := range h.staticBuckets() {
+		// A failed load leaves the zero value; the next refresh retries.
+		parsed, _ := f.load(bucket)
+		f.resident[bucket] = parsed
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	f.stop = func() {
+		cancel()
+		<-done
+	}
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			f.refresh()
+		}
+	}()
+	return f, nil
+}
+
+// refresh reloads the static buckets' copies, keeping the previous one of
+// any that fails to load.
+func (f *siteFile[T]) refresh() {
+	f.mu.RLock()
+	buckets := make([]string, 0, len(f.resident))
+	for bucket := range f.resident {
+		buckets = append(buckets, bucket)
+	}
+	f.mu.RUnlock()
+	for _, bucket := range buckets {
+		parsed, err := f.load(bucket)
+		if err != nil {
+			continue
+		}
+		f.mu.Lock()
+		f.resident[bucket] = parsed
+		f.mu.Unlock()
+	}
+}
+
+// get returns the parsed file for bucket, loading it if it isn't held or
+// has expired. Concurrent loads of the same bucket are shared.
+func (f *siteFile[T]) get(bucket string) T {
+	f.mu.RLock()
+	parsed, ok := f.resident[bucket]
+	f.mu.RUnlock()
+	if ok {
+		return parsed
+	}
+
+	now := time.Now()
+	f.dynMu.Lock()
+	var stale *siteFileEntry[T]
+	if el, ok := f.index[bucket]; ok {
+		entry := el.Value.(*siteFileEntry[T])
+		if now.Before(entry.expires) {
+			f.lru.MoveToFront(el)
+			f.dynMu.Unlock()
+			return entry.parsed
+		}
+		stale = entry
+	}
+	f.dynMu.Unlock()
+
+	v, _, _ := f.loads.Do(bucket, func() (any, error) {
+		parsed, err := f.load(bucket)
+		if err != nil && stale != nil {
+			// Keep serving the last good copy rather than dropping the
+			// rules while MinIO is failing.
+			parsed = stale.parsed
+		}
+		f.store(bucket, parsed, time.Now().Add(f.interval))
+		return parsed, nil
+	})
+	return v.(T)
+}
+
+// store records a per-request bucket's copy, evicting the least recently
+// used ones beyond maxSiteFileBuckets.
+func (f *siteFile[T]) store(bucket string, parsed T, expires time.Time) {
+	f.dynMu.Lock()
+	defer f.dynMu.Unlock()
+	if el, ok := f.index[bucket]; ok {
+		entry := el.Value.(*siteFileEntry[T])
+		entry.parsed, entry.expires = parsed, expires
+		f.lru.MoveToFront(el)
+		return
+	}
+	f.index[bucket] = f.lru.PushFront(&siteFileEntry[T]{bucket: bucket, parsed: parsed, expires: expires})
+	for f.lru.Len() > maxSiteFileBuckets {
+		entry := f.lru.Remove(f.lru.Back()).(*siteFileEntry[T])
+		delete(f.index, entry.bucket)
+	}
+}
+
+// load fetches and parses the file from bucket. A missing file yields the
+// zero value; other errors are logged and returned.
+func (f *siteFile[T]) load(bucket string) (T, error) {
+	var zero T
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	obj, err := f.h.client.GetObject(ctx, bucket, f.key, minio.GetObjectOptions{ServerSideEncryption: f.h.sse})
+	if err == nil {
+		defer obj.Close()
+		var data []byte
+		data, err = io.ReadAll(obj)
+		if err == nil {
+			return f.parse(data, f.h.logger.With(zap.String("bucket", bucket), zap.String("file", f.key))), nil
+		}
+	}
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return zero, nil
+	}
+	f.h.logger.Warn("failed to load site file",
+		zap.String("bucket", bucket),
+		zap.String("object_key", f.key),
+		zap.Error(err))
+	return zero, err
+}
+
+// close stops the refresh loop.
+func (f *siteFile[T]) close() {
+	f.stop()
+}
@@ -0,0 +1,93 @@
+package miniohandler
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// Snippet is an HTML fragment inserted into every HTML document served,
+// such as an analytics script or a cookie banner.
+type Snippet struct {
+	// Where the fragment goes: "head", just before </head>, or "body",
+	// just before </body> (the default). Documents without the tag get a
+	// body snippet at their end, and no head snippet.
+	Position string `json:"position,omitempty"`
+
+	// The fragment itself, or a local file holding it.
+	HTML string `json:"html,omitempty"`
+	File string `json:"file,omitempty"`
+
+	html []byte
+}
+
+// provisionSnippets reads snippets kept in files.
+func (h *MinioStaticHTML) provisionSnippets() error {
+	for i := range h.Snippets {
+		s := &h.Snippets[i]
+		s.html = []byte(s.HTML)
+		if s.File == "" {
+			continue
+		}
+		data, err := os.ReadFile(s.File)
+		if err != nil {
+			return fmt.Errorf("snippets[%d]: reading file: %w", i, err)
+		}
+		s.html = data
+	}
+	return nil
+}
+
+// validateSnippets checks the snippet settings.
+func (h *MinioStaticHTML) validateSnippets() error {
+	for i, s := range h.Snippets {
+		switch s.Position {
+		case "", "head", "body":
+		default:
+			return fmt.Errorf("snippets[%d]: invalid position %q; must be head or body", i, s.Position)
+		}
+		if (s.HTML == "") == (s.File == "") {
+			return fmt.Errorf("snippets[%d]: exactly one of html and file must be set", i)
+		}
+	}
+	return nil
+}
+
+// prepareObject finishes an object fetched from MinIO before it is cached
+// or served: its type is corrected and snippets are injected. It returns
+// the content to use.
+func (h *MinioStaticHTML) prepareObject(objectKey string, objInfo *minio.ObjectInfo, content []byte) []byte {
+	h.fixContentType(objectKey, objInfo, content)
+	return h.injectSnippets(objInfo, content)
+}
+
+// injectSnippets inserts the snippets into an HTML document. Documents
+// stored compressed are left alone.
+func (h *MinioStaticHTML) injectSnippets(objInfo *minio.ObjectInfo, content []byte) []byte {
+	if len(h.Snippets) == 0 || !strings.HasPrefix(objInfo.ContentType, "text/html") ||
+		objInfo.Metadata.Get("Content-Encoding") != "" {
+		return content
+	}
+	out := content
+	for _, s := range h.Snippets {
+		tag := "</body>"
+		if s.Position == "head" {
+			tag = "</head>"
+		}
+		i := bytes.LastIndex(bytes.ToLower(out), []byte(tag))
+		switch {
+		case i >= 0:
+			injected := make([]byte, 0, len(out)+len(s.html))
+			injected = append(injected, out[:i]...)
+			injected = append(injected, s.html...)
+			out = append(injected, out[i:]...)
+		case s.Position != "head":
+			out = append(out[:len(out):len(out)], s.html...)
+		}
+	}
+	objInfo.Size = int64(len(out))
+	return out
+}
@@ -0,0 +1,28 @@
+package miniohandler
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/minio/minio-go/v7/pkg/encrypt"
+)
+
+// provisionSSEC decodes the route's SSE-C key, if any. The key may be given
+// as a placeholder such as {env.SSE_KEY} so it needn't appear in the config.
+func (h *MinioStaticHTML) provisionSSEC() error {
+	if h.SSECustomerKey == "" {
+		return nil
+	}
+	encoded := caddy.NewReplacer().ReplaceAll(h.SSECustomerKey, "")
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return fmt.Errorf("sse_customer_key must be base64-encoded: %w", err)
+	}
+	sse, err := encrypt.NewSSEC(key)
+	if err != nil {
+		return fmt.Errorf("invalid sse_customer_key: %w", err)
+	}
+	h.sse = sse
+	return nil
+}
@@ -0,0 +1,101 @@
+package miniohandler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"go.uber.org/zap"
+)
+
+// Values of the X-Cache-Status response header.
+const (
+	cacheStatusHit         = "HIT"
+	cacheStatusMiss        = "MISS"
+	cacheStatusStale       = "STALE"
+	cacheStatusRevalidated = "REVALIDATED"
+	cacheStatusBypass      = "BYPASS"
+	cacheStatusExpired     = "EXPIRED"
+)
+
+// cacheStatusVar is the request variable holding the cache status of a
+// response, available as {http.vars.minio_cache_status}.
+const cacheStatusVar = "minio_cache_status"
+
+// setCacheStatus records the cache status of the response to r.
+func setCacheStatus(r *http.Request, status string) {
+	caddyhttp.SetVar(r.Context(), cacheStatusVar, status)
+}
+
+// cacheStatus returns the cache status recorded for r, or fallback if
+// none is.
+func cacheStatus(r *http.Request, fallback string) string {
+	if status, _ := caddyhttp.GetVar(r.Context(), cacheStatusVar).(string); status != "" {
+		return status
+	}
+	return fallback
+}
+
+// writeCacheStatus sets the X-Cache-Status header of the response to r to
+// its recorded status, or else fallback, and records that.
+func writeCacheStatus(w http.ResponseWriter, r *http.Request, fallback string) {
+	status := cacheStatus(r, fallback)
+	setCacheStatus(r, status)
+	w.Header().Set("X-Cache-Status", status)
+}
+
+// expired reports whether a cache entry is past its TTL and only kept for
+// stale_ttl, or was soft-purged. Entries written without an expiry time
+// never expire.
+func (obj *CachedObject) expired(now time.Time) bool {
+	return obj.Invalidated || !obj.ExpiresAt.IsZero() && now.After(obj.ExpiresAt)
+}
+
+// setAge sets the Age header of a response served from the cache.
+func setAge(w http.ResponseWriter, obj *CachedObject) {
+	if obj.CachedAt.IsZero() {
+		return
+	}
+	age := max(time.Since(obj.CachedAt), 0)
+	w.Header().Set("Age", strconv.FormatInt(int64(age/time.Second), 10))
+}
+
+// refreshEntry renews an expired cache entry that MinIO confirmed is still
+// current, for as long as it was originally cached, without rewriting its
+// content.
+func (h *MinioStaticHTML) refreshEntry(ctx context.Context, cacheKey string, obj *CachedObject) error {
+	ttl := obj.ExpiresAt.Sub(obj.CachedAt)
+	expiry := ttl + h.staleTTL
+	obj.CachedAt = time.Now()
+	obj.ExpiresAt = obj.CachedAt.Add(ttl)
+	obj.StaleUntil = obj.CachedAt.Add(expiry)
+	obj.Invalidated = false
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return fmt.Errorf("marshaling cache entry: %w", err)
+	}
+	// Chunks are renewed first so the entry never outlives them.
+	if err := h.cache.Expire(ctx, expiry, chunkKeys(cacheKey, obj)...); err != nil {
+		return err
+	}
+	if err := h.cache.Set(ctx, expiry, CacheItem{cacheKey, data}); err != nil {
+		return err
+	}
+	h.tagEntry(ctx, cacheKey, obj.SurrogateKeys, expiry)
+	return nil
+}
+
+// serveStale serves an expired cache entry after MinIO failed to provide a
+// fresh copy.
+func (h *MinioStaticHTML) serveStale(w http.ResponseWriter, r *http.Request, cacheKey string, obj *CachedObject, content io.ReadSeeker, err error) {
+	h.logger.Warn("minio fetch failed, serving stale cache entry",
+		zap.String("key", cacheKey),
+		zap.Error(err))
+	setCacheStatus(r, cacheStatusStale)
+	h.serveFromCache(w, r, obj, content)
+}
@@ -0,0 +1,170 @@
+package miniohandler
+
+import (
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// latencySamples is how many recent cache operations latency percentiles
+// are computed over.
+const latencySamples = 1024
+
+// handlerStats accumulates, next to the Prometheus metrics, the counters
+// served by the admin stats endpoint. Like the metrics they are process
+// wide and survive config reloads.
+var handlerStats = struct {
+	started time.Time
+	buckets sync.Map // configured bucket -> *bucketCounters
+	get     latencyRing
+	set     latencyRing
+}{started: time.Now()}
+
+// bucketCounters are the running totals of one configured bucket.
+type bucketCounters struct {
+	hits, misses, bypasses atomic.Int64
+	entriesWritten         atomic.Int64
+	bytesFromCache         atomic.Int64
+	bytesFromOrigin        atomic.Int64
+}
+
+// countersFor returns the counters of a configured bucket.
+func countersFor(bucket string) *bucketCounters {
+	if c, ok := handlerStats.buckets.Load(bucket); ok {
+		return c.(*bucketCounters)
+	}
+	c, _ := handlerStats.buckets.LoadOrStore(bucket, new(bucketCounters))
+	return c.(*bucketCounters)
+}
+
+// latencyRing keeps the durations of the most recent cache operations.
+type latencyRing struct {
+	mu      sync.Mutex
+	samples [latencySamples]time.Duration
+	next    int
+	full    bool
+	count   int64
+}
+
+func (l *latencyRing) observe(d time.Duration) {
+	l.mu.Lock()
+	l.samples[l.next] = d
+	l.next++
+	if l.next == len(l.samples) {
+		l.next, l.full = 0, true
+	}
+	l.count++
+	l.mu.Unlock()
+}
+
+// latencyStats summarizes the recent durations of a cache operation.
+type latencyStats struct {
+	// Count is the number of operations since the process started; the
+	// percentiles only cover the most recent ones.
+	Count int64   `json:"count"`
+	P50Ms float64 `json:"p50_ms"`
+	P90Ms float64 `json:"p90_ms"`
+	P99Ms float64 `json:"p99_ms"`
+	MaxMs float64 `json:"max_ms"`
+}
+
+func (l *latencyRing) summary() latencyStats {
+	l.mu.Lock()
+	n := l.next
+	if l.full {
+		n = len(l.samples)
+	}
+	sorted := slices.Clone(l.samples[:n])
+	stats := latencyStats{Count: l.count}
+	l.mu.Unlock()
+
+	if len(sorted) == 0 {
+		return stats
+	}
+	slices.Sort(sorted)
+	at := func(q float64) float64 {
+		return milliseconds(sorted[int(q*float64(len(sorted)-1))])
+	}
+	stats.P50Ms, stats.P90Ms, stats.P99Ms = at(0.5), at(0.9), at(0.99)
+	stats.MaxMs = milliseconds(sorted[len(sorted)-1])
+	return stats
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// trafficStats are the request and byte counters of a bucket, or of all
+// of them.
+type trafficStats struct {
+	Hits     int64 `json:"hits"`
+	Misses   int64 `json:"misses"`
+	Bypasses int64 `json:"bypasses"`
+
+	// HitRatio is hits over hits and misses; bypassed requests never
+	// consult the cache, so they don't count against it.
+	HitRatio float64 `json:"hit_ratio"`
+
+	EntriesWritten  int64 `json:"entries_written"`
+	BytesFromCache  int64 `json:"bytes_from_cache"`
+	BytesFromOrigin int64 `json:"bytes_from_origin"`
+}
+
+func (c *bucketCounters) snapshot() trafficStats {
+	return trafficStats{
+		Hits:            c.hits.Load(),
+		Misses:          c.misses.Load(),
+		Bypasses:        c.bypasses.Load(),
+		EntriesWritten:  c.entriesWritten.Load(),
+		BytesFromCache:  c.bytesFromCache.Load(),
+		BytesFromOrigin: c.bytesFromOrigin.Load(),
+	}
+}
+
+func (t *trafficStats) add(o trafficStats) {
+	t.Hits += o.Hits
+	t.Misses += o.Misses
+	t.Bypasses += o.Bypasses
+	t.EntriesWritten += o.EntriesWritten
+	t.BytesFromCache += o.BytesFromCache
+	t.BytesFromOrigin += o.BytesFromOrigin
+}
+
+func (t *trafficStats) computeRatio() {
+	if lookups := t.Hits + t.Misses; lookups > 0 {
+		t.HitRatio = float64(t.Hits) / float64(lookups)
+	}
+}
+
+// collectTraffic returns the totals over every bucket and each bucket's
+// own counters.
+func collectTraffic() (trafficStats, map[string]trafficStats) {
+	var total trafficStats
+	buckets := make(map[string]trafficStats)
+	handlerStats.buckets.Range(func(key, value any) bool {
+		stats := value.(*bucketCounters).snapshot()
+		stats.computeRatio()
+		buckets[key.(string)] = stats
+		total.add(stats)
+		return true
+	})
+	total.computeRatio()
+	return total, buckets
+}
+
+// observeBytes counts body bytes served from the given source, "cache" or
+// "origin".
+func (h *MinioStaticHTML) observeBytes(source string, n int64) {
+	minioMetrics.bytesServed.WithLabelValues(h.Bucket, source).Add(float64(n))
+	if source == "cache" {
+		countersFor(h.Bucket).bytesFromCache.Add(n)
+	} else {
+		countersFor(h.Bucket).bytesFromOrigin.Add(n)
+	}
+}
+
+// observeEntryWritten counts an object stored in the cache.
+func (h *MinioStaticHTML) observeEntryWritten() {
+	countersFor(h.Bucket).entriesWritten.Add(1)
+}
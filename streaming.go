@@ -0,0 +1,187 @@
+package miniohandler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"go.uber.org/zap"
+)
+
+// Defaults for the streaming profile.
+const (
+	defaultPlaylistTTL = 2 * time.Second
+	defaultSegmentTTL  = 24 * time.Hour
+)
+
+// Content types of HLS and DASH objects, by extension.
+var (
+	playlistTypes = map[string]string{
+		".m3u8": "application/vnd.apple.mpegurl",
+		".mpd":  "application/dash+xml",
+	}
+	segmentTypes = map[string]string{
+		".ts":  "video/mp2t",
+		".m4s": "video/iso.segment",
+	}
+)
+
+// Streaming makes the handler an origin for HLS and DASH video. Playlists
+// (.m3u8 and .mpd), which live streams rewrite every few seconds, are
+// cached briefly. Segments (.ts and .m4s), which never change once written,
+// are streamed straight from MinIO, so a large segment is never held in
+// memory, and clients and CDNs may keep them for long. Both get their
+// standard content types unless mime_types says otherwise. Explicit
+// ttl_rules take precedence over both TTLs.
+type Streaming struct {
+	// How long playlists are cached (default 2s).
+	PlaylistTTL string `json:"playlist_ttl,omitempty"`
+
+	// How long clients may cache segments, sent as max-age (default 24h).
+	SegmentTTL string `json:"segment_ttl,omitempty"`
+
+	playlistTTL time.Duration
+	segmentTTL  time.Duration
+}
+
+// provision parses the TTLs.
+func (s *Streaming) provision() error {
+	s.playlistTTL, s.segmentTTL = defaultPlaylistTTL, defaultSegmentTTL
+	if s.PlaylistTTL != "" {
+		dur, err := time.ParseDuration(s.PlaylistTTL)
+		if err != nil {
+			return fmt.Errorf("invalid playlist_ttl: %w", err)
+		}
+		s.playlistTTL = dur
+	}
+	if s.SegmentTTL != "" {
+		dur, err := time.ParseDuration(s.SegmentTTL)
+		if err != nil {
+			return fmt.Errorf("invalid segment_ttl: %w", err)
+		}
+		s.segmentTTL = dur
+	}
+	return nil
+}
+
+// validate checks the streaming settings.
+func (s *Streaming) validate() error {
+	if s.playlistTTL < 0 || s.segmentTTL < 0 {
+		return fmt.Errorf("playlist_ttl and segment_ttl must not be negative")
+	}
+	return nil
+}
+
+// provisionStreaming adds the content types of playlists and segments to
+// mime_types, leaving any configured there alone.
+func (h *MinioStaticHTML) provisionStreaming() error {
+	if err := h.Streaming.provision(); err != nil {
+		return err
+	}
+	if h.MimeTypes == nil {
+		h.MimeTypes = make(map[string]string)
+	}
+	for _, types := range []map[string]string{playlistTypes, segmentTypes} {
+		for ext, contentType := range types {
+			if _, ok := h.MimeTypes[ext]; !ok {
+				h.MimeTypes[ext] = contentType
+			}
+		}
+	}
+	return nil
+}
+
+// ttlFor returns the TTL of playlists or segments of mediaType, reporting
+// false for other types.
+func (s *Streaming) ttlFor(mediaType string) (time.Duration, bool) {
+	for _, contentType := range playlistTypes {
+		if mediaType == contentType {
+			return s.playlistTTL, true
+		}
+	}
+	for _, contentType := range segmentTypes {
+		if mediaType == contentType {
+			return s.segmentTTL, true
+		}
+	}
+	return 0, false
+}
+
+// segmentRequested reports whether r is for a segment to stream.
+func (h *MinioStaticHTML) segmentRequested(r *http.Request, objectKey string) bool {
+	if h.Streaming == nil || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+		return false
+	}
+	_, ok := segmentTypes[strings.ToLower(path.Ext(objectKey))]
+	return ok
+}
+
+// serveSegment streams a segment from MinIO without caching it, answering
+// range and conditional requests by seeking in the object. It is fetched
+// through the same origins, circuit breakers and retries as other objects,
+// with request_timeout bounding the whole transfer. If the segment doesn't
+// exist, nothing is written and the NoSuchKey error is returned.
+func (h *MinioStaticHTML) serveSegment(w http.ResponseWriter, r *http.Request, bucket, objectKey string) error {
+	ctx := r.Context()
+	if h.requestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.requestTimeout)
+		defer cancel()
+	}
+	obj, objInfo, err := h.openWithFailover(ctx, bucket, objectKey, minio.GetObjectOptions{ServerSideEncryption: h.sse})
+	if err != nil {
+		switch {
+		case minio.ToErrorResponse(err).Code == "NoSuchKey":
+			return err
+		case errors.Is(err, errBreakerOpen):
+			h.logger.Debug("minio circuit breaker open; not fetching",
+				zap.String("bucket", bucket),
+				zap.String("object_key", objectKey))
+			h.serveBreakerOpen(w, r)
+		case ctx.Err() == context.DeadlineExceeded && r.Context().Err() == nil:
+			h.logger.Warn("minio request timed out",
+				zap.String("bucket", bucket),
+				zap.String("object_key", objectKey),
+				zap.Duration("timeout", h.requestTimeout))
+			if !h.serveErrorPage(w, r, http.StatusGatewayTimeout) {
+				http.Error(w, "Gateway Timeout", http.StatusGatewayTimeout)
+			}
+		default:
+			h.handleMinioError(w, r, err)
+		}
+		return nil
+	}
+	defer obj.Close()
+
+	contentType := h.contentTypeByExtension(objectKey)
+	h.setMetadataHeaders(w, objInfo.UserMetadata)
+	if cc := h.cacheControl(r, contentType); cc != "" {
+		w.Header().Set("Cache-Control", cc)
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("ETag", objInfo.ETag)
+	writeCacheStatus(w, r, cacheStatusBypass)
+	cw := newCountingWriter(w)
+	http.ServeContent(cw, r, "", objInfo.LastModified, obj)
+	h.observeBytes("origin", cw.n)
+	return nil
+}
+
+// streamingTTL returns the streaming profile's TTL for contentType,
+// reporting false if there is none.
+func (h *MinioStaticHTML) streamingTTL(contentType string) (time.Duration, bool) {
+	if h.Streaming == nil {
+		return 0, false
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(contentType)
+	}
+	return h.Streaming.ttlFor(mediaType)
+}
@@ -0,0 +1,149 @@
+package miniohandler
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/minio/minio-go/v7"
+	"go.uber.org/zap"
+)
+
+// substituteToken matches the names substitutions may have.
+var substituteToken = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Substitute replaces tokens such as %%API_URL%% in served objects with
+// values that may come from placeholders, such as {env.API_URL}, so the
+// same build can be promoted from staging to production unchanged. The
+// output is cached once per set of values.
+type Substitute struct {
+	// Token names, without the surrounding %%, and their values.
+	// (Required)
+	Tokens map[string]string `json:"tokens,omitempty"`
+
+	// The extensions of the objects substituted (default [".html",
+	// ".htm", ".js", ".mjs"]).
+	Extensions []string `json:"extensions,omitempty"`
+}
+
+// validate checks the substitution settings.
+func (s *Substitute) validate() error {
+	if len(s.Tokens) == 0 {
+		return fmt.Errorf("tokens are required")
+	}
+	for name := range s.Tokens {
+		if !substituteToken.MatchString(name) {
+			return fmt.Errorf("tokens: invalid name %q", name)
+		}
+	}
+	for i, ext := range s.Extensions {
+		if !strings.HasPrefix(ext, ".") {
+			return fmt.Errorf("extensions[%d]: %q must start with a dot", i, ext)
+		}
+	}
+	return nil
+}
+
+// substitutes reports whether objectKey has its tokens substituted.
+func (s *Substitute) substitutes(objectKey string) bool {
+	ext := strings.ToLower(path.Ext(objectKey))
+	if len(s.Extensions) == 0 {
+		return ext == ".html" || ext == ".htm" || ext == ".js" || ext == ".mjs"
+	}
+	return slices.ContainsFunc(s.Extensions, func(e string) bool { return strings.EqualFold(e, ext) })
+}
+
+// substituteRequested reports whether r is for an object with tokens
+// substituted.
+func (h *MinioStaticHTML) substituteRequested(r *http.Request, objectKey string) bool {
+	return h.Substitute != nil && h.Substitute.substitutes(objectKey) &&
+		(r.Method == http.MethodGet || r.Method == http.MethodHead)
+}
+
+// serveSubstituted serves the object with its tokens replaced by their
+// values for r.
+func (h *MinioStaticHTML) serveSubstituted(w http.ResponseWriter, r *http.Request, repl *caddy.Replacer, bucket, objectKey string) error {
+	names := slices.Sorted(maps.Keys(h.Substitute.Tokens))
+	pairs := make([]string, 0, 2*len(names))
+	sum := sha256.New()
+	for _, name := range names {
+		value := repl.ReplaceAll(h.Substitute.Tokens[name], "")
+		pairs = append(pairs, "%%"+name+"%%", value)
+		io.WriteString(sum, name+"="+value)
+		sum.Write([]byte{0})
+	}
+	// Under :vary: so purging the object purges its substitutions.
+	setKey := hex.EncodeToString(sum.Sum(nil))
+	outKey := h.GlobalConfig.cacheKeyFor(r.Context(), bucket, objectKey) + ":vary:sub:" + setKey
+
+	if h.cacheEnabled() {
+		raw, err := getOne(r.Context(), h.cache, outKey)
+		if err == nil {
+			var obj CachedObject
+			if json.Unmarshal(raw, &obj) == nil && !obj.expired(time.Now()) {
+				h.observeCache(cacheHit)
+				h.writeGenerated(w, r, &obj)
+				return nil
+			}
+		}
+	}
+
+	contentType, source, err := h.objectContent(r.Context(), bucket, objectKey)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "" {
+			return caddyhttp.Error(http.StatusBadGateway, err)
+		}
+		h.handleMinioError(w, r, err)
+		return nil
+	}
+	out := []byte(strings.NewReplacer(pairs...).Replace(string(source)))
+	etag := sha256.Sum256(out)
+	now := time.Now()
+	obj := CachedObject{
+		ContentType:  contentType,
+		ETag:         `"` + hex.EncodeToString(etag[:16]) + `"`,
+		LastModified: now,
+		Size:         int64(len(out)),
+		Content:      out,
+		CachedAt:     now,
+		ExpiresAt:    now.Add(h.cacheTTL),
+	}
+	if h.cacheEnabled() {
+		data, err := json.Marshal(obj)
+		if err == nil {
+			h.writeCache(r.Context(), func(ctx context.Context) {
+				if err := h.cache.Set(ctx, h.jitterTTL(h.cacheTTL), CacheItem{outKey, data}); err != nil {
+					h.logger.Error("failed to SET substituted object in cache", zap.String("key", outKey), zap.Error(err))
+					h.observeRedisError("set")
+				}
+			})
+		}
+	}
+	h.writeGenerated(w, r, &obj)
+	return nil
+}
+
+// writeGenerated serves content generated from an object, which is
+// validated by its own ETag and, unlike rendered pages, cacheable by
+// clients under the usual cache-control rules.
+func (h *MinioStaticHTML) writeGenerated(w http.ResponseWriter, r *http.Request, obj *CachedObject) {
+	if cc := h.cacheControl(r, obj.ContentType); cc != "" {
+		w.Header().Set("Cache-Control", cc)
+	}
+	w.Header().Set("Content-Type", obj.ContentType)
+	w.Header().Set("ETag", obj.ETag)
+	http.ServeContent(w, r, "", obj.LastModified, bytes.NewReader(obj.Content))
+}
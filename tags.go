@@ -0,0 +1,155 @@
+package miniohandler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"go.uber.org/zap"
+)
+
+// surrogateKeyMetadata is the user metadata field, X-Amz-Meta-Surrogate-Key
+// on upload, whose space-separated values tag an object's cache entries.
+const surrogateKeyMetadata = "Surrogate-Key"
+
+// surrogateKeysVar is the request variable holding the surrogate keys that
+// surrogate_keys rules gave a request, for when its response is cached.
+const surrogateKeysVar = "minio_surrogate_keys"
+
+// SurrogateKeyRule tags the cache entries of matching request paths with
+// surrogate keys, so they can be purged together by tag.
+type SurrogateKeyRule struct {
+	// Request paths to match, with the same syntax as Caddy's path
+	// matcher, e.g. "/blog/*".
+	Path []string `json:"path"`
+
+	// The surrogate keys to add. Placeholders are allowed, and a value
+	// that expands to several space-separated keys adds each of them.
+	Keys []string `json:"keys"`
+
+	path caddyhttp.MatchPath
+}
+
+// provisionSurrogateKeys prepares the path matchers of each rule.
+func (h *MinioStaticHTML) provisionSurrogateKeys(ctx caddy.Context) error {
+	for i := range h.SurrogateKeys {
+		rule := &h.SurrogateKeys[i]
+		rule.path = append(caddyhttp.MatchPath(nil), rule.Path...)
+		if err := rule.path.Provision(ctx); err != nil {
+			return fmt.Errorf("surrogate_keys[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// validateSurrogateKeys checks each rule has paths and keys.
+func (h *MinioStaticHTML) validateSurrogateKeys() error {
+	for i, rule := range h.SurrogateKeys {
+		if len(rule.Path) == 0 {
+			return fmt.Errorf("surrogate_keys[%d]: path is required", i)
+		}
+		if len(rule.Keys) == 0 {
+			return fmt.Errorf("surrogate_keys[%d]: keys is required", i)
+		}
+	}
+	return nil
+}
+
+// setSurrogateKeys records the surrogate keys every matching rule gives r.
+func (h *MinioStaticHTML) setSurrogateKeys(r *http.Request) {
+	if len(h.SurrogateKeys) == 0 {
+		return
+	}
+	repl := r.Context().Value(caddy.ReplacerCtxKey).(*caddy.Replacer)
+	var tags []string
+	for _, rule := range h.SurrogateKeys {
+		if !rule.path.Match(r) {
+			continue
+		}
+		for _, key := range rule.Keys {
+			tags = append(tags, strings.Fields(repl.ReplaceAll(key, ""))...)
+		}
+	}
+	if len(tags) > 0 {
+		caddyhttp.SetVar(r.Context(), surrogateKeysVar, tags)
+	}
+}
+
+// surrogateKeys returns the surrogate keys of an entry being cached: those
+// recorded for the request in ctx and those in the object's metadata.
+func surrogateKeys(ctx context.Context, userMetadata map[string]string) []string {
+	tags, _ := caddyhttp.GetVar(ctx, surrogateKeysVar).([]string)
+	for name, value := range userMetadata {
+		if strings.EqualFold(name, surrogateKeyMetadata) {
+			tags = append(slices.Clone(tags), strings.Fields(value)...)
+		}
+	}
+	slices.Sort(tags)
+	return slices.Compact(tags)
+}
+
+// tagKey returns the key of the set indexing the entries tagged with tag.
+// The underscore keeps it apart from cache keys, as bucket names can't
+// contain one.
+func (m *MinioConfig) tagKey(tag string) string {
+	prefix := m.keyPrefix
+	if prefix == "" {
+		prefix = defaultCacheKeyPrefix
+	}
+	return prefix + ":_tag:" + tag
+}
+
+// tagEntry indexes the entry at cacheKey under each of its surrogate keys,
+// for at least as long as the entry is kept.
+func (h *MinioStaticHTML) tagEntry(ctx context.Context, cacheKey string, tags []string, expiry time.Duration) {
+	if len(tags) == 0 {
+		return
+	}
+	sets, ok := h.cache.(CacheSets)
+	if !ok {
+		h.logger.Debug("cache backend does not support surrogate keys", zap.String("key", cacheKey))
+		return
+	}
+	for _, tag := range tags {
+		if err := sets.SetAdd(ctx, expiry, h.GlobalConfig.tagKey(tag), cacheKey); err != nil {
+			h.logger.Error("failed to tag cache entry",
+				zap.String("key", cacheKey),
+				zap.String("tag", tag),
+				zap.Error(err))
+			h.observeRedisError("sadd")
+		}
+	}
+}
+
+// purgeTag deletes every cache entry tagged with tag, along with their
+// chunks and variants, and the tag's index. It returns the number of keys
+// removed.
+func (m *MinioConfig) purgeTag(ctx context.Context, tag string) (int64, error) {
+	sets, ok := m.cache.(CacheSets)
+	if !ok {
+		return 0, fmt.Errorf("cache backend %s cannot purge by tag: %w", m.cacheName(), errors.ErrUnsupported)
+	}
+	tagKey := m.tagKey(tag)
+	members, err := sets.SetMembers(ctx, tagKey)
+	if err != nil {
+		return 0, err
+	}
+	var deleted int64
+	for _, cacheKey := range members {
+		n, err := m.purgeCacheKey(ctx, cacheKey)
+		deleted += n
+		if err != nil {
+			return deleted, err
+		}
+	}
+	if _, err := m.cache.Delete(ctx, tagKey); err != nil {
+		return deleted, err
+	}
+	return deleted, nil
+}
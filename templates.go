@@ -0,0 +1,266 @@
+package miniohandler
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/Masterminds/sprig/v3"
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/minio/minio-go/v7"
+	"go.uber.org/zap"
+)
+
+// Templates renders objects as Go templates before they are served, for
+// light personalization of otherwise static pages. As with Caddy's
+// templates handler, the sprig functions and placeholder (or ph) are
+// available, and the context offers .Req, .Cookie, .Host, .RemoteIP,
+// .ClientIP and .RespHeader. File functions such as include are not, as
+// there is no file root.
+//
+// The object itself is cached as usual. The rendered output is cached
+// only when VaryBy names the inputs it depends on; otherwise it is
+// rendered on every request.
+type Templates struct {
+	// The extensions of the objects rendered (default [".html"]).
+	Extensions []string `json:"extensions,omitempty"`
+
+	// Placeholders, such as "{http.request.cookie.plan}", whose values
+	// the rendered output depends on. Output is cached once per
+	// combination of their values.
+	VaryBy []string `json:"vary_by,omitempty"`
+}
+
+// validate checks the template settings.
+func (t *Templates) validate() error {
+	for i, ext := range t.Extensions {
+		if !strings.HasPrefix(ext, ".") {
+			return fmt.Errorf("extensions[%d]: %q must start with a dot", i, ext)
+		}
+	}
+	return nil
+}
+
+// renders reports whether objectKey is rendered as a template.
+func (t *Templates) renders(objectKey string) bool {
+	ext := strings.ToLower(path.Ext(objectKey))
+	if len(t.Extensions) == 0 {
+		return ext == ".html"
+	}
+	return slices.ContainsFunc(t.Extensions, func(e string) bool { return strings.EqualFold(e, ext) })
+}
+
+// templateRequested reports whether r is for an object rendered as a
+// template.
+func (h *MinioStaticHTML) templateRequested(r *http.Request, objectKey string) bool {
+	return h.Templates != nil && h.Templates.renders(objectKey) &&
+		(r.Method == http.MethodGet || r.Method == http.MethodHead)
+}
+
+// serveTemplate renders the object as a template and serves the output.
+func (h *MinioStaticHTML) serveTemplate(w http.ResponseWriter, r *http.Request, repl *caddy.Replacer, bucket, objectKey string) error {
+	cacheKey := h.GlobalConfig.cacheKeyFor(r.Context(), bucket, objectKey)
+	renderKey := ""
+	if len(h.Templates.VaryBy) > 0 && h.cacheEnabled() {
+		sum := sha256.New()
+		for _, ph := range h.Templates.VaryBy {
+			io.WriteString(sum, repl.ReplaceAll(ph, ""))
+			sum.Write([]byte{0})
+		}
+		// Under :vary: so purging the object purges its renderings.
+		renderKey = cacheKey + ":vary:tpl:" + hex.EncodeToString(sum.Sum(nil))
+		raw, err := getOne(r.Context(), h.cache, renderKey)
+		if err == nil {
+			var obj CachedObject
+			if json.Unmarshal(raw, &obj) == nil && !obj.expired(time.Now()) {
+				h.observeCache(cacheHit)
+				for field, values := range obj.Header {
+					w.Header()[field] = values
+				}
+				writeRendered(w, r, obj.ContentType, obj.Content)
+				return nil
+			}
+		}
+	}
+
+	contentType, source, err := h.objectContent(r.Context(), bucket, objectKey)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "" {
+			return caddyhttp.Error(http.StatusBadGateway, err)
+		}
+		h.handleMinioError(w, r, err)
+		return nil
+	}
+	before := w.Header().Clone()
+	rendered, err := renderTemplate(w, r, repl, objectKey, source)
+	if err != nil {
+		return caddyhttp.Error(http.StatusInternalServerError, fmt.Errorf("rendering %s: %w", objectKey, err))
+	}
+
+	if ttl := h.routeTTL(r, contentType); renderKey != "" && ttl > 0 {
+		now := time.Now()
+		data, err := json.Marshal(CachedObject{
+			ContentType: contentType,
+			Size:        int64(len(rendered)),
+			Content:     rendered,
+			CachedAt:    now,
+			ExpiresAt:   now.Add(ttl),
+			Header:      changedHeader(before, w.Header()),
+		})
+		if err == nil {
+			h.writeCache(r.Context(), func(ctx context.Context) {
+				if err := h.cache.Set(ctx, h.jitterTTL(ttl), CacheItem{renderKey, data}); err != nil {
+					h.logger.Error("failed to SET rendered template in cache", zap.String("key", renderKey), zap.Error(err))
+					h.observeRedisError("set")
+				}
+			})
+		}
+	}
+	writeRendered(w, r, contentType, rendered)
+	return nil
+}
+
+// templateContext is the data templates are executed with, a subset of
+// the context of Caddy's templates handler.
+type templateContext struct {
+	Req        *http.Request
+	RespHeader templateHeader
+
+	repl *caddy.Replacer
+}
+
+// Cookie returns the value of the named request cookie, or "".
+func (c templateContext) Cookie(name string) string {
+	if cookie, err := c.Req.Cookie(name); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// Host returns the request's host without its port.
+func (c templateContext) Host() string {
+	if host, _, err := net.SplitHostPort(c.Req.Host); err == nil {
+		return host
+	}
+	return c.Req.Host
+}
+
+// RemoteIP returns the address of the connection's peer.
+func (c templateContext) RemoteIP() string {
+	return c.repl.ReplaceAll("{http.request.remote.host}", "")
+}
+
+// ClientIP returns the client's address, as trusted_proxies determines.
+func (c templateContext) ClientIP() string {
+	return c.repl.ReplaceAll("{http.vars.client_ip}", "")
+}
+
+// templateHeader lets templates set response headers. Its methods return
+// "" so they can be called from actions without output.
+type templateHeader struct{ http.Header }
+
+func (h templateHeader) Add(field, val string) string { h.Header.Add(field, val); return "" }
+func (h templateHeader) Set(field, val string) string { h.Header.Set(field, val); return "" }
+func (h templateHeader) Del(field string) string      { h.Header.Del(field); return "" }
+
+// templateFuncs are the sprig functions offered to templates, without
+// those reading the environment.
+var templateFuncs = func() template.FuncMap {
+	funcs := sprig.TxtFuncMap()
+	delete(funcs, "env")
+	delete(funcs, "expandenv")
+	return funcs
+}()
+
+// renderTemplate executes source as a template for r. Response headers
+// the template sets are set on w.
+func renderTemplate(w http.ResponseWriter, r *http.Request, repl *caddy.Replacer, name string, source []byte) ([]byte, error) {
+	tplCtx := templateContext{Req: r, RespHeader: templateHeader{w.Header()}, repl: repl}
+	// Templates are bucket content, so as with Caddy's templates handler
+	// they must not read local files, nor the process environment through
+	// sprig.
+	fileless := repl.WithoutFile()
+	placeholder := func(name string) string {
+		value, _ := fileless.GetString(name)
+		return value
+	}
+	tpl, err := template.New(name).
+		Option("missingkey=zero").
+		Funcs(templateFuncs).
+		Funcs(template.FuncMap{"placeholder": placeholder, "ph": placeholder}).
+		Parse(string(source))
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, tplCtx); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// changedHeader returns the fields of after that were added or changed
+// since before.
+func changedHeader(before, after http.Header) http.Header {
+	var changed http.Header
+	for field, values := range after {
+		if !slices.Equal(before[field], values) {
+			if changed == nil {
+				changed = make(http.Header)
+			}
+			changed[field] = slices.Clone(values)
+		}
+	}
+	return changed
+}
+
+// writeRendered writes rendered output, which clients must revalidate as
+// it may differ from one request to the next.
+func writeRendered(w http.ResponseWriter, r *http.Request, contentType string, body []byte) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(body)))
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		w.Write(body)
+	}
+}
+
+// objectContent returns an object's type and whole content, from the
+// cache if it is there, otherwise from MinIO, caching it.
+func (h *MinioStaticHTML) objectContent(ctx context.Context, bucket, objectKey string) (string, []byte, error) {
+	cacheKey := h.GlobalConfig.cacheKeyFor(ctx, bucket, objectKey)
+	if h.cacheEnabled() {
+		entries := h.lookupCacheKeys(ctx, bucket, objectKey, true, cacheKey)
+		if entry := entries[0]; entry != nil && !entry.obj.Missing && entry.obj.ContentEncoding == "" &&
+			!entry.obj.expired(time.Now()) {
+			content, err := io.ReadAll(entry.content)
+			if err == nil {
+				h.observeCache(cacheHit)
+				return entry.obj.ContentType, content, nil
+			}
+		}
+		h.observeCache(cacheMiss)
+	}
+	objInfo, content, err := h.fetchWithFailover(ctx, bucket, objectKey, minio.GetObjectOptions{ServerSideEncryption: h.sse})
+	if err != nil {
+		return "", nil, err
+	}
+	content = h.prepareObject(objectKey, &objInfo, content)
+	if h.cacheEnabled() {
+		h.storeInCache(ctx, cacheKey, bucket, objectKey, &objInfo, content, h.cacheTTL)
+	}
+	return objInfo.ContentType, content, nil
+}
@@ -0,0 +1,362 @@
+package miniohandler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+)
+
+func init() {
+	caddy.RegisterModule(TieredBackend{})
+}
+
+// TieredBackend stacks several cache backends, such as Redis above a local
+// disk cache. Writes go to every tier; reads try the tiers in order until
+// each key is found, so an entry evicted from a small, fast tier can still
+// be served from a larger one below it.
+//
+// With AsyncWrites, writes reach the tiers below the first from a
+// background queue instead, so a secondary Redis can mirror the primary
+// without slowing requests down, and take over its reads while it
+// restarts empty.
+type TieredBackend struct {
+	// The backends, fastest first, each configured like the global cache
+	// option.
+	TiersRaw []json.RawMessage `json:"tiers,omitempty" caddy:"namespace=minio_static_html.cache inline_key=backend"`
+
+	// AsyncWrites mirrors writes to the lower tiers in the background,
+	// through a queue of AsyncQueue writes (default 1000). Writes that
+	// don't fit are dropped from the lower tiers. Deletions are always
+	// made synchronously.
+	AsyncWrites bool `json:"async_writes,omitempty"`
+	AsyncQueue  int  `json:"async_queue,omitempty"`
+
+	logger *zap.Logger
+	tiers  []CacheBackend
+	queue  chan func(context.Context)
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// CaddyModule returns the Caddy module information for the backend.
+func (TieredBackend) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "minio_static_html.cache.tiered",
+		New: func() caddy.Module { return new(TieredBackend) },
+	}
+}
+
+// Provision loads the tiers.
+func (t *TieredBackend) Provision(ctx caddy.Context) error {
+	if len(t.TiersRaw) == 0 {
+		return fmt.Errorf("tiers must not be empty")
+	}
+	mods, err := ctx.LoadModule(t, "TiersRaw")
+	if err != nil {
+		return fmt.Errorf("loading cache tiers: %w", err)
+	}
+	for _, mod := range mods.([]any) {
+		t.tiers = append(t.tiers, mod.(CacheBackend))
+	}
+	t.logger = ctx.Logger()
+	if t.AsyncWrites && len(t.tiers) > 1 {
+		size := t.AsyncQueue
+		if size <= 0 {
+			size = defaultCacheWriteQueue
+		}
+		var workerCtx context.Context
+		workerCtx, t.cancel = context.WithCancel(context.Background())
+		t.queue = make(chan func(context.Context), size)
+		t.done = make(chan struct{})
+		go t.mirror(workerCtx)
+	}
+	return nil
+}
+
+// Validate checks the queue size.
+func (t *TieredBackend) Validate() error {
+	if t.AsyncQueue < 0 {
+		return fmt.Errorf("async_queue must not be negative")
+	}
+	return nil
+}
+
+// Cleanup finishes the queued writes to the lower tiers.
+func (t *TieredBackend) Cleanup() error {
+	if t.cancel != nil {
+		t.cancel()
+		<-t.done
+	}
+	return nil
+}
+
+// mirror makes the queued writes until ctx is cancelled, then drains the
+// queue.
+func (t *TieredBackend) mirror(ctx context.Context) {
+	defer close(t.done)
+	write := func(w func(context.Context)) {
+		wctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		w(wctx)
+	}
+	for {
+		select {
+		case w := <-t.queue:
+			write(w)
+		case <-ctx.Done():
+			for {
+				select {
+				case w := <-t.queue:
+					write(w)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// lower runs write against every tier below the first, in the background
+// with AsyncWrites, returning the errors of synchronous writes.
+func (t *TieredBackend) lower(ctx context.Context, write func(context.Context, CacheBackend) error) []error {
+	if t.queue == nil {
+		var errs []error
+		for _, tier := range t.tiers[1:] {
+			errs = append(errs, write(ctx, tier))
+		}
+		return errs
+	}
+	mirror := func(ctx context.Context) {
+		for _, tier := range t.tiers[1:] {
+			if err := write(ctx, tier); err != nil {
+				t.logger.Warn("mirroring cache write failed", zap.String("tier", backendName(tier)), zap.Error(err))
+			}
+		}
+	}
+	select {
+	case t.queue <- mirror:
+	default:
+		minioMetrics.cacheWritesDropped.Inc()
+		t.logger.Debug("cache mirror queue full; dropping write")
+	}
+	return nil
+}
+
+// String describes the backend for log messages.
+func (t *TieredBackend) String() string {
+	names := make([]string, len(t.tiers))
+	for i, tier := range t.tiers {
+		names[i] = backendName(tier)
+	}
+	return "tiered [" + strings.Join(names, ", ") + "]"
+}
+
+// Get reads keys from the first tier, then looks for the ones it is missing
+// in each tier below. A tier that fails is skipped.
+func (t *TieredBackend) Get(ctx context.Context, keys ...string) ([][]byte, error) {
+	values := make([][]byte, len(keys))
+	missing := make([]int, len(keys))
+	for i := range keys {
+		missing[i] = i
+	}
+	var errs []error
+	for _, tier := range t.tiers {
+		lookup := make([]string, len(missing))
+		for j, i := range missing {
+			lookup[j] = keys[i]
+		}
+		found, err := tier.Get(ctx, lookup...)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		remaining := missing[:0]
+		for j, i := range missing {
+			if found[j] != nil {
+				values[i] = found[j]
+			} else {
+				remaining = append(remaining, i)
+			}
+		}
+		if missing = remaining; len(missing) == 0 {
+			return values, nil
+		}
+	}
+	if len(errs) == len(t.tiers) {
+		return nil, errors.Join(errs...)
+	}
+	return values, nil
+}
+
+// Set writes items to every tier.
+func (t *TieredBackend) Set(ctx context.Context, ttl time.Duration, items ...CacheItem) error {
+	err := t.tiers[0].Set(ctx, ttl, items...)
+	errs := t.lower(ctx, func(ctx context.Context, tier CacheBackend) error {
+		return tier.Set(ctx, ttl, items...)
+	})
+	return errors.Join(append(errs, err)...)
+}
+
+// Expire renews keys in every tier.
+func (t *TieredBackend) Expire(ctx context.Context, ttl time.Duration, keys ...string) error {
+	err := t.tiers[0].Expire(ctx, ttl, keys...)
+	errs := t.lower(ctx, func(ctx context.Context, tier CacheBackend) error {
+		return tier.Expire(ctx, ttl, keys...)
+	})
+	return errors.Join(append(errs, err)...)
+}
+
+// Exists counts the keys present in any tier.
+func (t *TieredBackend) Exists(ctx context.Context, keys ...string) (int64, error) {
+	n, err := t.tiers[0].Exists(ctx, keys...)
+	if err == nil && n == int64(len(keys)) {
+		return n, nil
+	}
+	// Work out which keys the lower tiers need to provide.
+	n = 0
+	for _, key := range keys {
+		for _, tier := range t.tiers {
+			if found, err := tier.Exists(ctx, key); err == nil && found > 0 {
+				n++
+				break
+			}
+		}
+	}
+	return n, nil
+}
+
+// Delete removes keys from every tier, returning the most removed from any
+// one tier.
+func (t *TieredBackend) Delete(ctx context.Context, keys ...string) (int64, error) {
+	return t.each(func(tier CacheBackend) (int64, error) { return tier.Delete(ctx, keys...) })
+}
+
+// DeletePrefix removes the keys starting with prefix from every tier,
+// returning the most removed from any one tier.
+func (t *TieredBackend) DeletePrefix(ctx context.Context, prefix string) (int64, error) {
+	// Tiers that can't find keys by prefix, such as memcached, are left
+	// to expire theirs; the deletion only fails as unsupported if no tier
+	// supports it.
+	var deleted int64
+	var errs []error
+	supported := false
+	for _, tier := range t.tiers {
+		n, err := tier.DeletePrefix(ctx, prefix)
+		if errors.Is(err, errors.ErrUnsupported) {
+			continue
+		}
+		supported = true
+		deleted = max(deleted, n)
+		errs = append(errs, err)
+	}
+	if !supported {
+		return 0, fmt.Errorf("no cache tier supports prefix deletion: %w", errors.ErrUnsupported)
+	}
+	return deleted, errors.Join(errs...)
+}
+
+// each runs a deletion on every tier.
+func (t *TieredBackend) each(del func(CacheBackend) (int64, error)) (int64, error) {
+	var deleted int64
+	var errs []error
+	for _, tier := range t.tiers {
+		n, err := del(tier)
+		deleted = max(deleted, n)
+		errs = append(errs, err)
+	}
+	return deleted, errors.Join(errs...)
+}
+
+// SetAdd adds members to the set in every tier that supports sets.
+func (t *TieredBackend) SetAdd(ctx context.Context, ttl time.Duration, key string, members ...string) error {
+	var errs []error
+	supported := false
+	for _, tier := range t.tiers {
+		if sets, ok := tier.(CacheSets); ok {
+			supported = true
+			errs = append(errs, sets.SetAdd(ctx, ttl, key, members...))
+		}
+	}
+	if !supported {
+		return fmt.Errorf("no cache tier supports sets: %w", errors.ErrUnsupported)
+	}
+	return errors.Join(errs...)
+}
+
+// SetMembers returns the members of the set across every tier that
+// supports sets.
+func (t *TieredBackend) SetMembers(ctx context.Context, key string) ([]string, error) {
+	var members []string
+	var errs []error
+	supported := false
+	for _, tier := range t.tiers {
+		sets, ok := tier.(CacheSets)
+		if !ok {
+			continue
+		}
+		supported = true
+		found, err := sets.SetMembers(ctx, key)
+		errs = append(errs, err)
+		for _, member := range found {
+			if !slices.Contains(members, member) {
+				members = append(members, member)
+			}
+		}
+	}
+	if !supported {
+		return nil, fmt.Errorf("no cache tier supports sets: %w", errors.ErrUnsupported)
+	}
+	return members, errors.Join(errs...)
+}
+
+// SetContains reports whether member is in the set in any tier that
+// supports sets.
+func (t *TieredBackend) SetContains(ctx context.Context, key, member string) (bool, error) {
+	var errs []error
+	supported := false
+	for _, tier := range t.tiers {
+		sets, ok := tier.(CacheSets)
+		if !ok {
+			continue
+		}
+		supported = true
+		found, err := sets.SetContains(ctx, key, member)
+		if found {
+			return true, nil
+		}
+		errs = append(errs, err)
+	}
+	if !supported {
+		return false, fmt.Errorf("no cache tier supports sets: %w", errors.ErrUnsupported)
+	}
+	return false, errors.Join(errs...)
+}
+
+// Ping checks that some tier is reachable, so the cache stays in use while
+// one of them is down.
+func (t *TieredBackend) Ping(ctx context.Context) error {
+	var errs []error
+	for _, tier := range t.tiers {
+		err := tier.Ping(ctx)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+var (
+	_ caddy.Provisioner  = (*TieredBackend)(nil)
+	_ caddy.Validator    = (*TieredBackend)(nil)
+	_ caddy.CleanerUpper = (*TieredBackend)(nil)
+	_ CacheBackend       = (*TieredBackend)(nil)
+	_ CacheSets          = (*TieredBackend)(nil)
+)
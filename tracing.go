@@ -0,0 +1,30 @@
+package miniohandler
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName identifies the spans created by this module.
+const tracerName = "github.com/ehzptr/caddy-serve-s3"
+
+// startSpan starts a child of the span in ctx for an operation on an object.
+// The tracer is taken from the parent span's provider, so spans are exported
+// wherever Caddy's tracing handler sends them and cost nothing when tracing
+// is not enabled.
+func (h *MinioStaticHTML) startSpan(ctx context.Context, name, bucket, objectKey string) (context.Context, trace.Span) {
+	tracer := trace.SpanFromContext(ctx).TracerProvider().Tracer(tracerName)
+	return tracer.Start(ctx, name, trace.WithAttributes(
+		attribute.String("minio.bucket", bucket),
+		attribute.String("minio.key", objectKey),
+	))
+}
+
+// spanError marks span as failed with err.
+func spanError(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
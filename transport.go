@@ -0,0 +1,120 @@
+package miniohandler
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// hasTLSConfig reports whether any TLS option is set for the endpoint.
+func (e *MinioEndpoint) hasTLSConfig() bool {
+	return e.TLSCAFile != "" || e.TLSInsecureSkipVerify ||
+		e.TLSClientCert != "" || e.TLSClientKey != ""
+}
+
+// hasTransportTuning reports whether any connection pool or timeout option
+// is set for the endpoint.
+func (e *MinioEndpoint) hasTransportTuning() bool {
+	return e.MaxIdleConns != 0 || e.MaxIdleConnsPerHost != 0 ||
+		e.IdleConnTimeout != "" || e.DialTimeout != "" || e.ResponseHeaderTimeout != ""
+}
+
+// validateTransport checks the connection pool and timeout options.
+func (e *MinioEndpoint) validateTransport() error {
+	if e.MaxIdleConns < 0 || e.MaxIdleConnsPerHost < 0 {
+		return fmt.Errorf("idle connection limits must not be negative")
+	}
+	for _, opt := range []struct{ name, value string }{
+		{"idle_conn_timeout", e.IdleConnTimeout},
+		{"dial_timeout", e.DialTimeout},
+		{"response_header_timeout", e.ResponseHeaderTimeout},
+	} {
+		if opt.value == "" {
+			continue
+		}
+		if dur, err := time.ParseDuration(opt.value); err != nil {
+			return fmt.Errorf("invalid %s: %w", opt.name, err)
+		} else if dur <= 0 {
+			return fmt.Errorf("%s must be positive", opt.name)
+		}
+	}
+	return nil
+}
+
+// transport returns the HTTP transport for the endpoint's MinIO client, or
+// nil to let minio-go use its default.
+func (e *MinioEndpoint) transport() (http.RoundTripper, error) {
+	if !e.hasTLSConfig() && !e.hasTransportTuning() {
+		return nil, nil
+	}
+	tr, err := minio.DefaultTransport(e.Secure)
+	if err != nil {
+		return nil, err
+	}
+
+	// Durations were already validated in Validate.
+	if e.MaxIdleConns > 0 {
+		tr.MaxIdleConns = e.MaxIdleConns
+	}
+	if e.MaxIdleConnsPerHost > 0 {
+		tr.MaxIdleConnsPerHost = e.MaxIdleConnsPerHost
+	}
+	if e.IdleConnTimeout != "" {
+		tr.IdleConnTimeout, _ = time.ParseDuration(e.IdleConnTimeout)
+	}
+	if e.ResponseHeaderTimeout != "" {
+		tr.ResponseHeaderTimeout, _ = time.ParseDuration(e.ResponseHeaderTimeout)
+	}
+	if e.DialTimeout != "" {
+		dialTimeout, _ := time.ParseDuration(e.DialTimeout)
+		tr.DialContext = (&net.Dialer{
+			Timeout:   dialTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext
+	}
+
+	if !e.hasTLSConfig() {
+		return tr, nil
+	}
+	if tr.TLSClientConfig == nil {
+		tr.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	if err := loadTLSConfig(tr.TLSClientConfig, e.TLSCAFile, e.TLSClientCert, e.TLSClientKey); err != nil {
+		return nil, err
+	}
+	tr.TLSClientConfig.InsecureSkipVerify = e.TLSInsecureSkipVerify
+	return tr, nil
+}
+
+// loadTLSConfig adds a CA bundle and a client certificate, where given, to
+// tlsConfig.
+func loadTLSConfig(tlsConfig *tls.Config, caFile, certFile, keyFile string) error {
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return fmt.Errorf("reading CA file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("CA file %s contains no PEM certificates", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return fmt.Errorf("loading TLS client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return nil
+}
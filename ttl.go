@@ -0,0 +1,178 @@
+package miniohandler
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/minio/minio-go/v7"
+)
+
+// TTLRule sets the cache TTL for objects matching a content type and/or a
+// request path. A rule with both must match both.
+type TTLRule struct {
+	// A MIME type glob such as "image/*" or "text/html". Parameters like
+	// charset are ignored.
+	ContentType string `json:"content_type,omitempty"`
+
+	// Request paths to match, with the same syntax as Caddy's path
+	// matcher, e.g. "/api/*" or "*.css".
+	Path []string `json:"path,omitempty"`
+
+	// How long matching objects stay cached. "0" keeps them out of the
+	// cache.
+	TTL string `json:"ttl"`
+
+	ttl  time.Duration
+	path caddyhttp.MatchPath
+}
+
+// provisionTTLRules parses the TTL and path patterns of each rule.
+func (h *MinioStaticHTML) provisionTTLRules(ctx caddy.Context) error {
+	for i := range h.TTLRules {
+		rule := &h.TTLRules[i]
+		dur, err := time.ParseDuration(rule.TTL)
+		if err != nil {
+			return fmt.Errorf("ttl_rules[%d]: invalid ttl: %w", i, err)
+		}
+		rule.ttl = dur
+		if len(rule.Path) > 0 {
+			rule.path = append(caddyhttp.MatchPath(nil), rule.Path...)
+			if err := rule.path.Provision(ctx); err != nil {
+				return fmt.Errorf("ttl_rules[%d]: %w", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// validateTTLRules checks each rule matches something and has a usable TTL.
+func (h *MinioStaticHTML) validateTTLRules() error {
+	for i, rule := range h.TTLRules {
+		if rule.ContentType == "" && len(rule.Path) == 0 {
+			return fmt.Errorf("ttl_rules[%d]: content_type or path is required", i)
+		}
+		if _, err := path.Match(rule.ContentType, ""); err != nil {
+			return fmt.Errorf("ttl_rules[%d]: invalid content_type: %w", i, err)
+		}
+		if dur, err := time.ParseDuration(rule.TTL); err != nil {
+			return fmt.Errorf("ttl_rules[%d]: invalid ttl: %w", i, err)
+		} else if dur < 0 {
+			return fmt.Errorf("ttl_rules[%d]: ttl must not be negative", i)
+		}
+	}
+	return nil
+}
+
+// routeTTL returns the TTL of the first rule matching r and contentType,
+// or the default TTL for contentType if none does.
+func (h *MinioStaticHTML) routeTTL(r *http.Request, contentType string) time.Duration {
+	if len(h.TTLRules) == 0 {
+		return h.defaultTTL(contentType)
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(contentType)
+	}
+	for _, rule := range h.TTLRules {
+		if rule.ContentType != "" {
+			if ok, _ := path.Match(strings.ToLower(rule.ContentType), mediaType); !ok {
+				continue
+			}
+		}
+		if rule.path != nil && !rule.path.Match(r) {
+			continue
+		}
+		return rule.ttl
+	}
+	return h.defaultTTL(contentType)
+}
+
+// defaultTTL returns the TTL for contentType when no ttl_rules entry
+// matches: the streaming profile's, or the route's cache TTL.
+func (h *MinioStaticHTML) defaultTTL(contentType string) time.Duration {
+	if ttl, ok := h.streamingTTL(contentType); ok {
+		return ttl
+	}
+	return h.cacheTTL
+}
+
+// cacheTTLFor returns how long to keep objInfo, fetched for r, in
+// DragonflyDB. With respect_object_cache_control set, the object's own
+// Cache-Control (s-maxage, then max-age) or Expires metadata decides,
+// clamped to min_cache_ttl and max_cache_ttl; otherwise, or if the object
+// has no such metadata, the first matching ttl_rules entry or else the
+// route's cache TTL applies. Zero means don't cache.
+func (h *MinioStaticHTML) cacheTTLFor(r *http.Request, objInfo *minio.ObjectInfo) time.Duration {
+	if !h.RespectObjectCacheControl {
+		return h.routeTTL(r, objInfo.ContentType)
+	}
+	ttl, ok := objectTTL(objInfo, time.Now())
+	if !ok {
+		return h.routeTTL(r, objInfo.ContentType)
+	}
+	if ttl <= 0 {
+		return 0
+	}
+	if h.minCacheTTL > 0 && ttl < h.minCacheTTL {
+		ttl = h.minCacheTTL
+	}
+	if h.maxCacheTTL > 0 && ttl > h.maxCacheTTL {
+		ttl = h.maxCacheTTL
+	}
+	return ttl
+}
+
+// objectTTL derives a TTL from an object's Cache-Control or Expires
+// metadata, reporting false if it has neither. Directives forbidding
+// shared caching yield zero.
+func objectTTL(objInfo *minio.ObjectInfo, now time.Time) (time.Duration, bool) {
+	if cc := objInfo.Metadata.Get("Cache-Control"); cc != "" {
+		var maxAge, sMaxAge string
+		for _, directive := range strings.Split(cc, ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			switch strings.ToLower(name) {
+			case "no-store", "no-cache", "private":
+				return 0, true
+			case "max-age":
+				maxAge = value
+			case "s-maxage":
+				sMaxAge = value
+			}
+		}
+		for _, value := range []string{sMaxAge, maxAge} {
+			if seconds, err := strconv.Atoi(strings.Trim(value, `"`)); err == nil {
+				return time.Duration(seconds) * time.Second, true
+			}
+		}
+	}
+	if !objInfo.Expires.IsZero() {
+		return objInfo.Expires.Sub(now), true
+	}
+	if expires := objInfo.Metadata.Get("Expires"); expires != "" {
+		if t, err := http.ParseTime(expires); err == nil {
+			return t.Sub(now), true
+		}
+	}
+	return 0, false
+}
+
+// jitterTTL spreads ttl randomly within ±ttl_jitter percent, so objects
+// cached together don't all expire together.
+func (h *MinioStaticHTML) jitterTTL(ttl time.Duration) time.Duration {
+	if h.TTLJitter <= 0 || ttl <= 0 {
+		return ttl
+	}
+	spread := int64(ttl) * int64(h.TTLJitter) / 100
+	if spread <= 0 {
+		return ttl
+	}
+	return ttl + time.Duration(rand.Int64N(2*spread+1)-spread)
+}
@@ -0,0 +1,185 @@
+package miniohandler
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/minio/minio-go/v7"
+	"go.uber.org/zap"
+)
+
+// defaultUploadSize caps uploads when max_size is not configured: 100 MiB.
+const defaultUploadSize = 100 << 20
+
+// defaultUploadField is the multipart form field holding the file when
+// form_field is not configured.
+const defaultUploadField = "file"
+
+// Upload lets PUT and multipart POST requests write objects, for simple
+// publish workflows through the same site. It performs no authentication
+// of its own: guard the route with Caddy's authentication handlers or
+// request matchers.
+//
+// A PUT stores its body at the object key the request path maps to. A
+// POST stores the file in the form field, at that key, or for a directory
+// path under the directory with the file's name. The cached copy of the
+// object is purged once it is stored.
+type Upload struct {
+	// The largest object accepted, in bytes (default 100 MiB). Larger
+	// uploads are refused with 413.
+	MaxSize int64 `json:"max_size,omitempty"`
+
+	// The multipart form field holding the file in a POST (default
+	// "file").
+	FormField string `json:"form_field,omitempty"`
+}
+
+// uploadResult is the JSON response to an upload.
+type uploadResult struct {
+	Bucket      string `json:"bucket"`
+	Key         string `json:"key"`
+	ETag        string `json:"etag"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"content_type"`
+}
+
+// validate checks the upload settings.
+func (u *Upload) validate() error {
+	if u.MaxSize < 0 {
+		return fmt.Errorf("max_size must not be negative")
+	}
+	return nil
+}
+
+// serveUpload stores the object a PUT or POST request carries, reporting
+// false, having written nothing, for other methods.
+func (h *MinioStaticHTML) serveUpload(w http.ResponseWriter, r *http.Request, bucket, objectKey string) (bool, error) {
+	if h.Upload == nil || h.HtmlFile != "" ||
+		(r.Method != http.MethodPut && r.Method != http.MethodPost) {
+		return false, nil
+	}
+	maxSize := h.Upload.MaxSize
+	if maxSize == 0 {
+		maxSize = defaultUploadSize
+	}
+	if r.ContentLength > maxSize {
+		return true, caddyhttp.Error(http.StatusRequestEntityTooLarge,
+			fmt.Errorf("upload of %d bytes exceeds max_size of %d", r.ContentLength, maxSize))
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize)
+
+	body := io.Reader(r.Body)
+	size := r.ContentLength
+	declared := r.Header.Get("Content-Type")
+	if r.Method == http.MethodPost {
+		part, err := h.uploadPart(r)
+		if err != nil {
+			return true, err
+		}
+		defer part.Close()
+		if strings.HasSuffix(r.URL.Path, "/") {
+			name := path.Base(part.FileName())
+			if name == "." || name == "/" || strings.Contains(name, "..") {
+				return true, caddyhttp.Error(http.StatusBadRequest, errors.New("upload has no usable file name"))
+			}
+			objectKey = strings.TrimSuffix(objectKey, "index.html") + name
+			if h.hidden(objectKey) || !h.allowed(objectKey) {
+				return true, caddyhttp.Error(http.StatusForbidden, errors.New("object is not allowed"))
+			}
+		}
+		body, size, declared = part, -1, part.Header.Get("Content-Type")
+	}
+
+	buffered := bufio.NewReaderSize(body, 512)
+	head, _ := buffered.Peek(512)
+	contentType := h.uploadContentType(objectKey, declared, head)
+
+	info, err := h.client.PutObject(r.Context(), bucket, objectKey, buffered, size, minio.PutObjectOptions{
+		ContentType:          contentType,
+		ServerSideEncryption: h.sse,
+	})
+	if err != nil {
+		if maxErr := (*http.MaxBytesError)(nil); errors.As(err, &maxErr) {
+			return true, caddyhttp.Error(http.StatusRequestEntityTooLarge,
+				fmt.Errorf("upload exceeds max_size of %d", maxSize))
+		}
+		return true, caddyhttp.Error(http.StatusBadGateway, fmt.Errorf("storing object: %w", err))
+	}
+
+	if h.cache != nil {
+		n, err := h.GlobalConfig.purgeObject(r.Context(), bucket, objectKey)
+		if err != nil {
+			h.logger.Error("failed to purge uploaded object from cache",
+				zap.String("bucket", bucket),
+				zap.String("key", objectKey),
+				zap.Error(err))
+		} else {
+			h.events.emitPurged("upload", n, map[string]any{"bucket": bucket, "key": objectKey})
+		}
+	}
+	h.logger.Info("stored uploaded object",
+		zap.String("bucket", bucket),
+		zap.String("key", objectKey),
+		zap.Int64("size", info.Size),
+		zap.String("content_type", contentType))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	return true, json.NewEncoder(w).Encode(uploadResult{
+		Bucket:      bucket,
+		Key:         objectKey,
+		ETag:        info.ETag,
+		Size:        info.Size,
+		ContentType: contentType,
+	})
+}
+
+// uploadPart returns the file part of a multipart POST.
+func (h *MinioStaticHTML) uploadPart(r *http.Request) (*multipart.Part, error) {
+	field := h.Upload.FormField
+	if field == "" {
+		field = defaultUploadField
+	}
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, caddyhttp.Error(http.StatusBadRequest, fmt.Errorf("reading multipart form: %w", err))
+	}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil, caddyhttp.Error(http.StatusBadRequest, fmt.Errorf("form has no %q file", field))
+		} else if err != nil {
+			return nil, caddyhttp.Error(http.StatusBadRequest, fmt.Errorf("reading multipart form: %w", err))
+		}
+		if part.FormName() == field {
+			return part, nil
+		}
+		part.Close()
+	}
+}
+
+// uploadContentType picks the type an upload is stored with: mime_types
+// for the key's extension, else the type the client declared, else the
+// extension's registered type, else one detected from the first bytes.
+func (h *MinioStaticHTML) uploadContentType(objectKey, declared string, head []byte) string {
+	ext := strings.ToLower(path.Ext(objectKey))
+	if contentType, ok := h.MimeTypes[ext]; ok {
+		return contentType
+	}
+	if !genericContentTypes[strings.ToLower(declared)] {
+		return declared
+	}
+	if contentType := mime.TypeByExtension(ext); ext != "" && contentType != "" {
+		return contentType
+	}
+	return http.DetectContentType(head)
+}
@@ -0,0 +1,119 @@
+package miniohandler
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Defaults of the A/B experiment settings.
+const (
+	defaultVariantCookie = "minio_variant"
+	defaultVariantHeader = "X-Variant"
+	defaultVariantSplit  = 50
+	defaultVariantMaxAge = 30 * 24 * time.Hour
+)
+
+// Experiment serves each visitor one of two variants of the route's
+// content, chosen at random on the first visit and kept in a cookie
+// after that. A variant ending in a slash is a prefix put before the
+// object key, so whole trees can be tested; otherwise it is the object
+// served for every request on the route.
+type Experiment struct {
+	// Variant "a" and variant "b". (Required)
+	A string `json:"a,omitempty"`
+	B string `json:"b,omitempty"`
+
+	// The percentage of new visitors given variant b (default 50).
+	Split int `json:"split,omitempty"`
+
+	// The cookie keeping a visitor's variant (default "minio_variant")
+	// and how long it lasts (default 30 days).
+	Cookie       string `json:"cookie,omitempty"`
+	CookieMaxAge string `json:"cookie_max_age,omitempty"`
+
+	// The response header naming the variant served (default
+	// "X-Variant").
+	Header string `json:"header,omitempty"`
+
+	maxAge time.Duration
+}
+
+// provision applies defaults and parses cookie_max_age.
+func (e *Experiment) provision() error {
+	if e.Split == 0 {
+		e.Split = defaultVariantSplit
+	}
+	if e.Cookie == "" {
+		e.Cookie = defaultVariantCookie
+	}
+	if e.Header == "" {
+		e.Header = defaultVariantHeader
+	}
+	e.maxAge = defaultVariantMaxAge
+	if e.CookieMaxAge != "" {
+		dur, err := time.ParseDuration(e.CookieMaxAge)
+		if err != nil {
+			return fmt.Errorf("invalid cookie_max_age: %w", err)
+		}
+		e.maxAge = dur
+	}
+	return nil
+}
+
+// validate checks the experiment settings.
+func (e *Experiment) validate() error {
+	if e.A == "" || e.B == "" {
+		return fmt.Errorf("both variants a and b are required")
+	}
+	for _, v := range []string{e.A, e.B} {
+		if strings.Contains(v, "..") {
+			return fmt.Errorf("invalid variant %q", v)
+		}
+	}
+	if e.Split < 0 || e.Split > 100 {
+		return fmt.Errorf("split must be a percentage between 0 and 100")
+	}
+	return nil
+}
+
+// selectVariant returns the object key to serve for the visitor's
+// variant, choosing and storing one if they have none yet, and names the
+// variant in the response.
+func (h *MinioStaticHTML) selectVariant(w http.ResponseWriter, r *http.Request, objectKey string) string {
+	e := h.Experiment
+	if e == nil || h.HtmlFile != "" || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+		return objectKey
+	}
+	variant := ""
+	if cookie, err := r.Cookie(e.Cookie); err == nil && (cookie.Value == "a" || cookie.Value == "b") {
+		variant = cookie.Value
+	} else {
+		variant = "a"
+		if rand.IntN(100) < e.Split {
+			variant = "b"
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     e.Cookie,
+			Value:    variant,
+			Path:     "/",
+			MaxAge:   int(e.maxAge.Seconds()),
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+	w.Header().Set(e.Header, variant)
+	w.Header().Add("Vary", "Cookie")
+
+	target := e.A
+	if variant == "b" {
+		target = e.B
+	}
+	target = strings.TrimPrefix(target, "/")
+	if strings.HasSuffix(target, "/") {
+		return target + objectKey
+	}
+	return target
+}
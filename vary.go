@@ -0,0 +1,44 @@
+package miniohandler
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// validateVary checks vary lists only valid header names.
+func (h *MinioStaticHTML) validateVary() error {
+	for _, name := range h.Vary {
+		if name == "" || strings.ContainsAny(name, " \t:,") {
+			return fmt.Errorf("vary: invalid header name %q", name)
+		}
+	}
+	return nil
+}
+
+// setVary adds every request header the response to r depends on to the
+// Vary header: those listed in vary, and Accept-Encoding if responses may
+// be encoded.
+func (h *MinioStaticHTML) setVary(w http.ResponseWriter) {
+	names := h.Vary
+	if len(h.Precompressed) > 0 || len(h.Encode) > 0 {
+		names = append([]string{"Accept-Encoding"}, names...)
+	}
+	existing := strings.Join(w.Header().Values("Vary"), ",")
+	for _, name := range names {
+		if !headerListContains(existing, name) {
+			w.Header().Add("Vary", http.CanonicalHeaderKey(name))
+		}
+	}
+}
+
+// headerListContains reports whether a comma-separated header value lists
+// token, ignoring case.
+func headerListContains(list, token string) bool {
+	for _, v := range strings.Split(list, ",") {
+		if strings.EqualFold(strings.TrimSpace(v), token) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,27 @@
+package miniohandler
+
+import (
+	"net/http"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+// versionID returns the object version to serve for r: the value of the
+// version_query parameter if configured and present, otherwise version_id
+// with placeholders expanded. Empty means the latest version.
+func (h *MinioStaticHTML) versionID(r *http.Request, repl *caddy.Replacer) string {
+	if h.VersionQuery != "" {
+		if v := r.URL.Query().Get(h.VersionQuery); v != "" {
+			return v
+		}
+	}
+	return repl.ReplaceAll(h.VersionID, "")
+}
+
+// versionCacheKey returns the key a specific version of an object is cached
+// under. Versions are immutable, so they can be cached like any object; they
+// live beside the object's own entry so that purging the object drops them
+// too.
+func versionCacheKey(cacheKey, versionID string) string {
+	return cacheKey + ":version:" + versionID
+}
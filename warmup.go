@@ -0,0 +1,236 @@
+package miniohandler
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/minio/minio-go/v7"
+	"go.uber.org/zap"
+)
+
+// defaultWarmupConcurrency is how many objects are warmed at once when
+// warmup_concurrency is not configured.
+const defaultWarmupConcurrency = 4
+
+// validateWarmup checks the warm-up settings.
+func (h *MinioStaticHTML) validateWarmup() error {
+	if h.WarmupConcurrency < 0 {
+		return fmt.Errorf("warmup_concurrency must not be negative")
+	}
+	if h.WarmupConcurrency > 0 && h.WarmupManifest == "" && h.RefreshInterval == "" {
+		return fmt.Errorf("warmup_concurrency requires warmup_manifest or refresh_interval")
+	}
+	return nil
+}
+
+// addWarmup registers h to have its manifest warmed when the app starts,
+// and its refreshed objects kept warm.
+func (m *MinioConfigModule) addWarmup(h *MinioStaticHTML) {
+	m.warmups = append(m.warmups, h)
+}
+
+// startWarmups warms the cache from every registered handler's manifest in
+// the background, so that starting the app isn't held up by MinIO, then
+// keeps the handlers' refreshed objects warm until stopWarmups is called.
+func (m *MinioConfigModule) startWarmups() {
+	if len(m.warmups) == 0 || m.cache == nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	for _, h := range m.warmups {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if h.WarmupManifest != "" {
+				h.warmUp(ctx)
+			}
+			if h.refreshInterval > 0 {
+				h.keepWarm(ctx)
+			}
+		}()
+	}
+	m.stopWarmup = func() {
+		cancel()
+		wg.Wait()
+	}
+}
+
+// stopWarmups abandons any warm-up still running and waits for it to exit.
+func (m *MinioConfigModule) stopWarmups() {
+	if m.stopWarmup != nil {
+		m.stopWarmup()
+		m.stopWarmup = nil
+	}
+}
+
+// warmUp caches the objects listed in the manifest of each of the
+// handler's static buckets, fetching up to warmup_concurrency at a time.
+// Objects already cached are skipped.
+func (h *MinioStaticHTML) warmUp(ctx context.Context) {
+	if !h.cacheEnabled() {
+		h.logger.Warn("cache unavailable; skipping warm-up", zap.String("manifest", h.WarmupManifest))
+		return
+	}
+	for _, bucket := range h.staticBuckets() {
+		keys, err := h.loadManifest(ctx, bucket)
+		if err != nil {
+			h.logger.Error("failed to load warm-up manifest",
+				zap.String("bucket", bucket),
+				zap.String("manifest", h.WarmupManifest),
+				zap.Error(err))
+			continue
+		}
+		start := time.Now()
+		warmed := h.forEachKey(ctx, keys, func(key string) bool {
+			return h.warmObject(ctx, bucket, key)
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		h.logger.Info("cache warm-up finished",
+			zap.String("bucket", bucket),
+			zap.Int("listed", len(keys)),
+			zap.Int64("warmed", warmed),
+			zap.Duration("duration", time.Since(start)))
+	}
+}
+
+// loadManifest reads the list of object keys to warm from bucket: either
+// a JSON array of keys, or one key per line with blank lines and lines
+// starting with # ignored.
+func (h *MinioStaticHTML) loadManifest(ctx context.Context, bucket string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	obj, err := h.client.GetObject(ctx, bucket, h.WarmupManifest, minio.GetObjectOptions{ServerSideEncryption: h.sse})
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Close()
+	data, err := io.ReadAll(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &keys); err != nil {
+			return nil, fmt.Errorf("parsing manifest: %w", err)
+		}
+	} else {
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line != "" && !strings.HasPrefix(line, "#") {
+				keys = append(keys, line)
+			}
+		}
+	}
+	valid := keys[:0]
+	for _, key := range keys {
+		key = strings.TrimPrefix(key, "/")
+		if key == "" || strings.Contains(key, "..") {
+			h.logger.Warn("skipping invalid warm-up manifest entry",
+				zap.String("bucket", bucket),
+				zap.String("key", key))
+			continue
+		}
+		valid = append(valid, key)
+	}
+	return valid, nil
+}
+
+// forEachKey calls fn for each of keys, up to warmup_concurrency at a
+// time, until ctx is cancelled. It returns how many calls reported true.
+func (h *MinioStaticHTML) forEachKey(ctx context.Context, keys []string, fn func(key string) bool) int64 {
+	concurrency := h.WarmupConcurrency
+	if concurrency == 0 {
+		concurrency = defaultWarmupConcurrency
+	}
+	var n atomic.Int64
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for _, key := range keys {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if fn(key) {
+				n.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	return n.Load()
+}
+
+// warmObject fetches an object from MinIO and caches it as a plain GET
+// request for it would, unless it is cached already. It reports whether
+// the object was cached.
+func (h *MinioStaticHTML) warmObject(ctx context.Context, bucket, objectKey string) bool {
+	cacheKey := h.GlobalConfig.cacheKeyFor(ctx, bucket, objectKey)
+	if n, err := h.cache.Exists(ctx, cacheKey); err == nil && n > 0 {
+		return false
+	}
+	opts := minio.GetObjectOptions{ServerSideEncryption: h.sse}
+	cached, err := h.fetchIntoCache(ctx, bucket, objectKey, cacheKey, opts)
+	if err != nil && ctx.Err() == nil {
+		h.logger.Warn("failed to fetch object for warm-up",
+			zap.String("bucket", bucket),
+			zap.String("object_key", objectKey),
+			zap.Error(err))
+	}
+	return cached
+}
+
+// fetchIntoCache fetches an object from MinIO with opts and caches it
+// under cacheKey as a plain GET request for it would. It reports whether
+// the object was cached, which it isn't if its TTL is zero.
+func (h *MinioStaticHTML) fetchIntoCache(ctx context.Context, bucket, objectKey, cacheKey string, opts minio.GetObjectOptions) (bool, error) {
+	// TTL rules match on the request, so one is made up for the object.
+	repl := caddy.NewReplacer()
+	req := &http.Request{
+		Method: http.MethodGet,
+		URL:    &url.URL{Path: strings.TrimSuffix(repl.ReplaceAll(h.PathPrefix, ""), "/") + "/" + objectKey},
+		Header: make(http.Header),
+	}
+	req = req.WithContext(context.WithValue(ctx, caddy.ReplacerCtxKey, repl))
+
+	fetchCtx := ctx
+	if h.requestTimeout > 0 {
+		var cancel context.CancelFunc
+		fetchCtx, cancel = context.WithTimeout(ctx, h.requestTimeout)
+		defer cancel()
+	}
+	objInfo, content, err := h.fetchWithFailover(fetchCtx, bucket, objectKey, opts)
+	if err != nil {
+		return false, err
+	}
+	content = h.prepareObject(objectKey, &objInfo, content)
+	ttl := h.cacheTTLFor(req, &objInfo)
+	if ttl <= 0 && !h.pinned(ctx, objectKey) {
+		return false, nil
+	}
+	h.writeEntry(req.Context(), cacheKey, bucket, objectKey, &objInfo, content, ttl)
+	return true, nil
+}
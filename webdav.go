@@ -0,0 +1,231 @@
+package miniohandler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/minio/minio-go/v7"
+	"go.uber.org/zap"
+)
+
+// webdavMaxEntries caps the members of a collection returned by a Depth: 1
+// PROPFIND.
+const webdavMaxEntries = 10000
+
+// webdavAllow lists the methods of the read-only WebDAV interface.
+const webdavAllow = "OPTIONS, GET, HEAD, PROPFIND"
+
+// webdavWriteMethods are the WebDAV methods that would change the bucket,
+// refused when webdav is enabled.
+var webdavWriteMethods = map[string]bool{
+	"PROPPATCH": true,
+	"MKCOL":     true,
+	"COPY":      true,
+	"MOVE":      true,
+	"LOCK":      true,
+	"UNLOCK":    true,
+}
+
+// davMultistatus is the body of a PROPFIND response.
+type davMultistatus struct {
+	XMLName   xml.Name      `xml:"D:multistatus"`
+	Namespace string        `xml:"xmlns:D,attr"`
+	Responses []davResponse `xml:"D:response"`
+}
+
+// davResponse holds the properties of one resource.
+type davResponse struct {
+	Href     string      `xml:"D:href"`
+	Propstat davPropstat `xml:"D:propstat"`
+}
+
+type davPropstat struct {
+	Prop   davProp `xml:"D:prop"`
+	Status string  `xml:"D:status"`
+}
+
+// davProp holds the live properties reported for every resource,
+// whichever the client asked for.
+type davProp struct {
+	DisplayName   string          `xml:"D:displayname"`
+	ResourceType  davResourceType `xml:"D:resourcetype"`
+	ContentLength *int64          `xml:"D:getcontentlength,omitempty"`
+	ContentType   string          `xml:"D:getcontenttype,omitempty"`
+	ETag          string          `xml:"D:getetag,omitempty"`
+	LastModified  string          `xml:"D:getlastmodified,omitempty"`
+}
+
+// davResourceType is empty for objects and holds <D:collection/> for
+// directories.
+type davResourceType struct {
+	Collection *struct{} `xml:"D:collection,omitempty"`
+}
+
+// serveWebDAV answers the WebDAV methods other than GET and HEAD, which
+// are served as usual, reporting false, having written nothing, for
+// other methods.
+func (h *MinioStaticHTML) serveWebDAV(w http.ResponseWriter, r *http.Request, bucket, objectKey string) (bool, error) {
+	switch {
+	case r.Method == http.MethodOptions:
+		w.Header().Set("DAV", "1")
+		w.Header().Set("Allow", webdavAllow)
+		w.Header().Set("MS-Author-Via", "DAV")
+		w.WriteHeader(http.StatusOK)
+		return true, nil
+	case r.Method == "PROPFIND":
+		return true, h.servePropfind(w, r, bucket, objectKey)
+	case webdavWriteMethods[r.Method]:
+		w.Header().Set("Allow", webdavAllow)
+		return true, caddyhttp.Error(http.StatusMethodNotAllowed, fmt.Errorf("read-only WebDAV: method not allowed: %v", r.Method))
+	}
+	return false, nil
+}
+
+// servePropfind reports the properties of the object or directory the
+// request names and, with Depth: 1, those of a directory's members.
+// Depth: infinity, the default, is refused as RFC 4918 allows.
+func (h *MinioStaticHTML) servePropfind(w http.ResponseWriter, r *http.Request, bucket, objectKey string) error {
+	depth := r.Header.Get("Depth")
+	switch depth {
+	case "0", "1":
+	case "", "infinity":
+		return caddyhttp.Error(http.StatusForbidden, errors.New("PROPFIND with Depth: infinity is not supported"))
+	default:
+		return caddyhttp.Error(http.StatusBadRequest, fmt.Errorf("invalid Depth %q", depth))
+	}
+
+	// A directory path maps to its index.html, but here names the
+	// directory itself.
+	key := objectKey
+	if strings.HasSuffix(r.URL.Path, "/") {
+		key = strings.TrimSuffix(key, "index.html")
+	}
+	href := r.URL.Path
+	status := davMultistatus{Namespace: "DAV:"}
+
+	if key != "" && !strings.HasSuffix(key, "/") {
+		prop, found, err := h.statForDAV(r.Context(), bucket, key)
+		if err != nil {
+			return caddyhttp.Error(http.StatusBadGateway, fmt.Errorf("stat object: %w", err))
+		}
+		if found {
+			status.Responses = append(status.Responses, davEntry(href, prop))
+			return writeMultistatus(w, status)
+		}
+		// Not an object; it may still name a directory.
+		key += "/"
+		href += "/"
+	}
+
+	limit := webdavMaxEntries
+	if depth == "0" {
+		limit = 1
+	}
+	items, truncated, err := h.listPrefix(r.Context(), bucket, key, "", limit, false)
+	if err != nil {
+		return caddyhttp.Error(http.StatusBadGateway, fmt.Errorf("listing objects: %w", err))
+	}
+	if key != "" && len(items) == 0 {
+		return caddyhttp.Error(http.StatusNotFound, fmt.Errorf("no object or directory %q", key))
+	}
+	if truncated && depth == "1" {
+		h.logger.Warn("WebDAV collection truncated",
+			zap.String("bucket", bucket),
+			zap.String("prefix", key),
+			zap.Int("limit", limit))
+	}
+
+	name := path.Base(strings.TrimSuffix(key, "/"))
+	if key == "" {
+		name = bucket
+	}
+	status.Responses = append(status.Responses, davEntry(href, davCollection(name)))
+	if depth == "1" {
+		for _, item := range items {
+			if item.IsDir {
+				status.Responses = append(status.Responses, davEntry(href+item.Name+"/", davCollection(item.Name)))
+				continue
+			}
+			size := item.Size
+			status.Responses = append(status.Responses, davEntry(href+item.Name, davProp{
+				DisplayName:   item.Name,
+				ContentLength: &size,
+				ContentType:   mime.TypeByExtension(path.Ext(item.Key)),
+				ETag:          `"` + item.ETag + `"`,
+				LastModified:  item.LastModified.UTC().Format(http.TimeFormat),
+			}))
+		}
+	}
+	return writeMultistatus(w, status)
+}
+
+// statForDAV returns the properties of an object, taking them from its
+// cache entry if it has one.
+func (h *MinioStaticHTML) statForDAV(ctx context.Context, bucket, objectKey string) (davProp, bool, error) {
+	prop := davProp{DisplayName: path.Base(objectKey)}
+	setProps := func(size int64, contentType, etag string, modified time.Time) {
+		prop.ContentLength = &size
+		prop.ContentType = contentType
+		prop.ETag = `"` + strings.Trim(etag, `"`) + `"`
+		prop.LastModified = modified.UTC().Format(http.TimeFormat)
+	}
+
+	if h.cacheEnabled() {
+		raw, err := getOne(ctx, h.cache, h.GlobalConfig.cacheKeyFor(ctx, bucket, objectKey))
+		if err == nil {
+			var obj CachedObject
+			if json.Unmarshal(raw, &obj) == nil && !obj.Missing {
+				setProps(obj.Size, obj.ContentType, obj.ETag, obj.LastModified)
+				return prop, true, nil
+			}
+		}
+	}
+	info, err := h.client.StatObject(ctx, bucket, objectKey, minio.StatObjectOptions{ServerSideEncryption: h.sse})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return prop, false, nil
+		}
+		return prop, false, err
+	}
+	setProps(info.Size, info.ContentType, info.ETag, info.LastModified)
+	return prop, true, nil
+}
+
+// davCollection returns the properties of a directory.
+func davCollection(name string) davProp {
+	return davProp{DisplayName: name, ResourceType: davResourceType{Collection: &struct{}{}}}
+}
+
+// davEntry wraps the properties of the resource at href, an unescaped
+// path.
+func davEntry(href string, prop davProp) davResponse {
+	return davResponse{
+		Href:     (&url.URL{Path: href}).EscapedPath(),
+		Propstat: davPropstat{Prop: prop, Status: "HTTP/1.1 200 OK"},
+	}
+}
+
+// writeMultistatus writes a 207 Multi-Status response.
+func writeMultistatus(w http.ResponseWriter, status davMultistatus) error {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	if err := xml.NewEncoder(&buf).Encode(status); err != nil {
+		return caddyhttp.Error(http.StatusInternalServerError, fmt.Errorf("encoding multistatus: %w", err))
+	}
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", buf.Len()))
+	w.WriteHeader(http.StatusMultiStatus)
+	_, err := buf.WriteTo(w)
+	return err
+}
@@ -0,0 +1,162 @@
+package miniohandler
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"go.uber.org/zap"
+)
+
+func init() {
+	caddy.RegisterModule(MinioPurgeWebhook{})
+}
+
+// maxWebhookBody caps the size of a purge webhook payload.
+const maxWebhookBody = 1 << 20
+
+// MinioPurgeWebhook is an HTTP handler that receives purge requests from
+// CI/CD pipelines. The request body is a JSON object listing the changed
+// object keys:
+//
+//	{"bucket": "mybucket", "keys": ["index.html", "about.html"]}
+//
+// Requests must be authenticated with the shared Secret, either as a
+// GitHub-style HMAC-SHA256 signature of the body in X-Hub-Signature-256
+// ("sha256=<hex>") or as the plain secret in X-Gitlab-Token.
+type MinioPurgeWebhook struct {
+	// The shared secret used to authenticate webhook calls. (Required)
+	Secret string `json:"secret,omitempty"`
+
+	// The bucket to purge from when the payload does not name one.
+	Bucket string `json:"bucket,omitempty"`
+
+	logger *zap.Logger
+	config *MinioConfigModule
+	events *eventEmitter
+}
+
+// webhookPayload is the body accepted by the purge webhook.
+type webhookPayload struct {
+	Bucket string   `json:"bucket"`
+	Keys   []string `json:"keys"`
+
+	// Soft marks the entries stale instead of deleting them.
+	Soft bool `json:"soft,omitempty"`
+}
+
+// CaddyModule returns the Caddy module information for the webhook.
+func (MinioPurgeWebhook) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.minio_purge_webhook",
+		New: func() caddy.Module { return new(MinioPurgeWebhook) },
+	}
+}
+
+// Provision sets up the purge webhook.
+func (wh *MinioPurgeWebhook) Provision(ctx caddy.Context) error {
+	wh.logger = ctx.Logger()
+
+	if wh.Secret == "" {
+		return fmt.Errorf("secret must be specified")
+	}
+
+	val, err := ctx.App("minio.config")
+	if err != nil {
+		return fmt.Errorf("the 'minio.config' app is not loaded; please configure it globally")
+	}
+	wh.config = val.(*MinioConfigModule)
+	wh.events, err = newEventEmitter(ctx)
+	return err
+}
+
+// ServeHTTP verifies the webhook signature and purges the listed keys.
+func (wh *MinioPurgeWebhook) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		return caddyhttp.Error(http.StatusMethodNotAllowed, fmt.Errorf("method not allowed: %v", r.Method))
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBody))
+	if err != nil {
+		return caddyhttp.Error(http.StatusBadRequest, err)
+	}
+	if !wh.authenticated(r, body) {
+		return caddyhttp.Error(http.StatusUnauthorized, errors.New("invalid webhook signature"))
+	}
+
+	var payload webhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return caddyhttp.Error(http.StatusBadRequest, fmt.Errorf("decoding webhook payload: %w", err))
+	}
+	bucket := payload.Bucket
+	if bucket == "" {
+		bucket = wh.Bucket
+	}
+	if bucket == "" {
+		return caddyhttp.Error(http.StatusBadRequest, errors.New("bucket must be specified"))
+	}
+	if wh.config.cache == nil {
+		return caddyhttp.Error(http.StatusServiceUnavailable, errors.New("caching is not configured"))
+	}
+
+	var total int64
+	for _, key := range payload.Keys {
+		purge := wh.config.purgeObject
+		if payload.Soft {
+			purge = wh.config.softPurgeObject
+		}
+		n, err := purge(r.Context(), bucket, key)
+		if err != nil {
+			return caddyhttp.Error(http.StatusInternalServerError, fmt.Errorf("purging %s: %w", key, err))
+		}
+		total += n
+	}
+
+	wh.logger.Info("purged cache entries from webhook",
+		zap.String("bucket", bucket),
+		zap.Int("keys", len(payload.Keys)),
+		zap.Bool("soft", payload.Soft),
+		zap.Int64("count", total),
+	)
+	wh.events.emitPurged("webhook", total, map[string]any{
+		"bucket": bucket,
+		"keys":   payload.Keys,
+		"soft":   payload.Soft,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(purgeResult(payload.Soft, total))
+}
+
+// authenticated checks the request against the shared secret, accepting
+// either a GitHub HMAC signature or a GitLab token header.
+func (wh *MinioPurgeWebhook) authenticated(r *http.Request, body []byte) bool {
+	if sig := r.Header.Get("X-Hub-Signature-256"); sig != "" {
+		got, err := hex.DecodeString(strings.TrimPrefix(sig, "sha256="))
+		if err != nil {
+			return false
+		}
+		mac := hmac.New(sha256.New, []byte(wh.Secret))
+		mac.Write(body)
+		return hmac.Equal(got, mac.Sum(nil))
+	}
+	if token := r.Header.Get("X-Gitlab-Token"); token != "" {
+		return subtle.ConstantTimeCompare([]byte(token), []byte(wh.Secret)) == 1
+	}
+	return false
+}
+
+var (
+	_ caddy.Provisioner           = (*MinioPurgeWebhook)(nil)
+	_ caddyhttp.MiddlewareHandler = (*MinioPurgeWebhook)(nil)
+)